@@ -15,9 +15,23 @@ const (
 )
 const usage string = `usage: goref <action> {arguments}.
 type "goref help" to look at allowed actions.`
-const renameUsage string = "usage: goref ren <filename> <line> <column> <new name>"
-const extractMethodUsage string = "usage: goref exm <filename> <line> <column> <end line> <end column> <new name> [<recvLine> <recvColumn>]"
-const inlineMethodUsage string = "usage: goref inm <filename> <line> <column> <end line> <end column>"
+const renameUsage string = `usage: goref ren [-e] [-c] [-t] [-n] <filename> <line> <column> <new name>
+
+-e: allow changing export status (first letter's case) of the symbol
+-c: rename whole-word occurrences of the name in doc comments and comments within symbol's scope
+-t: for struct fields, rename tag keys and string literals, naming the field in reflect FieldByName and MethodByName calls, in the same package (textual edits are marked with '~')
+-n: preview. Print identifiers and comment occurrences to be renamed, don't change anything`
+const extractMethodUsage string = `usage: goref exm [-d] [-p <params>] [-s text|json] <filename> <line> <column> <end line> <end column> <new name> [<recvLine> <recvColumn>]
+
+-d:           replace duplicates of the extracted statements in the package with calls too
+-p <params>:  comma-separated list of parameters in the desired order: name[:new name][=value|pointer|return].
+              Parameters, which are not listed, follow in the inferred order and are passed the inferred way.
+              return means, that the method returns the new value of the variable, and the call assigns it.
+-s text|json: print the signature of the method and it's call instead of extracting`
+const inlineMethodUsage string = `usage: goref inm <filename> <line> <column> <end line> <end column>
+       goref inm -all <filename> <line> <column>
+
+-all: inline every call of the function, pointed by position, and remove it's declaration`
 const implementInterfaceUsage string = `usage: goref imi [-p] <filename> <line> <column> <type line> <type column>
 
 -p: implement interface for pointerType`
@@ -30,6 +44,31 @@ const sortUsage string = `usage: goref sort [-t|-v] [-i] <filename> [<order>]
 <order>: defines custom order of groups of declarations. Default order string is 'cvtmf' which means 'constants, variables, types, methods, functions'
 Custom order string must contain at least one character from default order string. If it's length is less than the length of default order string, other entries will be added in the default order.
 Leave out order parameter to use default order.`
+const renamePackageUsage string = `usage: goref renpkg <package dir> <new name> [<new import path>]
+
+<new import path>: import path to rewrite import specs with. Package directory is moved to the last element of it.`
+const moveToFileUsage string = `usage: goref mvf [-m] <filename> <line> <column> <target file>
+
+-m: if moved declaration is a type, move it's methods too`
+const moveToPackageUsage string = "usage: goref mvp <filename> <line> <column> <target package dir>"
+const extractVariableUsage string = `usage: goref exv [-a] <filename> <line> <column> <end line> <end column> <new name>
+
+-a: replace identical side-effect-free occurrences of the expression in the rest of the block too`
+const inlineVariableUsage string = "usage: goref inv <filename> <line> <column>"
+const extractConstantUsage string = `usage: goref exc <filename> <line> <column> <new name> [-all]
+
+-all: declare constant at package level and replace every equal literal in the package`
+const changeSignatureUsage string = `usage: goref sig <filename> <line> <column> <params>
+
+<params>: comma-separated list of old parameter indices (from 0) in the new order
+and new parameters in form "name type=default", e.g. "1,0,verbose bool=false"; omitted parameters are removed`
+const introduceParameterUsage string = "usage: goref inp <filename> <line> <column> <end line> <end column> <param name>"
+const toMethodUsage string = "usage: goref tomethod <filename> <line> <column> <param index>"
+const toFunctionUsage string = "usage: goref tofunc <filename> <line> <column>"
+const switchRecieverUsage string = `usage: goref recv <filename> <line> <column> <pointer|value>
+
+position of a method switches it's reciever, position of a type switches recievers of all it's methods`
+const extractFunctionUsage string = "usage: goref exf <filename> <line> <column> <new name>"
 
 func printUsage() {
 	println("RENAME")
@@ -50,58 +89,133 @@ func printUsage() {
 	println("SORT DECLARATIONS")
 	fmt.Println(sortUsage)
 	println()
+	println("RENAME PACKAGE")
+	fmt.Println(renamePackageUsage)
+	println()
+	println("MOVE TO FILE")
+	fmt.Println(moveToFileUsage)
+	println()
+	println("MOVE TO PACKAGE")
+	fmt.Println(moveToPackageUsage)
+	println()
+	println("EXTRACT VARIABLE")
+	fmt.Println(extractVariableUsage)
+	println()
+	println("INLINE VARIABLE")
+	fmt.Println(inlineVariableUsage)
+	println()
+	println("EXTRACT CONSTANT")
+	fmt.Println(extractConstantUsage)
+	println()
+	println("CHANGE SIGNATURE")
+	fmt.Println(changeSignatureUsage)
+	println()
+	println("INTRODUCE PARAMETER")
+	fmt.Println(introduceParameterUsage)
+	println()
+	println("CONVERT FUNCTION TO METHOD")
+	fmt.Println(toMethodUsage)
+	println()
+	println("CONVERT METHOD TO FUNCTION")
+	fmt.Println(toFunctionUsage)
+	println()
+	println("SWITCH RECIEVER")
+	fmt.Println(switchRecieverUsage)
+	println()
+	println("EXTRACT FUNCTION LITERAL")
+	fmt.Println(extractFunctionUsage)
+	println()
 }
 
-func getRenameArgs() (filename string, line int, column int, entityName string, ok bool) {
+func getRenameArgs() (filename string, line int, column int, entityName string, changeAccess bool, renameComments bool, renameTags bool, preview bool, ok bool) {
 	var err os.Error
-	if len(os.Args) < 6 {
+	p := 0
+	for ; 2+p < len(os.Args); p++ {
+		switch os.Args[2+p] {
+		case "-e":
+			changeAccess = true
+			continue
+		case "-c":
+			renameComments = true
+			continue
+		case "-t":
+			renameTags = true
+			continue
+		case "-n":
+			preview = true
+			continue
+		}
+		break
+	}
+	if len(os.Args) < 6+p {
 		return
 	}
-	filename = os.Args[2]
-	line, err = strconv.Atoi(os.Args[3])
+	filename = os.Args[2+p]
+	line, err = strconv.Atoi(os.Args[3+p])
 	if err != nil {
 		return
 	}
-	column, err = strconv.Atoi(os.Args[4])
+	column, err = strconv.Atoi(os.Args[4+p])
 	if err != nil {
 		return
 	}
-	entityName = os.Args[5]
+	entityName = os.Args[5+p]
 	ok = true
 	return
 }
 
-func getExtractMethodArgs() (filename string, line int, column int, endLine int, endColumn int, entityName string, recvLine int, recvColumn int, ok bool) {
+func getExtractMethodArgs() (filename string, line int, column int, endLine int, endColumn int, entityName string, recvLine int, recvColumn int, replaceDuplicates bool, params string, preview string, ok bool) {
 	var err os.Error
-	if len(os.Args) < 8 {
+	p := 0
+	for len(os.Args) > 2+p {
+		switch os.Args[2+p] {
+		case "-d":
+			replaceDuplicates = true
+			p++
+			continue
+		case "-p", "-s":
+			if len(os.Args) < 4+p {
+				return
+			}
+			if os.Args[2+p] == "-p" {
+				params = os.Args[3+p]
+			} else {
+				preview = os.Args[3+p]
+			}
+			p += 2
+			continue
+		}
+		break
+	}
+	if len(os.Args) < 8+p {
 		return
 	}
-	filename = os.Args[2]
-	line, err = strconv.Atoi(os.Args[3])
+	filename = os.Args[2+p]
+	line, err = strconv.Atoi(os.Args[3+p])
 	if err != nil {
 		return
 	}
-	column, err = strconv.Atoi(os.Args[4])
+	column, err = strconv.Atoi(os.Args[4+p])
 	if err != nil {
 		return
 	}
-	endLine, err = strconv.Atoi(os.Args[5])
+	endLine, err = strconv.Atoi(os.Args[5+p])
 	if err != nil {
 		return
 	}
-	endColumn, err = strconv.Atoi(os.Args[6])
+	endColumn, err = strconv.Atoi(os.Args[6+p])
 	if err != nil {
 		return
 	}
-	entityName = os.Args[7]
+	entityName = os.Args[7+p]
 	recvLine = -1
 	recvColumn = -1
-	if len(os.Args) >= 10 {
-		recvLine, err = strconv.Atoi(os.Args[8])
+	if len(os.Args) >= 10+p {
+		recvLine, err = strconv.Atoi(os.Args[8+p])
 		if err != nil {
 			return
 		}
-		recvColumn, err = strconv.Atoi(os.Args[9])
+		recvColumn, err = strconv.Atoi(os.Args[9+p])
 		if err != nil {
 			return
 		}
@@ -110,6 +224,24 @@ func getExtractMethodArgs() (filename string, line int, column int, endLine int,
 	return
 }
 
+func getInlineAllArgs() (filename string, line int, column int, ok bool) {
+	var err os.Error
+	if len(os.Args) != 6 {
+		return
+	}
+	filename = os.Args[3]
+	line, err = strconv.Atoi(os.Args[4])
+	if err != nil {
+		return
+	}
+	column, err = strconv.Atoi(os.Args[5])
+	if err != nil {
+		return
+	}
+	ok = true
+	return
+}
+
 func getInlineMethodArgs() (filename string, line int, column int, endLine int, endColumn int, ok bool) {
 	var err os.Error
 	if len(os.Args) < 7 {
@@ -172,7 +304,22 @@ func getImplementInterfaceArgs() (filename string, line int, column int, typeFil
 }
 
 func getExtractInterfaceArgs() (filename string, line int, column int, interfaceName string, ok bool) {
-	return getRenameArgs()
+	var err os.Error
+	if len(os.Args) < 6 {
+		return
+	}
+	filename = os.Args[2]
+	line, err = strconv.Atoi(os.Args[3])
+	if err != nil {
+		return
+	}
+	column, err = strconv.Atoi(os.Args[4])
+	if err != nil {
+		return
+	}
+	interfaceName = os.Args[5]
+	ok = true
+	return
 }
 
 func getSortArgs() (filename string, groupMethodsByType bool, groupMethodsByVisibility bool, sortImports bool, order string, ok bool) {
@@ -209,6 +356,268 @@ func getSortArgs() (filename string, groupMethodsByType bool, groupMethodsByVisi
 	return
 }
 
+func getRenamePackageArgs() (packageDir string, newName string, newGoPath string, ok bool) {
+	if len(os.Args) < 4 {
+		return
+	}
+	packageDir = os.Args[2]
+	newName = os.Args[3]
+	if len(os.Args) > 4 {
+		newGoPath = os.Args[4]
+	}
+	ok = true
+	return
+}
+
+func getMoveToFileArgs() (filename string, line int, column int, targetFile string, withMethods bool, ok bool) {
+	var err os.Error
+	p := 0
+	if len(os.Args) > 2 && os.Args[2] == "-m" {
+		withMethods = true
+		p++
+	}
+	if len(os.Args) < 6+p {
+		return
+	}
+	filename = os.Args[2+p]
+	line, err = strconv.Atoi(os.Args[3+p])
+	if err != nil {
+		return
+	}
+	column, err = strconv.Atoi(os.Args[4+p])
+	if err != nil {
+		return
+	}
+	targetFile = os.Args[5+p]
+	ok = true
+	return
+}
+
+func getMoveToPackageArgs() (filename string, line int, column int, targetDir string, ok bool) {
+	var err os.Error
+	if len(os.Args) < 6 {
+		return
+	}
+	filename = os.Args[2]
+	line, err = strconv.Atoi(os.Args[3])
+	if err != nil {
+		return
+	}
+	column, err = strconv.Atoi(os.Args[4])
+	if err != nil {
+		return
+	}
+	targetDir = os.Args[5]
+	ok = true
+	return
+}
+
+func getExtractVariableArgs() (filename string, line int, column int, endLine int, endColumn int, varName string, replaceAll bool, ok bool) {
+	var err os.Error
+	p := 0
+	if len(os.Args) > 2 && os.Args[2] == "-a" {
+		replaceAll = true
+		p++
+	}
+	if len(os.Args) < 8+p {
+		return
+	}
+	filename = os.Args[2+p]
+	line, err = strconv.Atoi(os.Args[3+p])
+	if err != nil {
+		return
+	}
+	column, err = strconv.Atoi(os.Args[4+p])
+	if err != nil {
+		return
+	}
+	endLine, err = strconv.Atoi(os.Args[5+p])
+	if err != nil {
+		return
+	}
+	endColumn, err = strconv.Atoi(os.Args[6+p])
+	if err != nil {
+		return
+	}
+	varName = os.Args[7+p]
+	ok = true
+	return
+}
+
+func getInlineVariableArgs() (filename string, line int, column int, ok bool) {
+	var err os.Error
+	if len(os.Args) < 5 {
+		return
+	}
+	filename = os.Args[2]
+	line, err = strconv.Atoi(os.Args[3])
+	if err != nil {
+		return
+	}
+	column, err = strconv.Atoi(os.Args[4])
+	if err != nil {
+		return
+	}
+	ok = true
+	return
+}
+
+func getExtractConstantArgs() (filename string, line int, column int, constName string, replaceAll bool, ok bool) {
+	var err os.Error
+	if len(os.Args) < 6 {
+		return
+	}
+	filename = os.Args[2]
+	line, err = strconv.Atoi(os.Args[3])
+	if err != nil {
+		return
+	}
+	column, err = strconv.Atoi(os.Args[4])
+	if err != nil {
+		return
+	}
+	constName = os.Args[5]
+	if len(os.Args) > 6 {
+		if os.Args[6] != "-all" {
+			return
+		}
+		replaceAll = true
+	}
+	ok = true
+	return
+}
+
+func getChangeSignatureArgs() (filename string, line int, column int, params string, ok bool) {
+	var err os.Error
+	if len(os.Args) != 6 {
+		return
+	}
+	filename = os.Args[2]
+	line, err = strconv.Atoi(os.Args[3])
+	if err != nil {
+		return
+	}
+	column, err = strconv.Atoi(os.Args[4])
+	if err != nil {
+		return
+	}
+	params = os.Args[5]
+	ok = true
+	return
+}
+
+func getIntroduceParameterArgs() (filename string, line int, column int, endLine int, endColumn int, paramName string, ok bool) {
+	var err os.Error
+	if len(os.Args) != 8 {
+		return
+	}
+	filename = os.Args[2]
+	line, err = strconv.Atoi(os.Args[3])
+	if err != nil {
+		return
+	}
+	column, err = strconv.Atoi(os.Args[4])
+	if err != nil {
+		return
+	}
+	endLine, err = strconv.Atoi(os.Args[5])
+	if err != nil {
+		return
+	}
+	endColumn, err = strconv.Atoi(os.Args[6])
+	if err != nil {
+		return
+	}
+	paramName = os.Args[7]
+	ok = true
+	return
+}
+
+func getToMethodArgs() (filename string, line int, column int, paramIndex int, ok bool) {
+	var err os.Error
+	if len(os.Args) != 6 {
+		return
+	}
+	filename = os.Args[2]
+	line, err = strconv.Atoi(os.Args[3])
+	if err != nil {
+		return
+	}
+	column, err = strconv.Atoi(os.Args[4])
+	if err != nil {
+		return
+	}
+	paramIndex, err = strconv.Atoi(os.Args[5])
+	if err != nil {
+		return
+	}
+	ok = true
+	return
+}
+
+func getToFunctionArgs() (filename string, line int, column int, ok bool) {
+	var err os.Error
+	if len(os.Args) != 5 {
+		return
+	}
+	filename = os.Args[2]
+	line, err = strconv.Atoi(os.Args[3])
+	if err != nil {
+		return
+	}
+	column, err = strconv.Atoi(os.Args[4])
+	if err != nil {
+		return
+	}
+	ok = true
+	return
+}
+
+func getSwitchRecieverArgs() (filename string, line int, column int, toPointer bool, ok bool) {
+	var err os.Error
+	if len(os.Args) != 6 {
+		return
+	}
+	filename = os.Args[2]
+	line, err = strconv.Atoi(os.Args[3])
+	if err != nil {
+		return
+	}
+	column, err = strconv.Atoi(os.Args[4])
+	if err != nil {
+		return
+	}
+	switch os.Args[5] {
+	case "pointer":
+		toPointer = true
+	case "value":
+		toPointer = false
+	default:
+		return
+	}
+	ok = true
+	return
+}
+
+func getExtractFunctionArgs() (filename string, line int, column int, funcName string, ok bool) {
+	var err os.Error
+	if len(os.Args) != 6 {
+		return
+	}
+	filename = os.Args[2]
+	line, err = strconv.Atoi(os.Args[3])
+	if err != nil {
+		return
+	}
+	column, err = strconv.Atoi(os.Args[4])
+	if err != nil {
+		return
+	}
+	funcName = os.Args[5]
+	ok = true
+	return
+}
+
 func main() {
 	if len(os.Args) <= 1 {
 		fmt.Printf("%s\n", usage)
@@ -268,7 +677,7 @@ func main() {
 		fmt.Printf("Initialized goref project. Now fill goref.cfg with your packages.")
 
 	case refactoring.RENAME:
-		filename, line, column, entityName, ok := getRenameArgs()
+		filename, line, column, entityName, changeAccess, renameComments, renameTags, preview, ok := getRenameArgs()
 		if !ok {
 			fmt.Println(renameUsage)
 			return
@@ -280,11 +689,11 @@ func main() {
 		}
 		fmt.Println("renaming symbol to ", entityName+"...")
 
-		if ok, err := refactoring.Rename(filename, line, column, entityName); !ok {
+		if ok, err := refactoring.Rename(filename, line, column, entityName, changeAccess, renameComments, renameTags, preview); !ok {
 			fmt.Println("error:", err.Message)
 		}
 	case refactoring.EXTRACT_METHOD:
-		filename, line, column, endLine, endColumn, entityName, recvLine, recvColumn, ok := getExtractMethodArgs()
+		filename, line, column, endLine, endColumn, entityName, recvLine, recvColumn, replaceDuplicates, params, preview, ok := getExtractMethodArgs()
 		if !ok {
 			fmt.Println(extractMethodUsage)
 			return
@@ -294,11 +703,27 @@ func main() {
 			return
 		}
 		fmt.Println("extracting code to method ", entityName+"...")
-		if ok, err := refactoring.ExtractMethod(filename, line, column, endLine, endColumn, entityName, recvLine, recvColumn); !ok {
+		if ok, err := refactoring.ExtractMethod(filename, line, column, endLine, endColumn, entityName, recvLine, recvColumn, replaceDuplicates, params, preview); !ok {
 			fmt.Println("error:", err.Message)
 			return
 		}
 	case refactoring.INLINE_METHOD:
+		if len(os.Args) > 2 && os.Args[2] == "-all" {
+			filename, line, column, ok := getInlineAllArgs()
+			if !ok {
+				fmt.Println(inlineMethodUsage)
+				return
+			}
+			if ok, err := refactoring.CheckInlineAllParameters(filename, line, column); !ok {
+				fmt.Println("error:", err.Message)
+				return
+			}
+			fmt.Println("inlining all calls...")
+			if ok, err := refactoring.InlineAll(filename, line, column); !ok {
+				fmt.Println("error:", err.Message)
+			}
+			return
+		}
 		filename, line, column, endLine, endColumn, ok := getInlineMethodArgs()
 		if !ok {
 			fmt.Println(inlineMethodUsage)
@@ -361,6 +786,186 @@ func main() {
 			fmt.Println("error:", err.Message)
 			return
 		}
+	case refactoring.RENAME_PACKAGE:
+		packageDir, newName, newGoPath, ok := getRenamePackageArgs()
+		if !ok {
+			fmt.Println(renamePackageUsage)
+			return
+		}
+		if ok, err := refactoring.CheckRenamePackageParameters(packageDir, newName, newGoPath); !ok {
+			fmt.Println("error:", err.Message)
+			return
+		}
+		fmt.Println("renaming package to " + newName + "...")
+		if ok, err := refactoring.RenamePackage(packageDir, newName, newGoPath); !ok {
+			fmt.Println("error:", err.Message)
+			return
+		}
+	case refactoring.MOVE_TO_FILE:
+		filename, line, column, targetFile, withMethods, ok := getMoveToFileArgs()
+		if !ok {
+			fmt.Println(moveToFileUsage)
+			return
+		}
+		if ok, err := refactoring.CheckMoveToFileParameters(filename, line, column, targetFile); !ok {
+			fmt.Println("error:", err.Message)
+			return
+		}
+		fmt.Println("moving declaration to " + targetFile + "...")
+		if ok, err := refactoring.MoveToFile(filename, line, column, targetFile, withMethods); !ok {
+			fmt.Println("error:", err.Message)
+			return
+		}
+	case refactoring.MOVE_TO_PACKAGE:
+		filename, line, column, targetDir, ok := getMoveToPackageArgs()
+		if !ok {
+			fmt.Println(moveToPackageUsage)
+			return
+		}
+		if ok, err := refactoring.CheckMoveToPackageParameters(filename, line, column, targetDir); !ok {
+			fmt.Println("error:", err.Message)
+			return
+		}
+		fmt.Println("moving declaration to " + targetDir + "...")
+		if ok, err := refactoring.MoveToPackage(filename, line, column, targetDir); !ok {
+			fmt.Println("error:", err.Message)
+			return
+		}
+	case refactoring.EXTRACT_VARIABLE:
+		filename, line, column, endLine, endColumn, varName, replaceAll, ok := getExtractVariableArgs()
+		if !ok {
+			fmt.Println(extractVariableUsage)
+			return
+		}
+		if ok, err := refactoring.CheckExtractVariableParameters(filename, line, column, endLine, endColumn, varName); !ok {
+			fmt.Println("error:", err.Message)
+			return
+		}
+		fmt.Println("extracting variable " + varName + "...")
+		if ok, err := refactoring.ExtractVariable(filename, line, column, endLine, endColumn, varName, replaceAll); !ok {
+			fmt.Println("error:", err.Message)
+			return
+		}
+	case refactoring.INLINE_VARIABLE:
+		filename, line, column, ok := getInlineVariableArgs()
+		if !ok {
+			fmt.Println(inlineVariableUsage)
+			return
+		}
+		if ok, err := refactoring.CheckInlineVariableParameters(filename, line, column); !ok {
+			fmt.Println("error:", err.Message)
+			return
+		}
+		fmt.Println("inlining variable...")
+		if ok, err := refactoring.InlineVariable(filename, line, column); !ok {
+			fmt.Println("error:", err.Message)
+			return
+		}
+	case refactoring.EXTRACT_CONSTANT:
+		filename, line, column, constName, replaceAll, ok := getExtractConstantArgs()
+		if !ok {
+			fmt.Println(extractConstantUsage)
+			return
+		}
+		if ok, err := refactoring.CheckExtractConstantParameters(filename, line, column, constName); !ok {
+			fmt.Println("error:", err.Message)
+			return
+		}
+		fmt.Println("extracting constant " + constName + "...")
+		if ok, err := refactoring.ExtractConstant(filename, line, column, constName, replaceAll); !ok {
+			fmt.Println("error:", err.Message)
+			return
+		}
+	case refactoring.CHANGE_SIGNATURE:
+		filename, line, column, params, ok := getChangeSignatureArgs()
+		if !ok {
+			fmt.Println(changeSignatureUsage)
+			return
+		}
+		if ok, err := refactoring.CheckChangeSignatureParameters(filename, line, column); !ok {
+			fmt.Println("error:", err.Message)
+			return
+		}
+		fmt.Println("changing signature...")
+		if ok, err := refactoring.ChangeSignature(filename, line, column, params); !ok {
+			fmt.Println("error:", err.Message)
+			return
+		}
+	case refactoring.INTRODUCE_PARAMETER:
+		filename, line, column, endLine, endColumn, paramName, ok := getIntroduceParameterArgs()
+		if !ok {
+			fmt.Println(introduceParameterUsage)
+			return
+		}
+		if ok, err := refactoring.CheckIntroduceParameterParameters(filename, line, column, endLine, endColumn, paramName); !ok {
+			fmt.Println("error:", err.Message)
+			return
+		}
+		fmt.Println("introducing parameter " + paramName + "...")
+		if ok, err := refactoring.IntroduceParameter(filename, line, column, endLine, endColumn, paramName); !ok {
+			fmt.Println("error:", err.Message)
+			return
+		}
+	case refactoring.TO_METHOD:
+		filename, line, column, paramIndex, ok := getToMethodArgs()
+		if !ok {
+			fmt.Println(toMethodUsage)
+			return
+		}
+		if ok, err := refactoring.CheckConvertFunctionParameters(filename, line, column); !ok {
+			fmt.Println("error:", err.Message)
+			return
+		}
+		fmt.Println("converting function to method...")
+		if ok, err := refactoring.ConvertToMethod(filename, line, column, paramIndex); !ok {
+			fmt.Println("error:", err.Message)
+			return
+		}
+	case refactoring.TO_FUNCTION:
+		filename, line, column, ok := getToFunctionArgs()
+		if !ok {
+			fmt.Println(toFunctionUsage)
+			return
+		}
+		if ok, err := refactoring.CheckConvertFunctionParameters(filename, line, column); !ok {
+			fmt.Println("error:", err.Message)
+			return
+		}
+		fmt.Println("converting method to function...")
+		if ok, err := refactoring.ConvertToFunction(filename, line, column); !ok {
+			fmt.Println("error:", err.Message)
+			return
+		}
+	case refactoring.SWITCH_RECIEVER:
+		filename, line, column, toPointer, ok := getSwitchRecieverArgs()
+		if !ok {
+			fmt.Println(switchRecieverUsage)
+			return
+		}
+		if ok, err := refactoring.CheckSwitchRecieverParameters(filename, line, column); !ok {
+			fmt.Println("error:", err.Message)
+			return
+		}
+		fmt.Println("switching reciever...")
+		if ok, err := refactoring.SwitchReciever(filename, line, column, toPointer); !ok {
+			fmt.Println("error:", err.Message)
+			return
+		}
+	case refactoring.EXTRACT_FUNCTION:
+		filename, line, column, funcName, ok := getExtractFunctionArgs()
+		if !ok {
+			fmt.Println(extractFunctionUsage)
+			return
+		}
+		if ok, err := refactoring.CheckExtractFunctionParameters(filename, line, column, funcName); !ok {
+			fmt.Println("error:", err.Message)
+			return
+		}
+		fmt.Println("extracting function literal...")
+		if ok, err := refactoring.ExtractFunction(filename, line, column, funcName); !ok {
+			fmt.Println("error:", err.Message)
+			return
+		}
 	default:
 		fmt.Printf("%s\n", usage)
 	}
@@ -200,6 +200,9 @@ func (pp *packageParser) registerIdent(sym st.Symbol, ident *ast.Ident) {
 	sym.AddIdent(ident)
 	pp.IdentMap.AddIdent(ident, sym)
 	sym.AddPosition(pp.Package.FileSet.Position(ident.Pos()))
+	if _, ok := pp.Package.IdentScopes[ident]; !ok {
+		pp.Package.IdentScopes[ident] = pp.CurrentSymbolTable
+	}
 }
 //Builds a type symbol according to given ast.Expression
 func (pp *packageParser) parseTypeSymbol(typ ast.Expr) (result st.ITypeSymbol) {
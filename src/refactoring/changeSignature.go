@@ -0,0 +1,446 @@
+package refactoring
+
+import (
+	"refactoring/st"
+	"refactoring/errors"
+	"refactoring/program"
+	"go/ast"
+	"go/token"
+	"go/parser"
+	"strconv"
+	"strings"
+)
+
+// parameter of the new signature; Old is an index in the old parameter list, -1 for a new parameter
+type sigParam struct {
+	Name, Type string
+	Old        int
+	Default    string //argument for existing calls
+}
+
+// parameter of the old signature
+type oldParam struct {
+	Name     *ast.Ident //nil if parameters are unnamed
+	Type     ast.Expr
+	Variadic bool
+}
+
+// splits s by sep, that is not enclosed in brackets or quotes
+func splitTopLevel(s string, sep byte) []string {
+	res := []string{}
+	depth, start := 0, 0
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote != '`' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'' || c == '`':
+			quote = c
+		case c == '(' || c == '[' || c == '{':
+			depth++
+		case c == ')' || c == ']' || c == '}':
+			depth--
+		case c == sep && depth == 0:
+			res = append(res, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(res, s[start:])
+}
+
+// parses parameter spec: comma-separated list of old parameter indices and new parameters "name type=default"
+func parseSignatureSpec(spec string) ([]*sigParam, *errors.GoRefactorError) {
+	res := []*sigParam{}
+	if strings.TrimSpace(spec) == "" {
+		return res, nil
+	}
+	for _, el := range splitTopLevel(spec, ',') {
+		el = strings.TrimSpace(el)
+		if i, err := strconv.Atoi(el); err == nil {
+			res = append(res, &sigParam{"", "", i, ""})
+			continue
+		}
+		parts := splitTopLevel(el, '=')
+		if len(parts) < 2 {
+			return nil, errors.ArgumentError("params", "new parameter '"+el+"' must have a default argument: name type=default")
+		}
+		decl := strings.TrimSpace(parts[0])
+		def := strings.TrimSpace(el[len(parts[0])+1:])
+		sp := strings.Index(decl, " ")
+		if sp == -1 || def == "" {
+			return nil, errors.ArgumentError("params", "new parameter '"+el+"' must be in form: name type=default")
+		}
+		name, typ := decl[:sp], strings.TrimSpace(decl[sp+1:])
+		if !IsGoIdent(name) {
+			return nil, errors.ArgumentError("params", name+" is not a valid go identifier")
+		}
+		res = append(res, &sigParam{name, typ, -1, def})
+	}
+	return res, nil
+}
+
+func getOldParams(ftype *ast.FuncType) []*oldParam {
+	res := []*oldParam{}
+	if ftype.Params == nil {
+		return res
+	}
+	for _, f := range ftype.Params.List {
+		typ, variadic := f.Type, false
+		if _, ok := f.Type.(*ast.Ellipsis); ok {
+			variadic = true
+		}
+		if len(f.Names) == 0 {
+			res = append(res, &oldParam{nil, typ, variadic})
+		}
+		for _, n := range f.Names {
+			res = append(res, &oldParam{n, typ, variadic})
+		}
+	}
+	return res
+}
+
+func changeSignatureError(message string) *errors.GoRefactorError {
+	return &errors.GoRefactorError{ErrorType: "change signature error", Message: message}
+}
+
+// checks new parameter list against the old one
+func checkSignatureSpec(programTree *program.Program, pack *st.Package, decl *ast.FuncDecl, old []*oldParam, params []*sigParam) *errors.GoRefactorError {
+	selectors, members := getMemberIdents(programTree)
+	used := make(map[int]bool)
+	for i, p := range params {
+		if p.Old == -1 {
+			if len(old) > 0 && old[0].Name == nil {
+				return changeSignatureError("parameters of the function are unnamed, new parameter " + p.Name + " can't be added")
+			}
+			// reciever, parameters, results and declarations of the body mustn't have the name,
+			// references in the body mustn't be captured by it
+			nv := &nameUsesVisitor{p.Name, selectors, members, nil}
+			if decl.Recv != nil {
+				ast.Walk(nv, decl.Recv)
+			}
+			ast.Walk(nv, decl.Type)
+			if decl.Body != nil {
+				ast.Walk(nv, decl.Body)
+			}
+			if nv.found != nil {
+				return changeSignatureError("name " + p.Name + " is already used in the function at " + pack.FileSet.Position(nv.found.Pos()).String())
+			}
+			continue
+		}
+		if p.Old < 0 || p.Old >= len(old) {
+			return errors.ArgumentError("params", "there is no parameter with index "+strconv.Itoa(p.Old))
+		}
+		if _, ok := used[p.Old]; ok {
+			return errors.ArgumentError("params", "parameter "+strconv.Itoa(p.Old)+" is used twice")
+		}
+		used[p.Old] = true
+		if old[p.Old].Variadic && i != len(params)-1 {
+			return changeSignatureError("variadic parameter must stay the last one")
+		}
+	}
+	for i, o := range old {
+		if _, ok := used[i]; ok || o.Name == nil || o.Name.Name == "_" {
+			continue
+		}
+		if sym, ok := programTree.IdentMap[o.Name]; ok && len(sym.Identifiers()) > 1 {
+			return changeSignatureError("parameter " + o.Name.Name + " is used in the function body and can't be removed")
+		}
+	}
+	return nil
+}
+
+func CheckChangeSignatureParameters(filename string, line int, column int) (bool, *errors.GoRefactorError) {
+	if err := checkPositionParameters(filename, line, column); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Changes parameter list of the function or method, pointed by position, according to spec:
+// comma-separated list of old parameter indices (from 0) in the new order and new parameters
+// in form "name type=default", where default is an argument for existing calls.
+// Omitted parameters are removed, if they are unused.
+func ChangeSignature(filename string, line int, column int, spec string) (bool, *errors.GoRefactorError) {
+	if ok, err := CheckChangeSignatureParameters(filename, line, column); !ok {
+		return false, err
+	}
+	params, err := parseSignatureSpec(spec)
+	if err != nil {
+		return false, err
+	}
+	programTree := parseProgram(filename)
+	edits, err := changeSignature(programTree, filename, line, column, params)
+	if err != nil {
+		return false, err
+	}
+	if err := applyFileEdits(programTree, edits); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// a call of the function
+type callSite struct {
+	pack     *st.Package
+	filename string
+	path     []ast.Node //path from the file to the call
+	call     *ast.CallExpr
+	fun      *ast.Ident //reference to the function in the call
+	shift    int        //1 for method expressions, that get reciever as the first argument
+}
+
+// calls of the function and references, where it's used as a value;
+// for the latter call is nil and path ends at the referring expression
+func getCallSites(programTree *program.Program, fsym *st.FunctionSymbol, decl *ast.FuncDecl) ([]*callSite, []*callSite) {
+	calls, values := []*callSite{}, []*callSite{}
+	for id, _ := range fsym.Identifiers() {
+		if id == decl.Name {
+			continue
+		}
+		p, file := programTree.FindPackageAndFileByFilename(fsym.PackageFrom().FileSet.Position(id.Pos()).Filename)
+		if p == nil {
+			continue
+		}
+		fset := p.FileSet
+		path := getNodePath(fset, file, id)
+		if len(path) < 3 {
+			continue
+		}
+		var e ast.Expr = id
+		shift := 0
+		if sel, ok := path[len(path)-2].(*ast.SelectorExpr); ok && sel.Sel == id {
+			e, path = sel, path[:len(path)-1]
+			if isTypeExpr(programTree.IdentMap, sel.X) {
+				shift = 1
+			}
+		}
+		call, ok := path[len(path)-2].(*ast.CallExpr)
+		if !ok || call.Fun != e || len(call.Args) < shift {
+			values = append(values, &callSite{p, fset.Position(id.Pos()).Filename, path, nil, id, shift})
+			continue
+		}
+		calls = append(calls, &callSite{p, fset.Position(id.Pos()).Filename, path[:len(path)-1], call, id, shift})
+	}
+	return calls, values
+}
+
+func sitePositions(sites []*callSite) string {
+	s := ""
+	for _, c := range sites {
+		s += "\n\t" + c.pack.FileSet.Position(c.fun.Pos()).String()
+	}
+	return s
+}
+
+// describes interface methods, that the method implements; empty string if there are none
+func getImplementedInterfaces(programTree *program.Program, fsym *st.FunctionSymbol) string {
+	s := ""
+	if methods, bindings := getConnectedMethods(programTree, fsym); len(methods) > 1 {
+		for _, b := range bindings {
+			s += "\n\t" + bindingTypeName(b) + " would stop satisfying " + qualifiedTypeName(b.Interface) + " (method " + b.Method.Name() + ")"
+		}
+	}
+	return s
+}
+
+func changeSignature(programTree *program.Program, filename string, line int, column int, params []*sigParam) (map[string][]*fileEdit, *errors.GoRefactorError) {
+	sym, err := programTree.FindSymbolByPosition(filename, line, column)
+	if err != nil {
+		return nil, err
+	}
+	fsym, ok := sym.(*st.FunctionSymbol)
+	if !ok {
+		return nil, changeSignatureError(sym.Name() + " is not a function")
+	}
+	pack := fsym.PackageFrom()
+	if pack == nil || pack.IsGoPackage {
+		return nil, changeSignatureError("function " + sym.Name() + " doesn't belong to the program")
+	}
+	if fsym.IsInterfaceMethod {
+		return nil, changeSignatureError(sym.Name() + " is an interface method")
+	}
+	if s := getImplementedInterfaces(programTree, fsym); s != "" {
+		return nil, changeSignatureError("method " + sym.Name() + " implements an interface method:" + s)
+	}
+	decl, declFile, err := getDeclarationInFile(programTree, pack, fsym)
+	if err != nil {
+		return nil, err
+	}
+	old := getOldParams(decl.Type)
+	if err := checkSignatureSpec(programTree, pack, decl, old, params); err != nil {
+		return nil, err
+	}
+	variadic := len(old) > 0 && old[len(old)-1].Variadic
+
+	contents := make(fileContents)
+	edits := make(map[string][]*fileEdit)
+	dc, err := contents.read(declFile)
+	if err != nil {
+		return nil, err
+	}
+	list := []string{}
+	for _, p := range params {
+		switch {
+		case p.Old == -1:
+			list = append(list, p.Name+" "+p.Type)
+		case old[p.Old].Name == nil:
+			list = append(list, nodeText(pack.FileSet, dc, old[p.Old].Type))
+		default:
+			list = append(list, old[p.Old].Name.Name+" "+nodeText(pack.FileSet, dc, old[p.Old].Type))
+		}
+	}
+	edits[declFile] = append(edits[declFile], &fileEdit{pack.FileSet.Position(decl.Type.Params.Opening).Offset + 1, pack.FileSet.Position(decl.Type.Params.Closing).Offset, strings.Join(list, ", ")})
+
+	calls, values := getCallSites(programTree, fsym, decl)
+	if len(values) > 0 {
+		return nil, changeSignatureError("function " + sym.Name() + " is used as a value, it's type must stay the same:" + sitePositions(values))
+	}
+	for _, c := range calls {
+		text, err := contents.read(c.filename)
+		if err != nil {
+			return nil, err
+		}
+		defaults, err := getCallDefaults(pack, declFile, params, c)
+		if err != nil {
+			return nil, err
+		}
+		args, err := getNewArguments(programTree, c.pack, c.filename, text, c.call, old, params, defaults, c.shift, variadic)
+		if err != nil {
+			return nil, err
+		}
+		fset := c.pack.FileSet
+		edits[c.filename] = append(edits[c.filename], &fileEdit{fset.Position(c.call.Lparen).Offset + 1, fset.Position(c.call.Rparen).Offset, args})
+	}
+	return edits, nil
+}
+
+// default arguments of new parameters for the call; in a call from another package
+// package-level names of the function's package are qualified with it's local name
+func getCallDefaults(pack *st.Package, declFile string, params []*sigParam, c *callSite) (map[*sigParam]string, *errors.GoRefactorError) {
+	res := make(map[*sigParam]string)
+	pos := c.pack.FileSet.Position(c.call.Pos()).String()
+	for _, p := range params {
+		if p.Old != -1 {
+			continue
+		}
+		res[p] = p.Default
+		if c.pack == pack {
+			continue
+		}
+		fset := token.NewFileSet()
+		e, perr := parser.ParseExpr(fset, "", p.Default)
+		if perr != nil {
+			return nil, changeSignatureError("default argument " + p.Default + " is not an expression")
+		}
+		v := &memberIdentsVisitor{make(map[*ast.Ident]bool), make(map[*ast.Ident]bool)}
+		ast.Walk(v, e)
+		ids := []*ast.Ident{}
+		ast.Inspect(e, func(n ast.Node) bool {
+			if id, ok := n.(*ast.Ident); ok && !v.selectors[id] && !v.members[id] {
+				ids = append(ids, id)
+			}
+			return true
+		})
+		text := p.Default
+		for i := len(ids) - 1; i >= 0; i-- {
+			id := ids[i]
+			if _, ok := declaredInTable(pack.Symbols, id.Name, nil); ok {
+				if !ast.IsExported(id.Name) {
+					return nil, changeSignatureError("default argument " + p.Default + " refers to unexported " + id.Name + " and can't be used in the call at " + pos)
+				}
+				name, imported := importName(c.pack, c.filename, pack)
+				if !imported {
+					return nil, changeSignatureError("default argument " + p.Default + " refers to " + id.Name + ", but package " + pack.AstPackage.Name + " isn't imported in the file of the call at " + pos)
+				}
+				offs := fset.Position(id.Pos()).Offset
+				text = text[:offs] + qualify(name, "") + text[offs:]
+				continue
+			}
+			for _, ps := range getFileImports(pack, declFile) {
+				if ps.Name() != id.Name {
+					continue
+				}
+				name, imported := importName(c.pack, c.filename, ps.Package)
+				if !imported || name == "." {
+					return nil, changeSignatureError("default argument " + p.Default + " refers to package " + id.Name + ", that isn't imported in the file of the call at " + pos)
+				}
+				offs := fset.Position(id.Pos()).Offset
+				text = text[:offs] + name + text[offs+len(id.Name):]
+				break
+			}
+		}
+		res[p] = text
+	}
+	return res, nil
+}
+
+// argument list of the call for the new signature
+func getNewArguments(programTree *program.Program, pack *st.Package, filename string, content []byte, call *ast.CallExpr, old []*oldParam, params []*sigParam, defaults map[*sigParam]string, shift int, variadic bool) (string, *errors.GoRefactorError) {
+	fset := pack.FileSet
+	pos := fset.Position(call.Pos()).String()
+	args := call.Args[shift:]
+	if passesMultipleResults(programTree, pack, filename, args) {
+		return "", changeSignatureError("call at " + pos + " passes results of a function call as arguments")
+	}
+	if len(args) < len(old) && !(variadic && len(args) == len(old)-1) || len(args) > len(old) && !variadic {
+		return "", changeSignatureError("unexpected number of arguments in the call at " + pos)
+	}
+	argText := func(i int) string {
+		if variadic && i == len(old)-1 {
+			if i >= len(args) {
+				return ""
+			}
+			end := args[len(args)-1].End()
+			if call.Ellipsis != token.NoPos {
+				end = call.Ellipsis + 3
+			}
+			return string(content[fset.Position(args[i].Pos()).Offset:fset.Position(end).Offset])
+		}
+		return nodeText(fset, content, args[i])
+	}
+	hasEffects := func(i int) bool {
+		if variadic && i == len(old)-1 {
+			for _, a := range args[i:] {
+				if hasSideEffects(programTree.IdentMap, a) {
+					return true
+				}
+			}
+			return false
+		}
+		return hasSideEffects(programTree.IdentMap, args[i])
+	}
+
+	res := []string{}
+	for i := 0; i < shift; i++ {
+		res = append(res, nodeText(fset, content, call.Args[i]))
+	}
+	used := make(map[int]bool)
+	last := -1
+	for _, p := range params {
+		if p.Old == -1 {
+			res = append(res, defaults[p])
+			continue
+		}
+		used[p.Old] = true
+		if hasEffects(p.Old) {
+			if p.Old < last {
+				return "", changeSignatureError("reordering would change evaluation order of arguments with side effects in the call at " + pos)
+			}
+			last = p.Old
+		}
+		if t := argText(p.Old); t != "" {
+			res = append(res, t)
+		}
+	}
+	for i, _ := range old {
+		if _, ok := used[i]; !ok && (i < len(args) || !variadic) && hasEffects(i) {
+			return "", changeSignatureError("removed argument has side effects in the call at " + pos)
+		}
+	}
+	return strings.Join(res, ", "), nil
+}
@@ -8,6 +8,12 @@ import (
 	"refactoring/errors"
 	"unicode"
 	"refactoring/program"
+	"refactoring/packageParser"
+	"go/printer"
+	"go/parser"
+	"bytes"
+	"io/ioutil"
+	"sort"
 
 	"fmt"
 )
@@ -19,6 +25,18 @@ const (
 	EXTRACT_INTERFACE          = "exi"
 	IMPLEMENT_INTERFACE        = "imi"
 	SORT                       = "sort"
+	RENAME_PACKAGE             = "renpkg"
+	MOVE_TO_FILE               = "mvf"
+	MOVE_TO_PACKAGE            = "mvp"
+	EXTRACT_VARIABLE           = "exv"
+	INLINE_VARIABLE            = "inv"
+	EXTRACT_CONSTANT           = "exc"
+	CHANGE_SIGNATURE           = "sig"
+	INTRODUCE_PARAMETER        = "inp"
+	TO_METHOD                  = "tomethod"
+	TO_FUNCTION                = "tofunc"
+	SWITCH_RECIEVER            = "recv"
+	EXTRACT_FUNCTION           = "exf"
 )
 
 // get parameters
@@ -618,6 +636,315 @@ func setStmtList(node ast.Node, stmtList []ast.Stmt) {
 	}
 }
 
+// constant expressions
+
+// true if expression consists of constants, literals and operators only
+func isConstantExpr(pv *pureExprVisitor, e ast.Expr) bool {
+	switch t := e.(type) {
+	case *ast.BasicLit:
+		return true
+	case *ast.Ident:
+		sym := pv.programTree.IdentMap[t]
+		return sym != nil && pv.isConst(sym)
+	case *ast.ParenExpr:
+		return isConstantExpr(pv, t.X)
+	case *ast.UnaryExpr:
+		return isConstantExpr(pv, t.X)
+	case *ast.BinaryExpr:
+		return isConstantExpr(pv, t.X) && isConstantExpr(pv, t.Y)
+	}
+	return false
+}
+
+// default type of untyped constant
+func getDefaultType(programTree *program.Program, pack *st.Package, filename string, e ast.Expr) st.ITypeSymbol {
+	if lit, ok := e.(*ast.BasicLit); ok {
+		switch lit.Kind {
+		case token.INT, token.CHAR:
+			return st.PredeclaredTypes["int"]
+		case token.FLOAT:
+			return st.PredeclaredTypes["float64"]
+		case token.IMAG:
+			return st.PredeclaredTypes["complex128"]
+		case token.STRING:
+			return st.PredeclaredTypes["string"]
+		}
+	}
+	return packageParser.ParseExpr(e, pack, filename, programTree.IdentMap)
+}
+
+func nthSymbol(table *st.SymbolTable, n int) st.Symbol {
+	var res st.Symbol
+	i := 0
+	table.ForEachNoLock(func(sym st.Symbol) {
+		if i == n {
+			res = sym
+		}
+		i++
+	})
+	return res
+}
+
+func functionTypeOf(sym st.Symbol) *st.FunctionTypeSymbol {
+	f, ok := sym.(*st.FunctionSymbol)
+	if !ok || f.FunctionType == nil {
+		return nil
+	}
+	bt, _ := st.GetBaseType(f.FunctionType)
+	ft, _ := bt.(*st.FunctionTypeSymbol)
+	return ft
+}
+
+func variableType(sym st.Symbol) st.ITypeSymbol {
+	if v, ok := sym.(*st.VariableSymbol); ok {
+		return v.VariableType
+	}
+	return nil
+}
+
+// type, that the constant expression at the end of path gets from it's context; nil if context doesn't define it
+func getUseType(programTree *program.Program, pack *st.Package, filename string, pv *pureExprVisitor, path []ast.Node) st.ITypeSymbol {
+	identMap := programTree.IdentMap
+	child := path[len(path)-1]
+	parse := func(e ast.Expr) st.ITypeSymbol {
+		return packageParser.ParseExpr(e, pack, filename, identMap)
+	}
+	switch p := path[len(path)-2].(type) {
+	case *ast.ParenExpr, *ast.UnaryExpr:
+		return getUseType(programTree, pack, filename, pv, path[:len(path)-1])
+	case *ast.BinaryExpr:
+		switch p.Op {
+		case token.SHL, token.SHR:
+			if ast.Node(p.X) == child {
+				return getUseType(programTree, pack, filename, pv, path[:len(path)-1])
+			}
+			return nil
+		case token.LAND, token.LOR:
+			return nil
+		}
+		other := p.X
+		if ast.Node(other) == child {
+			other = p.Y
+		}
+		if !isConstantExpr(pv, other) {
+			return parse(other)
+		}
+		switch p.Op {
+		case token.EQL, token.NEQ, token.LSS, token.LEQ, token.GTR, token.GEQ:
+			return nil
+		}
+		return getUseType(programTree, pack, filename, pv, path[:len(path)-1])
+	case *ast.AssignStmt:
+		if p.Tok == token.DEFINE || len(p.Lhs) != len(p.Rhs) {
+			return nil
+		}
+		for i, r := range p.Rhs {
+			if ast.Node(r) == child {
+				return parse(p.Lhs[i])
+			}
+		}
+	case *ast.ValueSpec:
+		if p.Type != nil {
+			return parse(p.Type)
+		}
+	case *ast.CallExpr:
+		if isTypeExpr(identMap, p.Fun) {
+			return nil
+		}
+		var ft *st.FunctionTypeSymbol
+		switch f := p.Fun.(type) {
+		case *ast.Ident:
+			ft = functionTypeOf(identMap[f])
+		case *ast.SelectorExpr:
+			ft = functionTypeOf(identMap[f.Sel])
+		}
+		if ft == nil || p.Ellipsis != token.NoPos {
+			return nil
+		}
+		for i, arg := range p.Args {
+			if ast.Node(arg) != child {
+				continue
+			}
+			if i >= ft.Parameters.Count() {
+				i = ft.Parameters.Count() - 1
+			}
+			if i < 0 {
+				return nil
+			}
+			t := variableType(nthSymbol(ft.Parameters, i))
+			if at, ok := t.(*st.ArrayTypeSymbol); ok && at.Len == st.ELLIPSIS {
+				return at.ElemType
+			}
+			return t
+		}
+	case *ast.ReturnStmt:
+		for j := len(path) - 3; j >= 0; j-- {
+			switch f := path[j].(type) {
+			case *ast.FuncLit:
+				return nil
+			case *ast.FuncDecl:
+				ft := functionTypeOf(identMap[f.Name])
+				if ft == nil || ft.Results.Count() != len(p.Results) {
+					return nil
+				}
+				for i, r := range p.Results {
+					if ast.Node(r) == child {
+						return variableType(nthSymbol(ft.Results, i))
+					}
+				}
+				return nil
+			}
+		}
+	case *ast.KeyValueExpr:
+		if id, ok := p.Key.(*ast.Ident); ok && ast.Node(p.Value) == child {
+			return variableType(identMap[id])
+		}
+	case *ast.SendStmt:
+		if ast.Node(p.Value) == child {
+			if ct, ok := parse(p.Chan).(*st.ChanTypeSymbol); ok {
+				return ct.ValueType
+			}
+		}
+	}
+	return nil
+}
+
+// name of the type in the file, if a constant can be declared with it
+func constTypeName(pack *st.Package, filename string, t st.ITypeSymbol) (string, bool) {
+	if t == nil {
+		return "", false
+	}
+	if bt, _ := st.GetBaseType(t); bt == nil {
+		return "", false
+	} else if _, ok := bt.(*st.BasicTypeSymbol); !ok {
+		return "", false
+	}
+	return typeName(pack, filename, t)
+}
+
+// name of the type in the file; false if type is unknown or it's package isn't imported
+func typeName(pack *st.Package, filename string, t st.ITypeSymbol) (string, bool) {
+	if t == nil {
+		return "", false
+	}
+	if p := t.PackageFrom(); p != nil && p != pack {
+		if pack.Imports[filename] == nil || pack.GetImport(filename, p) == nil {
+			return "", false
+		}
+	}
+	b := new(bytes.Buffer)
+	printer.Fprint(b, token.NewFileSet(), t.ToAstExpr(pack, filename))
+	return b.String(), true
+}
+
+// true if the only argument of a call is a call of a function, that returns more than one value
+func passesMultipleResults(programTree *program.Program, pack *st.Package, filename string, args []ast.Expr) bool {
+	if len(args) != 1 {
+		return false
+	}
+	call, ok := args[0].(*ast.CallExpr)
+	if !ok {
+		return false
+	}
+	t, _ := st.GetBaseType(packageParser.ParseExpr(call.Fun, pack, filename, programTree.IdentMap))
+	ft, ok := t.(*st.FunctionTypeSymbol)
+	return ok && ft.Results != nil && ft.Results.Count() > 1
+}
+
+// textual edits
+
+// textual replacement of a part of a file; offsets are taken from the parsed source
+type fileEdit struct {
+	Start, End int
+	Text       string
+}
+
+type fileEditCollection []*fileEdit
+
+func (fc fileEditCollection) Len() int {
+	return len(fc)
+}
+
+// edits are applied from the end of file, so that offsets of others stay valid;
+// insertion is applied after a replacement, that starts at the same offset
+func (fc fileEditCollection) Less(i, j int) bool {
+	return fc[i].Start > fc[j].Start || fc[i].Start == fc[j].Start && fc[i].End > fc[j].End
+}
+
+func (fc fileEditCollection) Swap(i, j int) {
+	fc[i], fc[j] = fc[j], fc[i]
+}
+
+// applies edits to files, checks that results can be parsed and saves them
+func applyFileEdits(programTree *program.Program, edits map[string][]*fileEdit) *errors.GoRefactorError {
+	fsets := make(map[string]*token.FileSet)
+	files := make(map[string]*ast.File)
+	for f, es := range edits {
+		content, err := ioutil.ReadFile(f)
+		if err != nil {
+			return &errors.GoRefactorError{ErrorType: "refactoring error", Message: "couldn't read file " + f + ": " + err.String()}
+		}
+		text := string(content)
+		sort.Sort(fileEditCollection(es))
+		for _, e := range es {
+			text = text[:e.Start] + e.Text + text[e.End:]
+		}
+		fsets[f] = token.NewFileSet()
+		if files[f], err = parser.ParseFile(fsets[f], f, text, parser.ParseComments); err != nil {
+			return &errors.GoRefactorError{ErrorType: "refactoring error (critical)", Message: "result of the refactoring in " + f + " can't be parsed: " + err.String()}
+		}
+	}
+	for f, file := range files {
+		programTree.SaveFileExplicit(f, fsets[f], file)
+	}
+	return nil
+}
+
+// contents of source files, read once for all edits of the refactoring
+type fileContents map[string][]byte
+
+func (fc fileContents) read(f string) ([]byte, *errors.GoRefactorError) {
+	if c, ok := fc[f]; ok {
+		return c, nil
+	}
+	c, err := ioutil.ReadFile(f)
+	if err != nil {
+		return nil, &errors.GoRefactorError{ErrorType: "refactoring error", Message: "couldn't read file " + f + ": " + err.String()}
+	}
+	fc[f] = c
+	return c, nil
+}
+
+// checks arguments, that point to an entity in a go file
+func checkPositionParameters(filename string, line int, column int) *errors.GoRefactorError {
+	switch {
+	case filename == "" || !utils.IsGoFile(filename):
+		return errors.ArgumentError("filename", "It's not a valid go file name")
+	case line < 1:
+		return errors.ArgumentError("line", "Must be > 1")
+	case column < 1:
+		return errors.ArgumentError("column", "Must be > 1")
+	}
+	return nil
+}
+
+// checks arguments, that point to a range in a go file
+func checkRangeParameters(filename string, lineStart int, colStart int, lineEnd int, colEnd int) *errors.GoRefactorError {
+	switch {
+	case filename == "" || !utils.IsGoFile(filename):
+		return errors.ArgumentError("filename", "It's not a valid go file name")
+	case lineStart < 1:
+		return errors.ArgumentError("lineStart", "Must be > 1")
+	case lineEnd < 1 || lineEnd < lineStart:
+		return errors.ArgumentError("lineEnd", "Must be > 1 and >= lineStart")
+	case colStart < 1:
+		return errors.ArgumentError("colStart", "Must be > 1")
+	case colEnd < 1:
+		return errors.ArgumentError("colEnd", "Must be > 1")
+	}
+	return nil
+}
+
 // is go ident
 
 func IsGoIdent(name string) bool {
@@ -0,0 +1,524 @@
+package refactoring
+
+import (
+	"refactoring/st"
+	"refactoring/errors"
+	"refactoring/program"
+	"refactoring/packageParser"
+	"go/ast"
+	"go/token"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+func convertFunctionError(message string) *errors.GoRefactorError {
+	return &errors.GoRefactorError{ErrorType: "convert function error", Message: message}
+}
+
+// calls, sorted so that inner calls go first
+type callSiteCollection []*callSite
+
+func (cc callSiteCollection) Len() int {
+	return len(cc)
+}
+func (cc callSiteCollection) Less(i, j int) bool {
+	return cc[i].call.End()-cc[i].call.Pos() < cc[j].call.End()-cc[j].call.Pos()
+}
+func (cc callSiteCollection) Swap(i, j int) {
+	cc[i], cc[j] = cc[j], cc[i]
+}
+
+// text of [start,end) of content with edits, that lie within it, applied;
+// these edits are removed from the list, because the range is going to be replaced
+func takeRangeText(content []byte, start int, end int, edits *[]*fileEdit) string {
+	text := applyEditsInRange(content, start, end, *edits)
+	rest := []*fileEdit{}
+	for _, e := range *edits {
+		if e.Start < start || e.End > end {
+			rest = append(rest, e)
+		}
+	}
+	*edits = rest
+	return text
+}
+
+// true if expression must be parenthesized, when used as an operand of selector in place of the call at the end of path
+func needsParensAsOperand(x ast.Expr, path []ast.Node) bool {
+	switch x.(type) {
+	case *ast.BinaryExpr, *ast.UnaryExpr, *ast.StarExpr, *ast.FuncLit:
+		return true
+	}
+	hasLit := false
+	ast.Walk(&compositeLitVisitor{&hasLit}, x)
+	if !hasLit {
+		return false
+	}
+	for j := len(path) - 2; j >= 0; j-- {
+		switch path[j].(type) {
+		case *ast.BlockStmt, *ast.FuncLit, *ast.CompositeLit, *ast.ParenExpr, *ast.CallExpr, *ast.IndexExpr:
+			return false
+		case *ast.IfStmt, *ast.ForStmt, *ast.RangeStmt, *ast.SwitchStmt, *ast.TypeSwitchStmt:
+			return true
+		}
+	}
+	return false
+}
+
+func prefixed(prefix string, x ast.Expr, text string) string {
+	switch x.(type) {
+	case *ast.BinaryExpr, *ast.UnaryExpr, *ast.StarExpr:
+		text = "(" + text + ")"
+	}
+	return prefix + text
+}
+
+func CheckConvertFunctionParameters(filename string, line int, column int) (bool, *errors.GoRefactorError) {
+	if err := checkPositionParameters(filename, line, column); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Turns function, pointed by position, into a method of the type of parameter with index paramIndex (from 0);
+// the parameter becomes the reciever and the declaration is moved next to the type's methods.
+func ConvertToMethod(filename string, line int, column int, paramIndex int) (bool, *errors.GoRefactorError) {
+	if ok, err := CheckConvertFunctionParameters(filename, line, column); !ok {
+		return false, err
+	}
+	if paramIndex < 0 {
+		return false, errors.ArgumentError("paramIndex", "Must be >= 0")
+	}
+	programTree := parseProgram(filename)
+	edits, err := convertToMethod(programTree, filename, line, column, paramIndex)
+	if err != nil {
+		return false, err
+	}
+	if err := applyFileEdits(programTree, edits); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Turns method, pointed by position, into a function; the reciever becomes the first parameter.
+func ConvertToFunction(filename string, line int, column int) (bool, *errors.GoRefactorError) {
+	if ok, err := CheckConvertFunctionParameters(filename, line, column); !ok {
+		return false, err
+	}
+	programTree := parseProgram(filename)
+	edits, err := convertToFunction(programTree, filename, line, column)
+	if err != nil {
+		return false, err
+	}
+	if err := applyFileEdits(programTree, edits); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// function or method at position and it's declaration
+func getConvertedFunction(programTree *program.Program, filename string, line int, column int) (*st.FunctionSymbol, *ast.FuncDecl, string, *errors.GoRefactorError) {
+	sym, err := programTree.FindSymbolByPosition(filename, line, column)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	fsym, ok := sym.(*st.FunctionSymbol)
+	if !ok {
+		return nil, nil, "", convertFunctionError(sym.Name() + " is not a function")
+	}
+	pack := fsym.PackageFrom()
+	if pack == nil || pack.IsGoPackage {
+		return nil, nil, "", convertFunctionError("function " + sym.Name() + " doesn't belong to the program")
+	}
+	if fsym.IsInterfaceMethod {
+		return nil, nil, "", convertFunctionError(sym.Name() + " is an interface method")
+	}
+	decl, declFile, err := getDeclarationInFile(programTree, pack, fsym)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	return fsym, decl, declFile, nil
+}
+
+// text of the parameter list without parameter with index skip
+func paramsText(fset *token.FileSet, content []byte, params []*oldParam, skip int, named bool) string {
+	list := []string{}
+	for i, p := range params {
+		switch {
+		case i == skip:
+		case p.Name != nil:
+			list = append(list, p.Name.Name+" "+nodeText(fset, content, p.Type))
+		case named:
+			list = append(list, "_ "+nodeText(fset, content, p.Type))
+		default:
+			list = append(list, nodeText(fset, content, p.Type))
+		}
+	}
+	return strings.Join(list, ", ")
+}
+
+func convertToMethod(programTree *program.Program, filename string, line int, column int, paramIndex int) (map[string][]*fileEdit, *errors.GoRefactorError) {
+	fsym, decl, declFile, err := getConvertedFunction(programTree, filename, line, column)
+	if err != nil {
+		return nil, err
+	}
+	if decl.Recv != nil {
+		return nil, convertFunctionError(fsym.Name() + " is already a method")
+	}
+	pack := fsym.PackageFrom()
+	fset := pack.FileSet
+	identMap := programTree.IdentMap
+	old := getOldParams(decl.Type)
+	if paramIndex >= len(old) {
+		return nil, errors.ArgumentError("paramIndex", "function has "+strconv.Itoa(len(old))+" parameters")
+	}
+	param := old[paramIndex]
+	if param.Variadic {
+		return nil, convertFunctionError("variadic parameter can't become a reciever")
+	}
+	typeExpr, isPointer := param.Type, false
+	if star, ok := typeExpr.(*ast.StarExpr); ok {
+		typeExpr, isPointer = star.X, true
+	}
+	typeId, ok := typeExpr.(*ast.Ident)
+	if !ok {
+		return nil, convertFunctionError("type of the parameter must be a named type of package " + pack.AstPackage.Name + " or a pointer to it")
+	}
+	t, ok := identMap[typeId].(st.ITypeSymbol)
+	if !ok || isPackageSymbol(t) || t.PackageFrom() != pack {
+		return nil, convertFunctionError("methods can be declared only for named types of package " + pack.AstPackage.Name)
+	}
+	switch bt, _ := st.GetBaseType(t); b := bt.(type) {
+	case *st.PointerTypeSymbol, *st.InterfaceTypeSymbol:
+		return nil, convertFunctionError("methods can't be declared for pointer and interface types")
+	case *st.StructTypeSymbol:
+		if b.Fields != nil {
+			if _, found := b.Fields.LookUp(fsym.Name(), ""); found {
+				return nil, convertFunctionError("type " + t.Name() + " already has a field " + fsym.Name())
+			}
+		}
+	}
+	if _, found := lookUpMethod(t, fsym.Name()); found {
+		return nil, convertFunctionError("type " + t.Name() + " already has a method " + fsym.Name())
+	}
+
+	calls, values := getCallSites(programTree, fsym, decl)
+	if paramIndex != 0 && len(values) > 0 {
+		return nil, convertFunctionError("function is used as a value, method expression would have another type:" + sitePositions(values))
+	}
+
+	contents := make(fileContents)
+	edits := make(map[string][]*fileEdit)
+
+	sort.Sort(callSiteCollection(calls))
+	for _, c := range calls {
+		cfset := c.pack.FileSet
+		offset := func(pos token.Pos) int {
+			return cfset.Position(pos).Offset
+		}
+		pos := cfset.Position(c.call.Pos()).String()
+		args := c.call.Args
+		if passesMultipleResults(programTree, c.pack, c.filename, args) {
+			return nil, convertFunctionError("call at " + pos + " passes results of a function call as arguments")
+		}
+		if len(args) <= paramIndex {
+			return nil, convertFunctionError("unexpected number of arguments in the call at " + pos)
+		}
+		x := args[paramIndex]
+		rv := &readsVariablesVisitor{identMap, false}
+		ast.Walk(rv, x)
+		for _, a := range args[:paramIndex] {
+			if hasSideEffects(identMap, a) && (rv.found || hasSideEffects(identMap, x)) {
+				return nil, convertFunctionError("reciever would be evaluated before arguments with side effects in the call at " + pos)
+			}
+		}
+		cc, err := contents.read(c.filename)
+		if err != nil {
+			return nil, err
+		}
+		fe := edits[c.filename]
+		// &v.f() and (*p).f() are written as v.f() and p.f()
+		recv := x
+		switch u := x.(type) {
+		case *ast.UnaryExpr:
+			if _, ok := u.X.(*ast.CompositeLit); isPointer && u.Op == token.AND && !ok {
+				recv = u.X
+			}
+		case *ast.StarExpr:
+			if !isPointer {
+				recv = u.X
+			}
+		}
+		text := takeRangeText(cc, offset(recv.Pos()), offset(recv.End()), &fe)
+		if needsParensAsOperand(recv, c.path) {
+			text = "(" + text + ")"
+		}
+		switch {
+		case len(args) == 1:
+			fe = append(fe, &fileEdit{offset(x.Pos()), offset(x.End()), ""})
+		case paramIndex < len(args)-1:
+			fe = append(fe, &fileEdit{offset(x.Pos()), offset(args[paramIndex+1].Pos()), ""})
+		default:
+			fe = append(fe, &fileEdit{offset(args[paramIndex-1].End()), offset(x.End()), ""})
+		}
+		fe = append(fe, &fileEdit{offset(c.call.Fun.Pos()), offset(c.call.Fun.End()), text + "." + fsym.Name()})
+		edits[c.filename] = fe
+	}
+	for _, v := range values {
+		e := v.path[len(v.path)-1]
+		typeName := t.Name()
+		if sel, ok := e.(*ast.SelectorExpr); ok {
+			if !isExportedName(t.Name()) {
+				return nil, convertFunctionError("type " + t.Name() + " isn't exported, method expression can't be used at " + v.pack.FileSet.Position(e.Pos()).String())
+			}
+			typeName = sel.X.(*ast.Ident).Name + "." + typeName
+		}
+		if isPointer {
+			typeName = "(*" + typeName + ")"
+		}
+		offs := v.pack.FileSet.Position(e.Pos()).Offset
+		edits[v.filename] = append(edits[v.filename], &fileEdit{offs, v.pack.FileSet.Position(e.End()).Offset, typeName + "." + fsym.Name()})
+	}
+
+	// new header
+	dc, err := contents.read(declFile)
+	if err != nil {
+		return nil, err
+	}
+	recvText := nodeText(fset, dc, param.Type)
+	if param.Name != nil {
+		recvText = param.Name.Name + " " + recvText
+	}
+	header := "func (" + recvText + ") " + fsym.Name() + "(" + paramsText(fset, dc, old, paramIndex, false) + ")"
+	edits[declFile] = append(edits[declFile], &fileEdit{fset.Position(decl.Pos()).Offset, fset.Position(decl.Type.Params.Closing).Offset + 1, header})
+
+	// declaration is moved after the last method of the type in the file, where type is declared
+	typeDecl, typeFile, err := getTopLevelDecl(programTree, pack, t)
+	if err != nil {
+		return nil, err
+	}
+	var after ast.Decl = typeDecl
+	for _, d := range getTypeMethodDecls(programTree, pack, t)[typeFile] {
+		if d.Pos() > after.Pos() {
+			after = d
+		}
+	}
+	_, declAst := programTree.FindPackageAndFileByFilename(declFile)
+	_, typeAst := programTree.FindPackageAndFileByFilename(typeFile)
+	tc, err := contents.read(typeFile)
+	if err != nil {
+		return nil, err
+	}
+	_, target := getDeclRange(fset, typeAst, tc, after)
+	start, end := getDeclRange(fset, declAst, dc, decl)
+	if typeFile == declFile {
+		if target == start {
+			return edits, nil
+		}
+		fe := edits[declFile]
+		text := takeRangeText(dc, start, end, &fe)
+		edits[declFile] = append(fe, &fileEdit{start, end, ""}, &fileEdit{target, target, "\n" + text})
+		return edits, nil
+	}
+	moved := map[string][]ast.Decl{declFile: []ast.Decl{decl}}
+	importsText, err := getImportsToAdd(programTree, pack, moved, pack, typeFile)
+	if err != nil {
+		return nil, err
+	}
+	inner := make(map[string][]*fileEdit)
+	fe := edits[declFile]
+	takeRangeText(dc, start, end, &fe)
+	for _, e := range edits[declFile] {
+		if e.Start >= start && e.End <= end {
+			inner[declFile] = append(inner[declFile], e)
+		}
+	}
+	edits[declFile] = fe
+	text, err := getRemoveDeclsEdits(programTree, pack, moved, inner, edits)
+	if err != nil {
+		return nil, err
+	}
+	if importsText != "" {
+		offs := fset.Position(typeAst.Name.End()).Offset
+		edits[typeFile] = append(edits[typeFile], &fileEdit{offs, offs, "\n\n" + importsText})
+	}
+	edits[typeFile] = append(edits[typeFile], &fileEdit{target, target, text})
+	return edits, nil
+}
+
+func convertToFunction(programTree *program.Program, filename string, line int, column int) (map[string][]*fileEdit, *errors.GoRefactorError) {
+	fsym, decl, declFile, err := getConvertedFunction(programTree, filename, line, column)
+	if err != nil {
+		return nil, err
+	}
+	if decl.Recv == nil || len(decl.Recv.List) == 0 {
+		return nil, convertFunctionError(fsym.Name() + " is not a method")
+	}
+	if s := getImplementedInterfaces(programTree, fsym); s != "" {
+		return nil, convertFunctionError("method " + fsym.Name() + " implements an interface method:" + s)
+	}
+	pack := fsym.PackageFrom()
+	fset := pack.FileSet
+	identMap := programTree.IdentMap
+	name := fsym.Name()
+	if _, found := pack.Symbols.LookUp(name, ""); found {
+		return nil, convertFunctionError("package " + pack.AstPackage.Name + " already contains a symbol with name " + name)
+	}
+	for f, _ := range pack.AstPackage.Files {
+		for _, ps := range getFileImports(pack, f) {
+			if ps.Name() == name {
+				return nil, convertFunctionError("name " + name + " refers to an imported package in " + f)
+			}
+		}
+	}
+	recvField := decl.Recv.List[0]
+	recvType, isPointer := recvField.Type, false
+	if star, ok := recvType.(*ast.StarExpr); ok {
+		recvType, isPointer = star.X, true
+	}
+	t, _ := identMap[recvType.(*ast.Ident)].(st.ITypeSymbol)
+
+	calls, values := getCallSites(programTree, fsym, decl)
+	for _, v := range values {
+		sel, ok := v.path[len(v.path)-1].(*ast.SelectorExpr)
+		if !ok || v.shift == 0 {
+			return nil, convertFunctionError("method value at " + v.pack.FileSet.Position(v.fun.Pos()).String() + " can't be replaced with a function")
+		}
+		if _, isStar := unparen(sel.X).(*ast.StarExpr); isStar != isPointer {
+			return nil, convertFunctionError("method expression at " + v.pack.FileSet.Position(v.fun.Pos()).String() + " has type, that differs from the function's one")
+		}
+	}
+
+	contents := make(fileContents)
+	edits := make(map[string][]*fileEdit)
+	addedImports := make(map[string]bool)
+
+	// name of the function at the reference
+	funcName := func(c *callSite) (string, *errors.GoRefactorError) {
+		pos := c.pack.FileSet.Position(c.fun.Pos()).String()
+		if scope, ok := c.pack.IdentScopes[c.fun]; ok {
+			if _, found := scope.LookUp(name, c.filename); found {
+				return "", convertFunctionError("name " + name + " denotes another entity at " + pos)
+			}
+		}
+		if c.pack == pack {
+			return name, nil
+		}
+		if c.pack.Imports[c.filename] != nil {
+			if imp := c.pack.GetImport(c.filename, pack); imp != nil {
+				return qualify(imp.Name(), name), nil
+			}
+		}
+		pname := pack.AstPackage.Name
+		if scope, ok := c.pack.IdentScopes[c.fun]; ok {
+			if _, found := scope.LookUp(pname, c.filename); found {
+				return "", convertFunctionError("package " + pname + " can't be imported in " + c.filename + ", name " + pname + " is used at " + pos)
+			}
+		}
+		if _, ok := addedImports[c.filename]; !ok {
+			addedImports[c.filename] = true
+			_, file := programTree.FindPackageAndFileByFilename(c.filename)
+			offs := c.pack.FileSet.Position(file.Name.End()).Offset
+			edits[c.filename] = append(edits[c.filename], &fileEdit{offs, offs, "\n\n" + importSpecText(pname, pack, true)})
+		}
+		return pname + "." + name, nil
+	}
+
+	sort.Sort(callSiteCollection(calls))
+	for _, c := range calls {
+		cfset := c.pack.FileSet
+		offset := func(pos token.Pos) int {
+			return cfset.Position(pos).Offset
+		}
+		pos := cfset.Position(c.call.Pos()).String()
+		cc, err := contents.read(c.filename)
+		if err != nil {
+			return nil, err
+		}
+		fn, err := funcName(c)
+		if err != nil {
+			return nil, err
+		}
+		fe := edits[c.filename]
+		sel := c.call.Fun.(*ast.SelectorExpr)
+		if c.shift == 1 {
+			// method expression: T.M(x, ...) -> M(x, ...)
+			if _, isStar := unparen(sel.X).(*ast.StarExpr); isStar && !isPointer {
+				x := c.call.Args[0]
+				text := takeRangeText(cc, offset(x.Pos()), offset(x.End()), &fe)
+				fe = append(fe, &fileEdit{offset(x.Pos()), offset(x.End()), prefixed("*", x, text)})
+			}
+			fe = append(fe, &fileEdit{offset(sel.Pos()), offset(sel.End()), fn})
+			edits[c.filename] = fe
+			continue
+		}
+		x := sel.X
+		xt := packageParser.ParseExpr(x, c.pack, c.filename, identMap)
+		xp, xIsPointer := xt.(*st.PointerTypeSymbol)
+		if xIsPointer {
+			xt = xp.BaseType
+		}
+		if t != nil && xt != nil && xt != t {
+			return nil, convertFunctionError("method is called through an embedded field at " + pos)
+		}
+		text := takeRangeText(cc, offset(x.Pos()), offset(x.End()), &fe)
+		if p, ok := x.(*ast.ParenExpr); ok {
+			if _, ok := p.X.(*ast.StarExpr); ok && isPointer {
+				x, text = p.X, nodeText(cfset, cc, p.X)
+			}
+		}
+		switch {
+		case isPointer && !xIsPointer:
+			if star, ok := x.(*ast.StarExpr); ok {
+				text = nodeText(cfset, cc, star.X)
+			} else {
+				text = prefixed("&", x, text)
+			}
+		case !isPointer && xIsPointer:
+			text = prefixed("*", x, text)
+		}
+		if len(c.call.Args) > 0 {
+			text += ", "
+		}
+		fe = append(fe, &fileEdit{offset(sel.Pos()), offset(sel.End()), fn})
+		fe = append(fe, &fileEdit{offset(c.call.Lparen) + 1, offset(c.call.Lparen) + 1, text})
+		edits[c.filename] = fe
+	}
+	for _, v := range values {
+		fn, err := funcName(v)
+		if err != nil {
+			return nil, err
+		}
+		e := v.path[len(v.path)-1]
+		offs := v.pack.FileSet.Position(e.Pos()).Offset
+		edits[v.filename] = append(edits[v.filename], &fileEdit{offs, v.pack.FileSet.Position(e.End()).Offset, fn})
+	}
+
+	dc, err := contents.read(declFile)
+	if err != nil {
+		return nil, err
+	}
+	recvName := "_"
+	if len(recvField.Names) > 0 {
+		recvName = recvField.Names[0].Name
+	}
+	old := getOldParams(decl.Type)
+	params := recvName + " " + nodeText(fset, dc, recvField.Type)
+	if len(old) > 0 {
+		params += ", " + paramsText(fset, dc, old, -1, true)
+	}
+	header := "func " + name + "(" + params + ")"
+	edits[declFile] = append(edits[declFile], &fileEdit{fset.Position(decl.Pos()).Offset, fset.Position(decl.Type.Params.Closing).Offset + 1, header})
+	return edits, nil
+}
+
+func unparen(e ast.Expr) ast.Expr {
+	for {
+		p, ok := e.(*ast.ParenExpr)
+		if !ok {
+			return e
+		}
+		e = p.X
+	}
+	panic("unreachable")
+}
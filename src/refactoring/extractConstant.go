@@ -0,0 +1,321 @@
+package refactoring
+
+import (
+	"refactoring/st"
+	"refactoring/utils"
+	"refactoring/errors"
+	"refactoring/program"
+	"go/ast"
+	"go/token"
+	"io/ioutil"
+	"strconv"
+)
+
+// finds the path to the innermost expression, that starts at given position
+type startPathVisitor struct {
+	fset   *token.FileSet
+	pos    token.Position
+	path   []ast.Node
+	result *[]ast.Node
+}
+
+func (v *startPathVisitor) Visit(node ast.Node) ast.Visitor {
+	if node == nil {
+		return nil
+	}
+	if utils.ComparePosWithinFile(v.fset.Position(node.Pos()), v.pos) > 0 || utils.ComparePosWithinFile(v.fset.Position(node.End()), v.pos) <= 0 {
+		return nil
+	}
+	path := appendToPath(v.path, node)
+	if _, ok := node.(ast.Expr); ok && utils.ComparePosWithinFile(v.fset.Position(node.Pos()), v.pos) == 0 {
+		*v.result = path
+	}
+	return &startPathVisitor{v.fset, v.pos, path, v.result}
+}
+
+// finds literals and constant expressions, equal to the target; import paths and tags are skipped
+type equalConstVisitor struct {
+	identMap st.IdentifierMap
+	target   ast.Expr
+	path     []ast.Node
+	result   *[][]ast.Node
+}
+
+func (v *equalConstVisitor) Visit(node ast.Node) ast.Visitor {
+	if node == nil {
+		return nil
+	}
+	path := appendToPath(v.path, node)
+	switch t := node.(type) {
+	case *ast.ImportSpec:
+		return nil
+	case *ast.Field:
+		inner := &equalConstVisitor{v.identMap, v.target, path, v.result}
+		for _, id := range t.Names {
+			ast.Walk(inner, id)
+		}
+		ast.Walk(inner, t.Type)
+		return nil
+	case ast.Expr:
+		if equalConstants(v.identMap, v.target, t) {
+			*v.result = append(*v.result, path)
+			return nil
+		}
+	}
+	return &equalConstVisitor{v.identMap, v.target, path, v.result}
+}
+
+// literals are compared by value, so 0x10 is equal to 16
+func equalConstants(identMap st.IdentifierMap, a ast.Expr, b ast.Expr) bool {
+	x, ok1 := a.(*ast.BasicLit)
+	y, ok2 := b.(*ast.BasicLit)
+	if !ok1 || !ok2 {
+		return sameExpr(identMap, a, b)
+	}
+	if x.Kind != y.Kind {
+		return false
+	}
+	xv, yv := string(x.Value), string(y.Value)
+	switch x.Kind {
+	case token.INT:
+		xi, err1 := strconv.Btoui64(xv, 0)
+		yi, err2 := strconv.Btoui64(yv, 0)
+		if err1 == nil && err2 == nil {
+			return xi == yi
+		}
+	case token.FLOAT:
+		xf, err1 := strconv.Atof64(xv)
+		yf, err2 := strconv.Atof64(yv)
+		if err1 == nil && err2 == nil {
+			return xf == yf
+		}
+	case token.STRING, token.CHAR:
+		xs, err1 := strconv.Unquote(xv)
+		ys, err2 := strconv.Unquote(yv)
+		if err1 == nil && err2 == nil {
+			return xs == ys
+		}
+	}
+	return xv == yv
+}
+
+// identifiers with the name, that may be shadowed by or conflict with the new constant
+type nameUsesVisitor struct {
+	name      string
+	selectors map[*ast.Ident]bool
+	members   map[*ast.Ident]bool
+	found     *ast.Ident
+}
+
+func (v *nameUsesVisitor) Visit(node ast.Node) ast.Visitor {
+	if v.found != nil {
+		return nil
+	}
+	if id, ok := node.(*ast.Ident); ok && id.Name == v.name {
+		_, isSel := v.selectors[id]
+		_, isMember := v.members[id]
+		if !isSel && !isMember {
+			v.found = id
+		}
+	}
+	return v
+}
+
+func extractConstantError(message string) *errors.GoRefactorError {
+	return &errors.GoRefactorError{ErrorType: "extract constant error", Message: message}
+}
+
+func CheckExtractConstantParameters(filename string, line int, column int, constName string) (bool, *errors.GoRefactorError) {
+	if err := checkPositionParameters(filename, line, column); err != nil {
+		return false, err
+	}
+	if !IsGoIdent(constName) {
+		return false, errors.ArgumentError("constName", "It's not a valid go identifier")
+	}
+	return true, nil
+}
+
+// Extracts literal or constant expression, that starts at position, to a named constant.
+// The constant is declared at the beginning of the enclosing function; if replaceAll is set,
+// it's declared at package level and every equal literal in the package is replaced
+func ExtractConstant(filename string, line int, column int, constName string, replaceAll bool) (bool, *errors.GoRefactorError) {
+	if ok, err := CheckExtractConstantParameters(filename, line, column, constName); !ok {
+		return false, err
+	}
+	programTree := parseProgram(filename)
+	edits, err := extractConstant(programTree, filename, line, column, constName, replaceAll)
+	if err != nil {
+		return false, err
+	}
+	if err := applyFileEdits(programTree, edits); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func extractConstant(programTree *program.Program, filename string, line int, column int, constName string, replaceAll bool) (map[string][]*fileEdit, *errors.GoRefactorError) {
+	pack, file := programTree.FindPackageAndFileByFilename(filename)
+	if pack == nil {
+		return nil, errors.ArgumentError("filename", "Program packages don't contain file '"+filename+"'")
+	}
+	fset := pack.FileSet
+	identMap := programTree.IdentMap
+	pv := &pureExprVisitor{programTree, pack, filename, func(st.Symbol) bool { return false }, make(map[*st.Package]map[*ast.Ident]bool), make(map[st.Symbol]bool), true}
+
+	var path []ast.Node
+	ast.Walk(&startPathVisitor{fset, token.Position{filename, 0, line, column}, nil, &path}, file)
+	if path == nil || !isConstantExpr(pv, path[len(path)-1].(ast.Expr)) {
+		return nil, extractConstantError("there is no literal or constant expression at the position")
+	}
+	// the largest constant expression, that starts at the position
+	for len(path) > 2 {
+		parent, ok := path[len(path)-2].(ast.Expr)
+		if !ok || parent.Pos() != path[len(path)-1].Pos() || !isConstantExpr(pv, parent) {
+			break
+		}
+		path = path[:len(path)-1]
+	}
+	expr := path[len(path)-1].(ast.Expr)
+	if _, ok := expr.(*ast.Ident); ok {
+		return nil, extractConstantError("expression is already a named constant")
+	}
+	for id, _ := range getIdentsInNode(expr) {
+		if id.Name == "iota" {
+			return nil, extractConstantError("expression depends on iota")
+		}
+	}
+	for _, n := range path {
+		switch t := n.(type) {
+		case *ast.ImportSpec:
+			return nil, extractConstantError("can't extract import path")
+		case *ast.Field:
+			if ast.Node(t.Tag) == expr {
+				return nil, extractConstantError("can't extract struct tag")
+			}
+		}
+	}
+
+	var fn *ast.FuncDecl
+	var fnLit *ast.FuncLit
+	var topDecl ast.Decl
+	for _, n := range path {
+		switch t := n.(type) {
+		case *ast.FuncDecl:
+			fn = t
+		case *ast.FuncLit:
+			if fn == nil && fnLit == nil {
+				fnLit = t
+			}
+		}
+		if d, ok := n.(ast.Decl); ok && topDecl == nil {
+			topDecl = d
+		}
+	}
+	// literal in a signature isn't in the scope of the function's locals
+	var body *ast.BlockStmt
+	if fn != nil {
+		body = fn.Body
+	} else if fnLit != nil {
+		body = fnLit.Body
+	}
+	local := !replaceAll && body != nil && body.Pos() < expr.Pos() && expr.End() <= body.End()
+
+	content, rerr := ioutil.ReadFile(filename)
+	if rerr != nil {
+		return nil, extractConstantError("couldn't read file " + filename + ": " + rerr.String())
+	}
+	exprText := nodeText(fset, content, expr)
+
+	// name must not conflict with declarations and must not be shadowed at occurrences
+	selectors, members := getMemberIdents(programTree)
+	nv := &nameUsesVisitor{constName, selectors, members, nil}
+	if local {
+		if fn != nil {
+			ast.Walk(nv, fn)
+		} else {
+			ast.Walk(nv, fnLit)
+		}
+	} else {
+		if _, found := pack.Symbols.LookUp(constName, filename); found {
+			return nil, extractConstantError("package already contains a symbol with name " + constName)
+		}
+		for f, _ := range pack.AstPackage.Files {
+			if pack.Imports[f] == nil {
+				continue
+			}
+			for _, el := range *pack.Imports[f] {
+				if el.(*st.PackageSymbol).Name() == constName {
+					return nil, extractConstantError("package " + constName + " is imported in " + f)
+				}
+			}
+		}
+		for _, f := range pack.AstPackage.Files {
+			ast.Walk(nv, f)
+		}
+	}
+	if nv.found != nil {
+		return nil, extractConstantError("name " + constName + " is already used at " + fset.Position(nv.found.Pos()).String())
+	}
+
+	occurrences := map[string][][]ast.Node{filename: [][]ast.Node{path}}
+	if replaceAll {
+		occurrences[filename] = nil
+		for f, fl := range pack.AstPackage.Files {
+			found := [][]ast.Node{}
+			ast.Walk(&equalConstVisitor{identMap, expr, nil, &found}, fl)
+			if len(found) > 0 {
+				occurrences[f] = found
+			}
+		}
+	}
+
+	// typed constant is declared, if all occurrences are used in the context of the same type,
+	// that differs from the default one
+	defaultType := getDefaultType(programTree, pack, filename, expr)
+	if defaultType == nil {
+		return nil, extractConstantError("couldn't determine the type of the expression")
+	}
+	typeName, typed := "", true
+	for f, occs := range occurrences {
+		for _, p := range occs {
+			name, ok := constTypeName(pack, f, getUseType(programTree, pack, f, pv, p))
+			if !ok {
+				name = defaultType.Name()
+			}
+			if typeName != "" && typeName != name {
+				typed = false
+			}
+			typeName = name
+		}
+	}
+	declText := "const " + constName
+	if typed && typeName != "" && typeName != defaultType.Name() {
+		declText += " " + typeName
+	}
+	declText += " = " + exprText
+
+	edits := make(map[string][]*fileEdit)
+	if local {
+		start := fset.Position(body.Lbrace).Offset + 1
+		indent := lineIndent(content, start) + "\t"
+		text := "\n" + indent + declText
+		if len(body.List) > 0 {
+			if first := fset.Position(body.List[0].Pos()); first.Line != fset.Position(body.Lbrace).Line {
+				text = "\n" + lineIndent(content, first.Offset) + declText
+			} else {
+				text += "\n" + indent
+			}
+		}
+		edits[filename] = append(edits[filename], &fileEdit{start, start, text})
+	} else {
+		start, _ := getDeclRange(fset, file, content, topDecl)
+		edits[filename] = append(edits[filename], &fileEdit{start, start, declText + "\n\n"})
+	}
+	for f, occs := range occurrences {
+		for _, p := range occs {
+			e := p[len(p)-1]
+			edits[f] = append(edits[f], &fileEdit{fset.Position(e.Pos()).Offset, fset.Position(e.End()).Offset, constName})
+		}
+	}
+	return edits, nil
+}
@@ -0,0 +1,580 @@
+package refactoring
+
+import (
+	"refactoring/st"
+	"refactoring/errors"
+	"refactoring/program"
+	"go/ast"
+	"go/token"
+	"go/printer"
+	"bytes"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+func extractMethodError(message string) *errors.GoRefactorError {
+	return &errors.GoRefactorError{ErrorType: "extract method error", Message: message}
+}
+
+// return statements of the extracted code, that leave the enclosing function
+type outerReturnsVisitor struct {
+	returns []*ast.ReturnStmt
+}
+
+func (v *outerReturnsVisitor) Visit(node ast.Node) ast.Visitor {
+	switch t := node.(type) {
+	case *ast.FuncLit:
+		return nil
+	case *ast.ReturnStmt:
+		v.returns = append(v.returns, t)
+	}
+	return v
+}
+
+func getOuterReturns(stmtList []ast.Stmt) []*ast.ReturnStmt {
+	v := &outerReturnsVisitor{}
+	for _, stmt := range stmtList {
+		ast.Walk(v, stmt)
+	}
+	return v.returns
+}
+
+// true if execution of the statement list never reaches it's end
+func isTerminating(stmtList []ast.Stmt) bool {
+	if len(stmtList) == 0 {
+		return false
+	}
+	switch t := stmtList[len(stmtList)-1].(type) {
+	case *ast.ReturnStmt:
+		return true
+	case *ast.ExprStmt:
+		if c, ok := t.X.(*ast.CallExpr); ok {
+			if id, ok := c.Fun.(*ast.Ident); ok && id.Name == "panic" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func printedText(node ast.Node) string {
+	b := new(bytes.Buffer)
+	printer.Fprint(b, token.NewFileSet(), node)
+	return b.String()
+}
+
+// zero value of the type, written as text
+func zeroValueText(identMap st.IdentifierMap, typ ast.Expr, text string) string {
+	var t st.ITypeSymbol
+	switch e := typ.(type) {
+	case *ast.StarExpr, *ast.MapType, *ast.ChanType, *ast.FuncType, *ast.InterfaceType:
+		return "nil"
+	case *ast.ArrayType:
+		if e.Len == nil {
+			return "nil"
+		}
+		return text + "{}"
+	case *ast.StructType:
+		return text + "{}"
+	case *ast.Ident:
+		t, _ = identMap[e].(st.ITypeSymbol)
+	case *ast.SelectorExpr:
+		t, _ = identMap[e.Sel].(st.ITypeSymbol)
+	}
+	for t != nil {
+		switch tt := t.(type) {
+		case *st.AliasTypeSymbol:
+			t = tt.BaseType
+			continue
+		case *st.BasicTypeSymbol:
+			switch tt.Name() {
+			case "bool":
+				return "false"
+			case "string":
+				return `""`
+			}
+			return "0"
+		case *st.StructTypeSymbol:
+			return text + "{}"
+		case *st.ArrayTypeSymbol:
+			if tt.Len != st.SLICE {
+				return text + "{}"
+			}
+		}
+		return "nil"
+	}
+	return "*new(" + text + ")"
+}
+
+// leading whitespace of the line, that contains offset
+func lineIndent(content []byte, offset int) string {
+	start := bytes.LastIndex(content[:offset], []byte("\n")) + 1
+	end := start
+	for end < len(content) && (content[end] == ' ' || content[end] == '\t') {
+		end++
+	}
+	return string(content[start:end])
+}
+
+// edits, that make uses of pointer passed symbols in the extracted code work through pointers
+// and uses of renamed symbols use new names
+func getPointerTransformEdits(fset *token.FileSet, file *ast.File, stmtList []ast.Stmt, pointerSymbols map[st.Symbol]int, names map[st.Symbol]string, identMap st.IdentifierMap) []*fileEdit {
+	v := &pointerEditsVisitor{fset, file, &pointerTransformVisitor{fset, file, pointerSymbols, identMap, nil}, names, nil}
+	for _, stmt := range stmtList {
+		ast.Walk(v, stmt)
+	}
+	return v.edits
+}
+
+type pointerEditsVisitor struct {
+	fset   *token.FileSet
+	file   *ast.File
+	depths *pointerTransformVisitor
+	names  map[st.Symbol]string
+	edits  []*fileEdit
+}
+
+func (v *pointerEditsVisitor) Visit(node ast.Node) ast.Visitor {
+	var id *ast.Ident
+	var depth int
+	var ok bool
+	switch t := node.(type) {
+	case *ast.UnaryExpr:
+		if t.Op == token.AND {
+			id, depth, ok = v.depths.getPointerDepth(t)
+		}
+	case *ast.StarExpr, *ast.Ident:
+		id, depth, ok = v.depths.getPointerDepth(t.(ast.Expr))
+	}
+	if !ok {
+		if id, isIdent := node.(*ast.Ident); isIdent {
+			if name, renamed := v.names[v.depths.identMap[id]]; renamed {
+				v.edits = append(v.edits, &fileEdit{v.fset.Position(id.Pos()).Offset, v.fset.Position(id.End()).Offset, name})
+			}
+		}
+		return v
+	}
+	text := id.Name
+	if name, renamed := v.names[v.depths.identMap[id]]; renamed {
+		text = name
+	}
+	switch {
+	case depth > 0:
+		text = strings.Repeat("&", depth) + text
+	case depth < 0:
+		text = strings.Repeat("*", -depth) + text
+		x := node.(ast.Expr)
+		if needsParens(&ast.StarExpr{x.Pos(), x}, getNodePath(v.fset, v.file, x)) {
+			text = "(" + text + ")"
+		}
+	}
+	v.edits = append(v.edits, &fileEdit{v.fset.Position(node.Pos()).Offset, v.fset.Position(node.End()).Offset, text})
+	return nil
+}
+
+// break, continue, goto and fallthrough statements of the extracted code, that transfer control out of it
+type outerBranchesVisitor struct {
+	labels    map[string]bool //labels, declared in the extracted code
+	loop      bool            //inside a loop of the extracted code
+	breakable bool            //inside a loop, switch or select of the extracted code
+	branches  *[]*ast.BranchStmt
+}
+
+func (v *outerBranchesVisitor) Visit(node ast.Node) ast.Visitor {
+	switch t := node.(type) {
+	case *ast.FuncLit:
+		return nil
+	case *ast.ForStmt, *ast.RangeStmt:
+		return &outerBranchesVisitor{v.labels, true, true, v.branches}
+	case *ast.SwitchStmt, *ast.TypeSwitchStmt, *ast.SelectStmt:
+		return &outerBranchesVisitor{v.labels, v.loop, true, v.branches}
+	case *ast.BranchStmt:
+		outer := false
+		switch {
+		case t.Label != nil:
+			outer = !v.labels[t.Label.Name]
+		case t.Tok == token.CONTINUE:
+			outer = !v.loop
+		default:
+			outer = !v.breakable
+		}
+		if outer {
+			*v.branches = append(*v.branches, t)
+		}
+	}
+	return v
+}
+
+// labeled statements of the function body or extracted code
+type labelsVisitor struct {
+	labeled []*ast.LabeledStmt
+}
+
+func (v *labelsVisitor) Visit(node ast.Node) ast.Visitor {
+	switch t := node.(type) {
+	case *ast.FuncLit:
+		return nil
+	case *ast.LabeledStmt:
+		v.labeled = append(v.labeled, t)
+	}
+	return v
+}
+
+func getLabeledStmts(nodes []ast.Stmt) []*ast.LabeledStmt {
+	v := &labelsVisitor{}
+	for _, n := range nodes {
+		ast.Walk(v, n)
+	}
+	return v.labeled
+}
+
+func getOuterBranches(stmtList []ast.Stmt) []*ast.BranchStmt {
+	labels := make(map[string]bool)
+	for _, l := range getLabeledStmts(stmtList) {
+		labels[l.Label.Name] = true
+	}
+	branches := []*ast.BranchStmt{}
+	v := &outerBranchesVisitor{labels, false, false, &branches}
+	for _, stmt := range stmtList {
+		ast.Walk(v, stmt)
+	}
+	return branches
+}
+
+// true if the extracted code transfers control out of itself other way, than by reaching it's end
+func hasExits(stmtList []ast.Stmt) bool {
+	return len(getOuterReturns(stmtList)) > 0 || len(getOuterBranches(stmtList)) > 0
+}
+
+// Extracts statements to a method by textual edits. This is used, when they contain return,
+// break, continue or goto statements, transferring control out of them, or when options are given:
+// duplicates of the statements in the package are replaced with calls too, or parameters are arranged by user.
+// If the statements end with such a transfer and it's the only one kind of them, the call replaces the statements as
+//	return m(a, b)
+// or as a call, followed by the transfer statement. Otherwise the method reports, whether the transfer happened:
+//	if r1, r2, done := m(a, b); done {
+//		return r1, r2
+//	}
+// and, if there are several kinds of transfers, which one:
+//	switch r1, r2, code := m(a, b); code {
+//	case 1:
+//		return r1, r2
+//	case 2:
+//		continue
+//	}
+// Variables, which the user chose to return, are assigned with the results of the call:
+//	x, y = m(a, x, y)
+func extractStatementsToMethod(programTree *program.Program, pack *st.Package, file *ast.File, filename string, stmtList []ast.Stmt, nodeFrom ast.Node, methodName string, params *st.SymbolTable, declared *st.SymbolTable, recvSym *st.VariableSymbol, opts *extractMethodOptions) (map[string][]*fileEdit, *errors.GoRefactorError) {
+	fset := pack.FileSet
+	identMap := programTree.IdentMap
+	content, rerr := ioutil.ReadFile(filename)
+	if rerr != nil {
+		return nil, extractMethodError("couldn't read file " + filename + ": " + rerr.String())
+	}
+	offset := func(pos token.Pos) int {
+		return fset.Position(pos).Offset
+	}
+	start, end := offset(stmtList[0].Pos()), offset(stmtList[len(stmtList)-1].End())
+	indent := lineIndent(content, start)
+
+	if ok, errs := checkScoping(nodeFrom, stmtList, declared, identMap); !ok {
+		s := ""
+		errs.ForEach(func(sym st.Symbol) {
+			s += sym.Name() + " "
+		})
+		return nil, extractMethodError("extracted code declares symbols that are used in not-extracted code: " + s)
+	}
+
+	path := getNodePath(fset, file, stmtList[0])
+	ftype, fbody := getEnclosingFunction(path)
+	if ftype == nil {
+		return nil, extractMethodError("extracted code is not inside a function")
+	}
+	resultTypes := getResultTypes(ftype)
+
+	for _, l := range getLabeledStmts(stmtList) {
+		sym, ok := identMap[l.Label]
+		if !ok {
+			continue
+		}
+		for id, _ := range sym.Identifiers() {
+			if off := offset(id.Pos()); off < start || off >= end {
+				return nil, extractMethodError("label " + l.Label.Name + ", declared in extracted code, is used at " + fset.Position(id.Pos()).String())
+			}
+		}
+	}
+
+	// kinds of transfers, numbered from 1
+	kinds := []string{}
+	codes := make(map[string]int)
+	addKind := func(kind string) {
+		if _, ok := codes[kind]; !ok {
+			kinds = append(kinds, kind)
+			codes[kind] = len(kinds)
+		}
+	}
+	returns := getOuterReturns(stmtList)
+	bare := false
+	for i, r := range returns {
+		if i > 0 && bare != (len(r.Results) == 0) {
+			return nil, extractMethodError("extracted code mixes bare and non-bare return statements at " + fset.Position(r.Pos()).String())
+		}
+		bare = len(r.Results) == 0
+		addKind("return")
+	}
+	valued := len(returns) > 0 && !bare
+	branches := getOuterBranches(stmtList)
+	isLast := false
+	for _, b := range branches {
+		if b.Tok == token.FALLTHROUGH {
+			return nil, extractMethodError("fallthrough statement at " + fset.Position(b.Pos()).String() + " leaves extracted code")
+		}
+		addKind(nodeText(fset, content, b))
+		isLast = isLast || ast.Stmt(b) == stmtList[len(stmtList)-1]
+	}
+	simple := len(kinds) == 1 && (isTerminating(stmtList) || isLast)
+	// method reports, whether the transfer happened
+	flagged := len(kinds) > 0 && !simple
+	flag := func(code int) string {
+		if len(kinds) == 1 {
+			return strconv.Btoa(code > 0)
+		}
+		return strconv.Itoa(code)
+	}
+
+	edits := []*fileEdit{}
+	pointerSymbols := getPointerPassedSymbols(stmtList, params, identMap)
+	mp, err := arrangeParameters(fset, path, stmtList, params, pointerSymbols, opts.params, identMap)
+	if err != nil {
+		return nil, err
+	}
+	if len(mp.returned) > 0 && len(kinds) > 0 {
+		return nil, extractMethodError("variables can be returned only from code without return, break, continue and goto statements")
+	}
+	edits = append(edits, getPointerTransformEdits(fset, file, stmtList, pointerSymbols, mp.names, identMap)...)
+
+	resultTexts := make([]string, len(resultTypes))
+	zeros := []string{}
+	for i, t := range resultTypes {
+		resultTexts[i] = nodeText(fset, content, t)
+		if valued {
+			zeros = append(zeros, zeroValueText(identMap, t, resultTexts[i]))
+		}
+	}
+	if flagged {
+		for _, r := range returns {
+			pos := offset(r.Pos()) + len("return")
+			switch {
+			case bare:
+				edits = append(edits, &fileEdit{pos, pos, " " + flag(codes["return"])})
+			case len(r.Results) != len(resultTypes):
+				return nil, extractMethodError("can't add a flag to the return statement at " + fset.Position(r.Pos()).String() + ", that returns results of a call")
+			default:
+				e := offset(r.Results[len(r.Results)-1].End())
+				edits = append(edits, &fileEdit{e, e, ", " + flag(codes["return"])})
+			}
+		}
+	}
+	for _, b := range branches {
+		text := "return"
+		if flagged {
+			text += " " + strings.Join(append(zeros, flag(codes[nodeText(fset, content, b)])), ", ")
+		}
+		edits = append(edits, &fileEdit{offset(b.Pos()), offset(b.End()), text})
+	}
+
+	// method declaration
+	body := strings.Replace(applyEditsInRange(content, start, end, edits), "\n"+indent, "\n\t", -1)
+
+	paramTypes, paramTexts, argTexts, assigned := []string{}, []string{}, []string{}, []string{}
+	returnedTypes, returnedNames := []string{}, []string{}
+	for _, sym := range mp.order {
+		t := printedText(sym.ToAstField(pack, filename).Type)
+		depth := pointerSymbols[sym]
+		paramTypes = append(paramTypes, strings.Repeat("*", depth)+t)
+		paramTexts = append(paramTexts, mp.name(sym)+" "+paramTypes[len(paramTypes)-1])
+		argTexts = append(argTexts, strings.Repeat("&", depth)+sym.Name())
+		if mp.returned[sym] {
+			returnedTypes = append(returnedTypes, t)
+			returnedNames = append(returnedNames, mp.name(sym))
+			assigned = append(assigned, sym.Name())
+		}
+	}
+
+	resultList := []string{}
+	if valued {
+		resultList = append(resultList, resultTexts...)
+	}
+	resultList = append(resultList, returnedTypes...)
+	if flagged && len(kinds) == 1 {
+		resultList = append(resultList, "bool")
+	} else if flagged {
+		resultList = append(resultList, "int")
+	}
+	results := ""
+	switch len(resultList) {
+	case 0:
+	case 1:
+		results = " " + resultList[0]
+	default:
+		results = " (" + strings.Join(resultList, ", ") + ")"
+	}
+	recv := ""
+	if recvSym != nil {
+		recv = "(" + recvSym.Name() + " " + printedText(recvSym.ToAstField(pack, filename).Type) + ") "
+	}
+	decl := "\n\nfunc " + recv + methodName + "(" + strings.Join(paramTexts, ", ") + ")" + results + " {\n\t" + body + "\n"
+	if flagged {
+		decl += "\treturn " + strings.Join(append(zeros, flag(0)), ", ") + "\n"
+	}
+	if len(returnedNames) > 0 {
+		decl += "\treturn " + strings.Join(returnedNames, ", ") + "\n"
+	}
+	decl += "}"
+	declEnd := offset(path[1].End())
+	fileEdits := map[string][]*fileEdit{filename: []*fileEdit{&fileEdit{declEnd, declEnd, decl}}}
+
+	// calls
+	names := []string{}
+	if valued {
+		for i, _ := range resultTypes {
+			names = append(names, "r"+strconv.Itoa(i+1))
+		}
+		if len(names) == 1 {
+			names[0] = "r"
+		}
+	}
+	labels := make(map[string]map[int]bool)
+	callText := func(fname string, content []byte, call string, path []ast.Node, fbody *ast.BlockStmt, indent string) string {
+		transfer := func(kind string) string {
+			switch {
+			case kind == "return" && valued:
+				return "return " + strings.Join(names, ", ")
+			case kind == "break" && len(kinds) > 1:
+				// inside of the generated switch break needs a label
+				label, edit := getBreakLabel(fset, content, path, fbody)
+				if edit != nil {
+					if labels[fname] == nil {
+						labels[fname] = make(map[int]bool)
+					}
+					if !labels[fname][edit.Start] {
+						labels[fname][edit.Start] = true
+						fileEdits[fname] = append(fileEdits[fname], edit)
+					}
+				}
+				return "break " + label
+			}
+			return kind
+		}
+		switch {
+		case len(kinds) == 0:
+			return call
+		case simple && valued:
+			return "return " + call
+		case simple:
+			return call + "\n" + indent + transfer(kinds[0])
+		case len(kinds) == 1 && valued:
+			return "if " + strings.Join(names, ", ") + ", done := " + call + "; done {\n" + indent + "\t" + transfer(kinds[0]) + "\n" + indent + "}"
+		case len(kinds) == 1:
+			return "if " + call + " {\n" + indent + "\t" + transfer(kinds[0]) + "\n" + indent + "}"
+		}
+		text := "switch " + call + " {"
+		if valued {
+			text = "switch " + strings.Join(names, ", ") + ", code := " + call + "; code {"
+		}
+		for i, kind := range kinds {
+			text += "\n" + indent + "case " + strconv.Itoa(i+1) + ":\n" + indent + "\t" + transfer(kind)
+		}
+		return text + "\n" + indent + "}"
+	}
+	makeCall := func(args []string, recvName string, assigned []string) string {
+		call := methodName + "(" + strings.Join(args, ", ") + ")"
+		if recvSym != nil {
+			call = recvName + "." + call
+		}
+		if len(assigned) > 0 {
+			call = strings.Join(assigned, ", ") + " = " + call
+		}
+		return call
+	}
+	recvName := ""
+	if recvSym != nil {
+		recvName = recvSym.Name()
+	}
+	call := makeCall(argTexts, recvName, assigned)
+	if opts.preview != "" {
+		printMethodSignature(opts.preview, recv, methodName, mp, paramTypes, pointerSymbols, resultList, call)
+		return map[string][]*fileEdit{}, nil
+	}
+	fileEdits[filename] = append(fileEdits[filename], &fileEdit{start, end, callText(filename, content, call, path, fbody, indent)})
+
+	if !opts.duplicates {
+		return fileEdits, nil
+	}
+	if err := replaceDuplicates(programTree, pack, filename, content, stmtList, params, recvSym, mp, pointerSymbols, valued, resultTexts, makeCall, callText, fileEdits); err != nil {
+		return nil, err
+	}
+	return fileEdits, nil
+}
+
+// type and body of the innermost function or function literal on the path
+func getEnclosingFunction(path []ast.Node) (*ast.FuncType, *ast.BlockStmt) {
+	for j := len(path) - 1; j >= 0; j-- {
+		switch f := path[j].(type) {
+		case *ast.FuncLit:
+			return f.Type, f.Body
+		case *ast.FuncDecl:
+			return f.Type, f.Body
+		}
+	}
+	return nil, nil
+}
+
+// types of function results, one per result
+func getResultTypes(ftype *ast.FuncType) []ast.Expr {
+	resultTypes := []ast.Expr{}
+	if ftype.Results != nil {
+		for _, f := range ftype.Results.List {
+			n := len(f.Names)
+			if n == 0 {
+				n = 1
+			}
+			for i := 0; i < n; i++ {
+				resultTypes = append(resultTypes, f.Type)
+			}
+		}
+	}
+	return resultTypes
+}
+
+func getDeclaredIn(pack *st.Package, stmtList []ast.Stmt, programTree *program.Program) *st.SymbolTable {
+	_, declared := getParametersAndDeclaredIn(pack, stmtList, programTree)
+	return declared
+}
+
+// label of the statement, that unlabeled break at the start of path refers to;
+// if the statement has no label, a new one is made by the returned edit
+func getBreakLabel(fset *token.FileSet, content []byte, path []ast.Node, fbody *ast.BlockStmt) (string, *fileEdit) {
+	var target ast.Node
+	j := len(path) - 2
+	for ; j > 0 && target == nil; j-- {
+		switch path[j].(type) {
+		case *ast.ForStmt, *ast.RangeStmt, *ast.SwitchStmt, *ast.TypeSwitchStmt, *ast.SelectStmt:
+			target = path[j]
+		}
+	}
+	if l, ok := path[j].(*ast.LabeledStmt); ok {
+		return l.Label.Name, nil
+	}
+	used := make(map[string]bool)
+	for _, l := range getLabeledStmts(fbody.List) {
+		used[l.Label.Name] = true
+	}
+	label := "outer"
+	for i := 1; used[label]; i++ {
+		label = "outer" + strconv.Itoa(i)
+	}
+	off := fset.Position(target.Pos()).Offset
+	return label, &fileEdit{off, off, label + ":\n" + lineIndent(content, off)}
+}
@@ -0,0 +1,272 @@
+package refactoring
+
+import (
+	"refactoring/st"
+	"refactoring/program"
+	"refactoring/errors"
+	"go/ast"
+	"go/token"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// statement list of the package, that is structurally equal to the extracted one
+type duplicateFragment struct {
+	filename string
+	file     *ast.File
+	owner    ast.Node //block or clause, that contains the statements
+	stmts    []ast.Stmt
+	mapping  map[st.Symbol]st.Symbol //symbols of the extracted code to symbols of the fragment
+}
+
+type stmtListsVisitor struct {
+	owners *[]ast.Node
+}
+
+func (v *stmtListsVisitor) Visit(node ast.Node) ast.Visitor {
+	switch node.(type) {
+	case *ast.BlockStmt, *ast.CaseClause, *ast.CommClause:
+		*v.owners = append(*v.owners, node)
+	}
+	return v
+}
+
+var (
+	identType   = reflect.TypeOf((*ast.Ident)(nil))
+	objectType  = reflect.TypeOf((*ast.Object)(nil))
+	commentType = reflect.TypeOf((*ast.CommentGroup)(nil))
+	posType     = reflect.TypeOf(token.NoPos)
+)
+
+// structural matching of a fragment with the extracted code;
+// local variables and labels of the fragment must correspond one-to-one to those of the extracted code,
+// other identifiers must denote the same symbols
+type fragmentMatcher struct {
+	identMap st.IdentifierMap
+	params   [2]*st.SymbolTable //parameters of the extracted code and of the fragment
+	starts   [2]token.Pos
+	ends     [2]token.Pos
+	recvSym  st.Symbol
+	mapping  map[st.Symbol]st.Symbol
+	reverse  map[st.Symbol]st.Symbol
+}
+
+const (
+	otherSymbol = iota
+	parameterSymbol
+	localSymbol
+)
+
+func (m *fragmentMatcher) kind(side int, sym st.Symbol) int {
+	if side == 0 && sym == m.recvSym || m.params[side].Contains(sym) {
+		return parameterSymbol
+	}
+	for id, _ := range sym.Identifiers() {
+		if id.Pos() < m.starts[side] || id.Pos() >= m.ends[side] {
+			return otherSymbol
+		}
+	}
+	return localSymbol
+}
+
+func (m *fragmentMatcher) matchIdents(a *ast.Ident, b *ast.Ident) bool {
+	sa, okA := m.identMap[a]
+	sb, okB := m.identMap[b]
+	if !okA || !okB {
+		return okA == okB && a.Name == b.Name
+	}
+	ka := m.kind(0, sa)
+	if ka != m.kind(1, sb) {
+		return false
+	}
+	if ka == otherSymbol {
+		return sa == sb
+	}
+	if mapped, ok := m.mapping[sa]; ok {
+		return mapped == sb
+	}
+	if _, ok := m.reverse[sb]; ok {
+		return false
+	}
+	m.mapping[sa], m.reverse[sb] = sb, sa
+	return true
+}
+
+func (m *fragmentMatcher) match(x reflect.Value, y reflect.Value) bool {
+	if x.Kind() != y.Kind() {
+		return false
+	}
+	switch x.Kind() {
+	case reflect.Interface:
+		if x.IsNil() || y.IsNil() {
+			return x.IsNil() == y.IsNil()
+		}
+		return m.match(x.Elem(), y.Elem())
+	case reflect.Ptr:
+		if x.Type() != y.Type() {
+			return false
+		}
+		if x.IsNil() || y.IsNil() {
+			return x.IsNil() == y.IsNil()
+		}
+		switch x.Type() {
+		case identType:
+			return m.matchIdents(x.Interface().(*ast.Ident), y.Interface().(*ast.Ident))
+		case objectType, commentType:
+			return true
+		}
+		return m.match(x.Elem(), y.Elem())
+	case reflect.Slice:
+		if x.Len() != y.Len() {
+			return false
+		}
+		for i := 0; i < x.Len(); i++ {
+			if !m.match(x.Index(i), y.Index(i)) {
+				return false
+			}
+		}
+		return true
+	case reflect.Struct:
+		for i := 0; i < x.NumField(); i++ {
+			if x.Type().Field(i).Type == posType {
+				continue
+			}
+			if !m.match(x.Field(i), y.Field(i)) {
+				return false
+			}
+		}
+		return true
+	}
+	return x.Interface() == y.Interface()
+}
+
+// mapping of symbols of the extracted code to symbols of the fragment, if they are equal; nil otherwise
+func matchFragment(programTree *program.Program, pack *st.Package, stmtList []ast.Stmt, params *st.SymbolTable, recvSym *st.VariableSymbol, fragment []ast.Stmt) map[st.Symbol]st.Symbol {
+	for i, stmt := range stmtList {
+		if reflect.TypeOf(stmt) != reflect.TypeOf(fragment[i]) {
+			return nil
+		}
+	}
+	fragmentParams, _ := getParametersAndDeclaredIn(pack, fragment, programTree)
+	m := &fragmentMatcher{programTree.IdentMap,
+		[2]*st.SymbolTable{params, fragmentParams},
+		[2]token.Pos{stmtList[0].Pos(), fragment[0].Pos()},
+		[2]token.Pos{stmtList[len(stmtList)-1].End(), fragment[len(fragment)-1].End()},
+		nil, make(map[st.Symbol]st.Symbol), make(map[st.Symbol]st.Symbol)}
+	if recvSym != nil {
+		m.recvSym = recvSym
+	}
+	for i, stmt := range stmtList {
+		if !m.match(reflect.ValueOf(stmt), reflect.ValueOf(fragment[i])) {
+			return nil
+		}
+	}
+	// arguments must have the same types as parameters
+	ok := true
+	check := func(sym st.Symbol) {
+		mapped, found := m.mapping[sym]
+		if !found || !sameType(pack, variableType(sym), variableType(mapped)) {
+			ok = false
+		}
+	}
+	params.ForEachNoLock(check)
+	if recvSym != nil {
+		check(recvSym)
+	}
+	if !ok {
+		return nil
+	}
+	return m.mapping
+}
+
+func sameType(pack *st.Package, a st.ITypeSymbol, b st.ITypeSymbol) bool {
+	if a == nil || b == nil {
+		return false
+	}
+	return a == b || printedText(a.ToAstExpr(pack, "")) == printedText(b.ToAstExpr(pack, ""))
+}
+
+// statement lists of the package, which are structurally equal to the extracted one and don't overlap it
+func findDuplicates(programTree *program.Program, pack *st.Package, stmtList []ast.Stmt, params *st.SymbolTable, recvSym *st.VariableSymbol) []*duplicateFragment {
+	n := len(stmtList)
+	start, end := stmtList[0].Pos(), stmtList[n-1].End()
+	result := []*duplicateFragment{}
+	for filename, file := range pack.AstPackage.Files {
+		owners := []ast.Node{}
+		ast.Walk(&stmtListsVisitor{&owners}, file)
+		for _, owner := range owners {
+			list := getStmtList(owner)
+			for i := 0; i+n <= len(list); i++ {
+				fragment := list[i : i+n]
+				if fragment[n-1].End() > start && fragment[0].Pos() < end {
+					continue
+				}
+				if mapping := matchFragment(programTree, pack, stmtList, params, recvSym, fragment); mapping != nil {
+					result = append(result, &duplicateFragment{filename, file, owner, fragment, mapping})
+					i += n - 1
+				}
+			}
+		}
+	}
+	return result
+}
+
+// Replaces duplicates of the extracted statements with calls of the new method and reports the ones,
+// that can't be replaced. makeCall builds the call from arguments, reciever and assigned variables,
+// callText turns it into the statements, that replace a fragment.
+func replaceDuplicates(programTree *program.Program, pack *st.Package, filename string, content []byte, stmtList []ast.Stmt, params *st.SymbolTable, recvSym *st.VariableSymbol, mp *methodParams, pointerSymbols map[st.Symbol]int, valued bool, resultTexts []string, makeCall func(args []string, recvName string, assigned []string) string, callText func(fname string, content []byte, call string, path []ast.Node, fbody *ast.BlockStmt, indent string) string, fileEdits map[string][]*fileEdit) *errors.GoRefactorError {
+	fset := pack.FileSet
+	identMap := programTree.IdentMap
+	contents := fileContents{filename: content}
+	for _, d := range findDuplicates(programTree, pack, stmtList, params, recvSym) {
+		pos := fset.Position(d.stmts[0].Pos()).String()
+		if ok, _ := checkScoping(d.owner, d.stmts, getDeclaredIn(pack, d.stmts, programTree), identMap); !ok {
+			fmt.Printf("duplicate at %s is not replaced: it declares symbols, that are used after it\n", pos)
+			continue
+		}
+		c, err := contents.read(d.filename)
+		if err != nil {
+			return err
+		}
+		dpath := getNodePath(fset, d.file, d.stmts[0])
+		dtype, dbody := getEnclosingFunction(dpath)
+		if dtype == nil {
+			continue
+		}
+		if valued {
+			dresults := getResultTypes(dtype)
+			same := len(dresults) == len(resultTexts)
+			for i := 0; same && i < len(dresults); i++ {
+				same = nodeText(fset, c, dresults[i]) == resultTexts[i]
+			}
+			if !same {
+				fmt.Printf("duplicate at %s is not replaced: enclosing function has other results\n", pos)
+				continue
+			}
+		}
+		args, dassigned, copiedUse := []string{}, []string{}, ""
+		for _, sym := range mp.order {
+			args = append(args, strings.Repeat("&", pointerSymbols[sym])+d.mapping[sym].Name())
+			if mp.returned[sym] {
+				dassigned = append(dassigned, d.mapping[sym].Name())
+			}
+			if mp.copied[sym] && copiedUse == "" {
+				copiedUse, _ = getUseAfter(fset, dpath, d.stmts, d.mapping[sym])
+			}
+		}
+		if copiedUse != "" {
+			fmt.Printf("duplicate at %s is not replaced: it changes a variable, passed by value, which is used at %s\n", pos, copiedUse)
+			continue
+		}
+		recvName := ""
+		if recvSym != nil {
+			recvName = d.mapping[recvSym].Name()
+		}
+		dstart, dend := fset.Position(d.stmts[0].Pos()).Offset, fset.Position(d.stmts[len(d.stmts)-1].End()).Offset
+		text := callText(d.filename, c, makeCall(args, recvName, dassigned), dpath, dbody, lineIndent(c, dstart))
+		fileEdits[d.filename] = append(fileEdits[d.filename], &fileEdit{dstart, dend, text})
+		fmt.Printf("duplicate at %s is replaced\n", pos)
+	}
+	return nil
+}
@@ -0,0 +1,247 @@
+package refactoring
+
+import (
+	"refactoring/st"
+	"refactoring/utils"
+	"refactoring/errors"
+	"refactoring/program"
+	"go/ast"
+	"go/token"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+func extractFunctionError(message string) *errors.GoRefactorError {
+	return &errors.GoRefactorError{ErrorType: "extract function error", Message: message}
+}
+
+func CheckExtractFunctionParameters(filename string, line int, column int, funcName string) (bool, *errors.GoRefactorError) {
+	switch {
+	case filename == "" || !utils.IsGoFile(filename):
+		return false, errors.ArgumentError("filename", "It's not a valid go file name")
+	case line < 1:
+		return false, errors.ArgumentError("line", "Must be > 1")
+	case column < 1:
+		return false, errors.ArgumentError("column", "Must be > 1")
+	case !IsGoIdent(funcName):
+		return false, errors.ArgumentError("funcName", "It's not a valid go identifier")
+	}
+	return true, nil
+}
+
+// Extracts function literal, that starts at position, to a function declaration.
+// Variables, captured by the literal, become parameters (pointers, if the literal changes them),
+// and the literal is replaced with the function or with a closure, that binds them.
+// If the literal captures the reciever of the enclosing method, a method is declared.
+func ExtractFunction(filename string, line int, column int, funcName string) (bool, *errors.GoRefactorError) {
+	if ok, err := CheckExtractFunctionParameters(filename, line, column, funcName); !ok {
+		return false, err
+	}
+	programTree := parseProgram(filename)
+	edits, err := extractFunction(programTree, filename, line, column, funcName)
+	if err != nil {
+		return false, err
+	}
+	if err := applyFileEdits(programTree, edits); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// true if the function body calls recover directly
+type recoverCallVisitor struct {
+	found *bool
+}
+
+func (v *recoverCallVisitor) Visit(node ast.Node) ast.Visitor {
+	switch t := node.(type) {
+	case *ast.FuncLit:
+		return nil
+	case *ast.CallExpr:
+		if id, ok := t.Fun.(*ast.Ident); ok && id.Name == "recover" {
+			*v.found = true
+		}
+	}
+	return v
+}
+
+// variables, declared in the enclosing declaration outside of the literal, which the literal uses
+func getCapturedVariables(programTree *program.Program, pack *st.Package, decl ast.Node, lit *ast.FuncLit) (*st.SymbolTable, *errors.GoRefactorError) {
+	fset := pack.FileSet
+	offset := func(pos token.Pos) int {
+		return fset.Position(pos).Offset
+	}
+	declStart, declEnd := offset(decl.Pos()), offset(decl.End())
+	litStart, litEnd := offset(lit.Pos()), offset(lit.End())
+	used, _ := getParametersAndDeclaredIn(pack, []ast.Stmt{&ast.ExprStmt{lit}}, programTree)
+	captured := st.NewSymbolTable(pack)
+	var err *errors.GoRefactorError
+	used.ForEachNoLock(func(sym st.Symbol) {
+		local := false
+		for id, _ := range sym.Identifiers() {
+			if off := offset(id.Pos()); off >= declStart && off < declEnd && (off < litStart || off >= litEnd) {
+				local = true
+			}
+		}
+		if !local {
+			return
+		}
+		switch sym.(type) {
+		case *st.VariableSymbol:
+			captured.AddSymbol(sym)
+		case st.ITypeSymbol:
+			if err == nil {
+				err = extractFunctionError("function literal uses local type " + sym.Name())
+			}
+		}
+	})
+	return captured, err
+}
+
+func extractFunction(programTree *program.Program, filename string, line int, column int, funcName string) (map[string][]*fileEdit, *errors.GoRefactorError) {
+	pack, file := programTree.FindPackageAndFileByFilename(filename)
+	if pack == nil {
+		return nil, errors.ArgumentError("filename", "Program packages don't contain file '"+filename+"'")
+	}
+	fset := pack.FileSet
+	identMap := programTree.IdentMap
+	offset := func(pos token.Pos) int {
+		return fset.Position(pos).Offset
+	}
+
+	var path []ast.Node
+	ast.Walk(&startPathVisitor{fset, token.Position{filename, 0, line, column}, nil, &path}, file)
+	var lit *ast.FuncLit
+	for j := len(path) - 1; j >= 0 && lit == nil; j-- {
+		if l, ok := path[j].(*ast.FuncLit); ok && l.Pos() == path[len(path)-1].Pos() {
+			lit, path = l, path[:j+1]
+		}
+	}
+	if lit == nil {
+		return nil, extractFunctionError("there is no function literal at the position")
+	}
+	content, rerr := ioutil.ReadFile(filename)
+	if rerr != nil {
+		return nil, extractFunctionError("couldn't read file " + filename + ": " + rerr.String())
+	}
+
+	captured, err := getCapturedVariables(programTree, pack, path[1], lit)
+	if err != nil {
+		return nil, err
+	}
+	pointerSymbols := getPointerPassedSymbols(lit.Body.List, captured, identMap)
+
+	// the literal, that uses unchanged reciever of the enclosing method, becomes a method
+	var recvSym *st.VariableSymbol
+	if fdecl, ok := path[1].(*ast.FuncDecl); ok && fdecl.Recv != nil && len(fdecl.Recv.List[0].Names) > 0 {
+		if s, ok := identMap[fdecl.Recv.List[0].Names[0]].(*st.VariableSymbol); ok && captured.Contains(s) {
+			if _, changed := pointerSymbols[s]; !changed {
+				recvSym = s
+				captured.RemoveSymbol(s.Name())
+			}
+		}
+	}
+
+	if recvSym != nil {
+		t := recvSym.VariableType
+		if t.Methods() != nil {
+			if _, ok := t.Methods().LookUp(funcName, ""); ok {
+				return nil, errors.ArgumentError("funcName", "reciever already contains a method with name "+funcName)
+			}
+		}
+		if bt, _ := st.GetBaseType(t); bt != nil {
+			if s, ok := bt.(*st.StructTypeSymbol); ok {
+				if _, ok := s.Fields.LookUp(funcName, ""); ok {
+					return nil, errors.ArgumentError("funcName", "reciever already contains a field with name "+funcName)
+				}
+			}
+		}
+	} else {
+		if _, ok := pack.Symbols.LookUp(funcName, ""); ok {
+			return nil, errors.ArgumentError("funcName", "package already contains a symbol with name "+funcName)
+		}
+		for id, _ := range getIdentsInNode(path[1]) {
+			if id.Name == funcName {
+				return nil, extractFunctionError("function would be shadowed by " + funcName + " at " + fset.Position(id.Pos()).String())
+			}
+		}
+	}
+
+	// parameters: captured variables, then the literal's ones
+	used := map[string]bool{funcName: true}
+	declParams, args := []string{}, []string{}
+	captured.ForEachNoLock(func(sym st.Symbol) {
+		depth := pointerSymbols[sym]
+		declParams = append(declParams, sym.Name()+" "+strings.Repeat("*", depth)+printedText(sym.ToAstField(pack, filename).Type))
+		args = append(args, strings.Repeat("&", depth)+sym.Name())
+		used[sym.Name()] = true
+	})
+	if t := nodeText(fset, content, lit.Type.Params); len(lit.Type.Params.List) > 0 {
+		declParams = append(declParams, t[1:len(t)-1])
+	}
+	for _, f := range lit.Type.Params.List {
+		for _, id := range f.Names {
+			used[id.Name] = true
+		}
+	}
+	closureParams := []string{}
+	n := 0
+	for _, f := range lit.Type.Params.List {
+		names := []string{}
+		for _, id := range f.Names {
+			names = append(names, id.Name)
+		}
+		if len(names) == 0 {
+			names = append(names, "_")
+		}
+		for i, name := range names {
+			for name == "_" || name == "" {
+				n++
+				if p := "p" + strconv.Itoa(n); !used[p] {
+					name = p
+				}
+			}
+			names[i] = name
+			used[name] = true
+			if _, ok := f.Type.(*ast.Ellipsis); ok {
+				name += "..."
+			}
+			args = append(args, name)
+		}
+		closureParams = append(closureParams, strings.Join(names, ", ")+" "+nodeText(fset, content, f.Type))
+	}
+	results := ""
+	if lit.Type.Results != nil && len(lit.Type.Results.List) > 0 {
+		results = " " + nodeText(fset, content, lit.Type.Results)
+	}
+
+	// declaration
+	bodyStart, bodyEnd := offset(lit.Body.Pos()), offset(lit.Body.End())
+	indent := lineIndent(content, offset(lit.Pos()))
+	edits := getPointerTransformEdits(fset, file, lit.Body.List, pointerSymbols, nil, identMap)
+	body := strings.Replace(applyEditsInRange(content, bodyStart, bodyEnd, edits), "\n"+indent, "\n", -1)
+	recv, callee := "", funcName
+	if recvSym != nil {
+		recv = "(" + recvSym.Name() + " " + printedText(recvSym.ToAstField(pack, filename).Type) + ") "
+		callee = recvSym.Name() + "." + funcName
+	}
+	decl := "\n\nfunc " + recv + funcName + "(" + strings.Join(declParams, ", ") + ")" + results + " " + body
+	declEnd := offset(path[1].End())
+
+	// replacement of the literal
+	text := funcName
+	if captured.Count() > 0 || recvSym != nil {
+		found := false
+		ast.Walk(&recoverCallVisitor{&found}, lit.Body)
+		if found {
+			return nil, extractFunctionError("function literal calls recover, which wouldn't stop panicking, if called from the extracted function")
+		}
+		ret := ""
+		if results != "" {
+			ret = "return "
+		}
+		text = "func(" + strings.Join(closureParams, ", ") + ")" + results + " { " + ret + callee + "(" + strings.Join(args, ", ") + ") }"
+	}
+	return map[string][]*fileEdit{filename: []*fileEdit{&fileEdit{offset(lit.Pos()), offset(lit.End()), text}, &fileEdit{declEnd, declEnd, decl}}}, nil
+}
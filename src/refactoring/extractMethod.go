@@ -129,29 +129,6 @@ func (vis *extractedSetVisitor) Visit(node ast.Node) ast.Visitor {
 	return vis
 }
 
-type checkReturnVisitor struct {
-	has bool
-}
-
-func (vis *checkReturnVisitor) Visit(node ast.Node) ast.Visitor {
-	switch node.(type) {
-	case *ast.ReturnStmt:
-		vis.has = true
-	}
-	return vis
-}
-
-func checkForReturns(block *vector.Vector) bool {
-
-	vis := &checkReturnVisitor{}
-	for _, stmt := range *block {
-		if n, ok := stmt.(ast.Node); ok {
-			ast.Walk(vis, n)
-		}
-	}
-	return vis.has
-}
-
 type checkScopingVisitor struct {
 	declaredInExtracted *st.SymbolTable
 	errs                *st.SymbolTable
@@ -249,39 +226,7 @@ func (vis *pointerCandidatesVisitor) Visit(node ast.Node) ast.Visitor {
 			return nil
 		}
 		for _, ee := range t.Lhs {
-			depth := 1
-			stop := false
-			for !stop {
-				fmt.Printf("%T\n", ee)
-				switch e := ee.(type) {
-				case *ast.Ident:
-					s := vis.identMap.GetSymbol(e)
-					if vis.params.Contains(s) && depth > 0 {
-						if i, ok := vis.result[s]; !ok || i < depth {
-							vis.result[s] = depth
-						}
-					}
-					stop = true
-				case *ast.StarExpr:
-					depth--
-					ee = e.X
-				case *ast.UnaryExpr:
-					if e.Op == token.AND {
-						depth++
-					}
-					ee = e.X
-				case *ast.ParenExpr:
-					ee = e.X
-				case *ast.IndexExpr:
-					ast.Walk(vis, e.Index)
-					stop = true
-				case *ast.SelectorExpr:
-					ast.Walk(vis, e.X)
-					stop = true
-				default:
-					stop = true
-				}
-			}
+			vis.checkAssigned(ee)
 		}
 		return nil
 	case *ast.UnaryExpr:
@@ -293,10 +238,58 @@ func (vis *pointerCandidatesVisitor) Visit(node ast.Node) ast.Visitor {
 	case *ast.StarExpr:
 		vis.checkAddrOperators(t)
 		return nil
+	case *ast.IncDecStmt:
+		vis.checkAssigned(t.X)
+		return nil
+	case *ast.RangeStmt:
+		if t.Tok == token.ASSIGN {
+			vis.checkAssigned(t.Key)
+			if t.Value != nil {
+				vis.checkAssigned(t.Value)
+			}
+		}
+		ast.Walk(vis, t.X)
+		ast.Walk(vis, t.Body)
+		return nil
 	}
 	return vis
 }
 
+// marks parameter, that is changed by assignment to ee, to be passed by pointer
+func (vis *pointerCandidatesVisitor) checkAssigned(ee ast.Expr) {
+	depth := 1
+	for {
+		switch e := ee.(type) {
+		case *ast.Ident:
+			s := vis.identMap.GetSymbol(e)
+			if vis.params.Contains(s) && depth > 0 {
+				if i, ok := vis.result[s]; !ok || i < depth {
+					vis.result[s] = depth
+				}
+			}
+			return
+		case *ast.StarExpr:
+			depth--
+			ee = e.X
+		case *ast.UnaryExpr:
+			if e.Op == token.AND {
+				depth++
+			}
+			ee = e.X
+		case *ast.ParenExpr:
+			ee = e.X
+		case *ast.IndexExpr:
+			ast.Walk(vis, e.Index)
+			return
+		case *ast.SelectorExpr:
+			ast.Walk(vis, e.X)
+			return
+		default:
+			return
+		}
+	}
+}
+
 func getPointerPassedSymbols(stmtList []ast.Stmt, params *st.SymbolTable, identMap st.IdentifierMap) map[st.Symbol]int {
 	vis := &pointerCandidatesVisitor{params, make(map[st.Symbol]int), identMap}
 	for _, stmt := range stmtList {
@@ -544,10 +537,6 @@ func getExtractedStatementList(pack *st.Package, file *ast.File, filename string
 		return nil, nil, &errors.GoRefactorError{ErrorType: "extract method error", Message: "can't extract such set of statements"}
 	}
 
-	if checkForReturns(vis.resultBlock) {
-		return nil, nil, &errors.GoRefactorError{ErrorType: "extract method error", Message: "can't extract code witn return statements"}
-	}
-
 	return makeStmtList(vis.resultBlock), vis.nodeFrom, nil
 }
 
@@ -564,21 +553,31 @@ func getResultList(programTree *program.Program, pack *st.Package, filename stri
 
 // Extracts a set of statements or expression to a method;
 // start position - where the first statement starts;
-// end position - where the last statement ends.
-func ExtractMethod(filename string, lineStart int, colStart int, lineEnd int, colEnd int, methodName string, recieverVarLine int, recieverVarCol int) (bool, *errors.GoRefactorError) {
+// end position - where the last statement ends;
+// if replaceDuplicates is set, equal sets of statements in the package are replaced with calls too;
+// paramsSpec orders, renames and chooses passing of parameters: comma-separated name[:new name][=value|pointer|return];
+// if preview is "text" or "json", the signature of the method is printed and nothing is changed.
+func ExtractMethod(filename string, lineStart int, colStart int, lineEnd int, colEnd int, methodName string, recieverVarLine int, recieverVarCol int, replaceDuplicates bool, paramsSpec string, preview string) (bool, *errors.GoRefactorError) {
 	p := parseProgram(filename)
-	ok, err := extractMethod(p, filename, lineStart, colStart, lineEnd, colEnd, methodName, recieverVarLine, recieverVarCol)
+	ok, err := extractMethod(p, filename, lineStart, colStart, lineEnd, colEnd, methodName, recieverVarLine, recieverVarCol, replaceDuplicates, paramsSpec, preview)
 	if !ok {
 		p.SaveFile(filename)
 	}
 	return ok, err
 }
 
-func extractMethod(programTree *program.Program, filename string, lineStart int, colStart int, lineEnd int, colEnd int, methodName string, recieverVarLine int, recieverVarCol int) (bool, *errors.GoRefactorError) {
+func extractMethod(programTree *program.Program, filename string, lineStart int, colStart int, lineEnd int, colEnd int, methodName string, recieverVarLine int, recieverVarCol int, replaceDuplicates bool, paramsSpec string, preview string) (bool, *errors.GoRefactorError) {
 
 	if ok, err := CheckExtractMethodParameters(filename, lineStart, colStart, lineEnd, colEnd, methodName, recieverVarLine, recieverVarCol); !ok {
 		return false, err
 	}
+	if preview != "" && preview != "text" && preview != "json" {
+		return false, errors.ArgumentError("preview", "must be text or json")
+	}
+	spec, err := parseMethodParamsSpec(paramsSpec)
+	if err != nil {
+		return false, err
+	}
 
 	pack, file := programTree.FindPackageAndFileByFilename(filename)
 	if pack == nil {
@@ -628,6 +627,21 @@ func extractMethod(programTree *program.Program, filename string, lineStart int,
 		params.RemoveSymbol(recvSym.Name())
 	}
 
+	options := replaceDuplicates || len(spec) > 0 || preview != ""
+	if options && nodeFrom == nil {
+		return false, &errors.GoRefactorError{ErrorType: "extract method error", Message: "duplicates are replaced and parameters are arranged only for extracted statements"}
+	}
+	if nodeFrom != nil && (hasExits(stmtList) || options) {
+		edits, err := extractStatementsToMethod(programTree, pack, file, filename, stmtList, nodeFrom, methodName, params, declared, recvSym, &extractMethodOptions{replaceDuplicates, spec, preview})
+		if err != nil {
+			return false, err
+		}
+		if err := applyFileEdits(programTree, edits); err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+
 	resultList := getResultList(programTree, pack, filename, stmtList)
 	results := st.NewSymbolTable(pack)
 	for _, r := range resultList {
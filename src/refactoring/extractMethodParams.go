@@ -0,0 +1,219 @@
+package refactoring
+
+import (
+	"refactoring/st"
+	"refactoring/errors"
+	"go/ast"
+	"go/token"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ways to pass a variable, that the extracted code uses
+const (
+	passValue   = "value"
+	passPointer = "pointer"
+	passReturn  = "return"
+)
+
+// options of extraction of statements to a method
+type extractMethodOptions struct {
+	duplicates bool               //replace duplicates of the statements with calls too
+	params     []*methodParamSpec //order, names and passing of parameters
+	preview    string             //"text" or "json" to print the signature instead of extracting
+}
+
+// parameter, as the user wants it: name[:new name][=value|pointer|return]
+type methodParamSpec struct {
+	name    string
+	newName string
+	mode    string
+}
+
+// parses comma-separated list of parameter specs
+func parseMethodParamsSpec(spec string) ([]*methodParamSpec, *errors.GoRefactorError) {
+	res := []*methodParamSpec{}
+	if strings.TrimSpace(spec) == "" {
+		return res, nil
+	}
+	for _, el := range strings.Split(spec, ",", -1) {
+		p := &methodParamSpec{}
+		el = strings.TrimSpace(el)
+		if i := strings.Index(el, "="); i != -1 {
+			el, p.mode = strings.TrimSpace(el[:i]), strings.TrimSpace(el[i+1:])
+			if p.mode != passValue && p.mode != passPointer && p.mode != passReturn {
+				return nil, errors.ArgumentError("params", "parameter "+el+" must be passed as value, pointer or return, not '"+p.mode+"'")
+			}
+		}
+		p.name = el
+		if i := strings.Index(el, ":"); i != -1 {
+			p.name, p.newName = strings.TrimSpace(el[:i]), strings.TrimSpace(el[i+1:])
+			if !IsGoIdent(p.newName) {
+				return nil, errors.ArgumentError("params", p.newName+" is not a valid go identifier")
+			}
+		}
+		if !IsGoIdent(p.name) {
+			return nil, errors.ArgumentError("params", p.name+" is not a valid go identifier")
+		}
+		res = append(res, p)
+	}
+	return res, nil
+}
+
+// parameters of the extracted method
+type methodParams struct {
+	order    []st.Symbol
+	names    map[st.Symbol]string //new names of parameters
+	returned map[st.Symbol]bool   //variables, which new values the method returns
+	copied   map[st.Symbol]bool   //variables, changed by the extracted code, but passed by value
+}
+
+func (p *methodParams) name(sym st.Symbol) string {
+	if name, ok := p.names[sym]; ok {
+		return name
+	}
+	return sym.Name()
+}
+
+// mode, the parameter is passed with
+func (p *methodParams) mode(sym st.Symbol, pointerSymbols map[st.Symbol]int) string {
+	switch {
+	case p.returned[sym]:
+		return passReturn
+	case pointerSymbols[sym] > 0:
+		return passPointer
+	}
+	return passValue
+}
+
+// Orders, renames and chooses passing of the parameters of the extracted code, as spec says;
+// parameters, which are not mentioned in spec, follow in the inferred order and are passed the inferred way.
+// pointerSymbols is changed for the parameters, which are passed by value or returned.
+func arrangeParameters(fset *token.FileSet, path []ast.Node, stmtList []ast.Stmt, params *st.SymbolTable, pointerSymbols map[st.Symbol]int, spec []*methodParamSpec, identMap st.IdentifierMap) (*methodParams, *errors.GoRefactorError) {
+	res := &methodParams{[]st.Symbol{}, make(map[st.Symbol]string), make(map[st.Symbol]bool), make(map[st.Symbol]bool)}
+	listed := make(map[st.Symbol]bool)
+	for _, p := range spec {
+		sym, ok := params.LookUp(p.name, "")
+		if !ok {
+			return nil, errors.ArgumentError("params", p.name+" is not a parameter of extracted code")
+		}
+		if listed[sym] {
+			return nil, errors.ArgumentError("params", "parameter "+p.name+" is listed twice")
+		}
+		listed[sym] = true
+		res.order = append(res.order, sym)
+		if p.newName != "" {
+			res.names[sym] = p.newName
+		}
+		switch p.mode {
+		case passPointer:
+			if pointerSymbols[sym] == 0 {
+				pointerSymbols[sym] = 1
+			}
+		case passValue, passReturn:
+			if _, changed := pointerSymbols[sym]; changed && p.mode == passValue {
+				if pos, used := getUseAfter(fset, path, stmtList, sym); used {
+					return nil, extractMethodError("extracted code changes " + p.name + ", which is used at " + pos + "; pass it by pointer or return it")
+				}
+				res.copied[sym] = true
+			}
+			pointerSymbols[sym] = 0, false
+			if p.mode == passReturn {
+				res.returned[sym] = true
+			}
+		}
+	}
+	params.ForEachNoLock(func(sym st.Symbol) {
+		if !listed[sym] {
+			res.order = append(res.order, sym)
+		}
+	})
+
+	// new names mustn't be captured by other symbols, used in the extracted code
+	for sym, name := range res.names {
+		for _, stmt := range stmtList {
+			for id, _ := range getIdentsInNode(stmt) {
+				if s, ok := identMap[id]; ok && id.Name == name && s != sym {
+					return nil, extractMethodError("new name of parameter " + sym.Name() + " conflicts with " + name + " at " + fset.Position(id.Pos()).String())
+				}
+			}
+		}
+	}
+	for i, a := range res.order {
+		for _, b := range res.order[i+1:] {
+			if res.name(a) == res.name(b) {
+				return nil, extractMethodError("parameters " + a.Name() + " and " + b.Name() + " would have the same name " + res.name(a))
+			}
+		}
+	}
+	return res, nil
+}
+
+// position of a use of the variable, that can see the value, assigned to it by the statements:
+// a use after them, or a use before them in a loop, that contains them and not the declaration of the variable
+func getUseAfter(fset *token.FileSet, path []ast.Node, stmtList []ast.Stmt, sym st.Symbol) (string, bool) {
+	start, end := stmtList[0].Pos(), stmtList[len(stmtList)-1].End()
+	decl := token.NoPos
+	for id, _ := range sym.Identifiers() {
+		if decl == token.NoPos || id.Pos() < decl {
+			decl = id.Pos()
+		}
+	}
+	loopStart := start
+outer:
+	for j := len(path) - 1; j >= 0; j-- {
+		switch t := path[j].(type) {
+		case *ast.FuncLit, *ast.FuncDecl:
+			break outer
+		case *ast.ForStmt:
+			if decl < t.Body.Pos() {
+				loopStart = t.Pos()
+			}
+		case *ast.RangeStmt:
+			if decl < t.Body.Pos() {
+				loopStart = t.Pos()
+			}
+		}
+	}
+	for id, _ := range sym.Identifiers() {
+		if id.Pos() >= end || id.Pos() != decl && id.Pos() >= loopStart && id.Pos() < start {
+			return fset.Position(id.Pos()).String(), true
+		}
+	}
+	return "", false
+}
+
+// prints the signature of the extracted method and it's call as text or json
+func printMethodSignature(format string, recv string, methodName string, p *methodParams, paramTypes []string, pointerSymbols map[st.Symbol]int, results []string, call string) {
+	params := []string{}
+	for i, sym := range p.order {
+		params = append(params, p.name(sym)+" "+paramTypes[i])
+	}
+	resultText := strings.Join(results, ", ")
+	if len(results) > 1 {
+		resultText = "(" + resultText + ")"
+	}
+	if format != "json" {
+		sig := "func " + recv + methodName + "(" + strings.Join(params, ", ") + ")"
+		if resultText != "" {
+			sig += " " + resultText
+		}
+		fmt.Println(sig)
+		fmt.Println("call: " + call)
+		return
+	}
+	quoted := []string{}
+	for _, r := range results {
+		quoted = append(quoted, strconv.Quote(r))
+	}
+	if recv != "" {
+		recv = recv[1 : len(recv)-2]
+	}
+	params = []string{}
+	for i, sym := range p.order {
+		params = append(params, "{\"name\": "+strconv.Quote(p.name(sym))+", \"variable\": "+strconv.Quote(sym.Name())+", \"type\": "+strconv.Quote(paramTypes[i])+", \"mode\": "+strconv.Quote(p.mode(sym, pointerSymbols))+"}")
+	}
+	fmt.Printf("{\"name\": %s, \"reciever\": %s, \"params\": [%s], \"results\": [%s], \"call\": %s}\n",
+		strconv.Quote(methodName), strconv.Quote(recv), strings.Join(params, ", "), strings.Join(quoted, ", "), strconv.Quote(call))
+}
@@ -0,0 +1,933 @@
+package refactoring
+
+import (
+	"refactoring/st"
+	"refactoring/utils"
+	"refactoring/errors"
+	"refactoring/program"
+	"refactoring/packageParser"
+	"go/ast"
+	"go/token"
+	"io/ioutil"
+)
+
+// finds the expression with given bounds and the path of nodes from the file to it
+type exprPathVisitor struct {
+	fset       *token.FileSet
+	start, end token.Position
+	path       []ast.Node
+	result     *[]ast.Node
+}
+
+func (v *exprPathVisitor) Visit(node ast.Node) ast.Visitor {
+	if node == nil || *v.result != nil {
+		return nil
+	}
+	pos, end := v.fset.Position(node.Pos()), v.fset.Position(node.End())
+	if utils.ComparePosWithinFile(pos, v.start) > 0 || utils.ComparePosWithinFile(end, v.end) < 0 {
+		return nil
+	}
+	path := appendToPath(v.path, node)
+	if _, ok := node.(ast.Expr); ok && utils.ComparePosWithinFile(pos, v.start) == 0 && utils.ComparePosWithinFile(end, v.end) == 0 {
+		*v.result = path
+		return nil
+	}
+	return &exprPathVisitor{v.fset, v.start, v.end, path, v.result}
+}
+
+func appendToPath(path []ast.Node, node ast.Node) []ast.Node {
+	res := make([]ast.Node, len(path)+1)
+	copy(res, path)
+	res[len(path)] = node
+	return res
+}
+
+// finds expressions, structurally identical to target
+type sameExprVisitor struct {
+	identMap st.IdentifierMap
+	target   ast.Expr
+	path     []ast.Node
+	result   *[][]ast.Node
+}
+
+func (v *sameExprVisitor) Visit(node ast.Node) ast.Visitor {
+	if node == nil || node == v.target {
+		return nil
+	}
+	path := appendToPath(v.path, node)
+	if e, ok := node.(ast.Expr); ok && sameExpr(v.identMap, v.target, e) {
+		*v.result = append(*v.result, path)
+		return nil
+	}
+	return &sameExprVisitor{v.identMap, v.target, path, v.result}
+}
+
+// structural equality of expressions; identifiers must denote the same symbols
+func sameExpr(identMap st.IdentifierMap, a ast.Expr, b ast.Expr) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	switch x := a.(type) {
+	case *ast.Ident:
+		y, ok := b.(*ast.Ident)
+		return ok && x.Name == y.Name && identMap[x] == identMap[y]
+	case *ast.BasicLit:
+		y, ok := b.(*ast.BasicLit)
+		return ok && x.Kind == y.Kind && string(x.Value) == string(y.Value)
+	case *ast.ParenExpr:
+		y, ok := b.(*ast.ParenExpr)
+		return ok && sameExpr(identMap, x.X, y.X)
+	case *ast.UnaryExpr:
+		y, ok := b.(*ast.UnaryExpr)
+		return ok && x.Op == y.Op && sameExpr(identMap, x.X, y.X)
+	case *ast.BinaryExpr:
+		y, ok := b.(*ast.BinaryExpr)
+		return ok && x.Op == y.Op && sameExpr(identMap, x.X, y.X) && sameExpr(identMap, x.Y, y.Y)
+	case *ast.SelectorExpr:
+		y, ok := b.(*ast.SelectorExpr)
+		return ok && sameExpr(identMap, x.X, y.X) && sameExpr(identMap, x.Sel, y.Sel)
+	case *ast.StarExpr:
+		y, ok := b.(*ast.StarExpr)
+		return ok && sameExpr(identMap, x.X, y.X)
+	case *ast.ArrayType:
+		y, ok := b.(*ast.ArrayType)
+		return ok && sameExpr(identMap, x.Len, y.Len) && sameExpr(identMap, x.Elt, y.Elt)
+	case *ast.CallExpr:
+		y, ok := b.(*ast.CallExpr)
+		if !ok || len(x.Args) != len(y.Args) || (x.Ellipsis == token.NoPos) != (y.Ellipsis == token.NoPos) || !sameExpr(identMap, x.Fun, y.Fun) {
+			return false
+		}
+		for i, arg := range x.Args {
+			if !sameExpr(identMap, arg, y.Args[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func isTypeSymbol(sym st.Symbol) bool {
+	_, isType := sym.(st.ITypeSymbol)
+	_, isPack := sym.(*st.PackageSymbol)
+	return isType && !isPack
+}
+
+func isMethodSymbol(sym st.Symbol) bool {
+	f, ok := sym.(*st.FunctionSymbol)
+	if !ok || f.FunctionType == nil {
+		return false
+	}
+	if f.IsInterfaceMethod {
+		return true
+	}
+	bt, _ := st.GetBaseType(f.FunctionType)
+	ft, ok := bt.(*st.FunctionTypeSymbol)
+	return ok && ft.Reciever != nil && ft.Reciever.Count() > 0
+}
+
+func isTypeExpr(identMap st.IdentifierMap, e ast.Expr) bool {
+	switch t := e.(type) {
+	case *ast.Ident:
+		return isTypeSymbol(identMap[t])
+	case *ast.SelectorExpr:
+		return isTypeSymbol(identMap[t.Sel])
+	case *ast.ParenExpr:
+		return isTypeExpr(identMap, t.X)
+	case *ast.StarExpr:
+		return isTypeExpr(identMap, t.X)
+	case *ast.ArrayType, *ast.MapType, *ast.ChanType, *ast.FuncType, *ast.StructType, *ast.InterfaceType, *ast.Ellipsis:
+		return true
+	}
+	return false
+}
+
+// builtin functions without side effects, that give the same result for the same arguments
+var pureBuiltins map[string]bool = map[string]bool{"len": true, "cap": true, "real": true, "imag": true, "complex": true}
+
+var noResultBuiltins map[string]bool = map[string]bool{"close": true, "panic": true, "print": true, "println": true}
+
+func isPureCall(identMap st.IdentifierMap, call *ast.CallExpr) bool {
+	if isTypeExpr(identMap, call.Fun) {
+		return true
+	}
+	if id, ok := call.Fun.(*ast.Ident); ok && pureBuiltins[id.Name] {
+		return identMap[id] == nil || identMap[id] == st.Symbol(st.PredeclaredFunctions[id.Name])
+	}
+	return false
+}
+
+// looks for calls and receive operations; function literals are not evaluated, so they are skipped
+type sideEffectsVisitor struct {
+	identMap st.IdentifierMap
+	found    bool
+}
+
+func (v *sideEffectsVisitor) Visit(node ast.Node) ast.Visitor {
+	if v.found {
+		return nil
+	}
+	switch t := node.(type) {
+	case *ast.FuncLit:
+		return nil
+	case *ast.CallExpr:
+		if !isPureCall(v.identMap, t) {
+			v.found = true
+		}
+	case *ast.UnaryExpr:
+		if t.Op == token.ARROW {
+			v.found = true
+		}
+	}
+	return v
+}
+
+func hasSideEffects(identMap st.IdentifierMap, node ast.Node) bool {
+	v := &sideEffectsVisitor{identMap, false}
+	ast.Walk(v, node)
+	return v.found
+}
+
+// looks for side effects in the part of statement, that is evaluated before the expression
+type evaluatedBeforeVisitor struct {
+	identMap st.IdentifierMap
+	expr     ast.Expr
+	found    bool
+}
+
+func (v *evaluatedBeforeVisitor) Visit(node ast.Node) ast.Visitor {
+	if node == nil || v.found || node == v.expr || node.Pos() >= v.expr.Pos() {
+		return nil
+	}
+	if node.End() <= v.expr.Pos() {
+		v.found = hasSideEffects(v.identMap, node)
+		return nil
+	}
+	if _, ok := node.(*ast.FuncLit); ok {
+		return nil
+	}
+	return v
+}
+
+type readsVariablesVisitor struct {
+	identMap st.IdentifierMap
+	found    bool
+}
+
+func (v *readsVariablesVisitor) Visit(node ast.Node) ast.Visitor {
+	if id, ok := node.(*ast.Ident); ok {
+		if sym, ok := v.identMap[id].(*st.VariableSymbol); ok && !isPredeclaredConst(sym) {
+			v.found = true
+		}
+	}
+	return v
+}
+
+func isPredeclaredConst(sym st.Symbol) bool {
+	for _, c := range st.PredeclaredConsts {
+		if st.Symbol(c) == sym {
+			return true
+		}
+	}
+	return false
+}
+
+// identifier, that denotes the variable, which is changed when the location is assigned
+func locationRoot(e ast.Expr) *ast.Ident {
+	for {
+		switch t := e.(type) {
+		case *ast.Ident:
+			return t
+		case *ast.ParenExpr:
+			e = t.X
+		case *ast.SelectorExpr:
+			e = t.X
+		case *ast.IndexExpr:
+			e = t.X
+		default:
+			return nil
+		}
+	}
+	panic("unreachable")
+}
+
+// true if expression at the end of path is (a part of) a location, that is assigned or addressed,
+// so it can't be replaced with a copy of it's value
+func isAssignedLocation(programTree *program.Program, pack *st.Package, filename string, path []ast.Node) bool {
+	cur := path[len(path)-1]
+	for j := len(path) - 2; j >= 0; j-- {
+		switch p := path[j].(type) {
+		case *ast.ParenExpr:
+		case *ast.IndexExpr:
+			if p.X != cur {
+				return false
+			}
+		case *ast.SelectorExpr:
+			if p.X != cur {
+				return false
+			}
+			if isMethodSymbol(programTree.IdentMap[p.Sel]) {
+				_, isPointer := packageParser.ParseExpr(p.X, pack, filename, programTree.IdentMap).(*st.PointerTypeSymbol)
+				return !isPointer
+			}
+		case *ast.SliceExpr:
+			return p.X == cur
+		case *ast.UnaryExpr:
+			return p.Op == token.AND
+		case *ast.IncDecStmt:
+			return true
+		case *ast.AssignStmt:
+			for _, l := range p.Lhs {
+				if l == cur {
+					return true
+				}
+			}
+			return false
+		case *ast.RangeStmt:
+			return p.Key == cur || p.Value == cur
+		default:
+			return false
+		}
+		cur = path[j]
+	}
+	return false
+}
+
+// a write to a variable
+type variableWrite struct {
+	sym st.Symbol
+	pos token.Pos
+}
+
+// collects writes to variables and variables, that can be changed through pointers or in closures
+type writesVisitor struct {
+	identMap  st.IdentifierMap
+	inClosure bool
+	writes    *[]*variableWrite
+	aliased   map[st.Symbol]bool
+	loops     *[]ast.Node
+}
+
+func (v *writesVisitor) write(e ast.Expr, pos token.Pos) {
+	if id := locationRoot(e); id != nil {
+		if sym, ok := v.identMap[id]; ok && sym != nil {
+			if v.inClosure {
+				v.aliased[sym] = true
+			}
+			*v.writes = append(*v.writes, &variableWrite{sym, pos})
+		}
+	}
+}
+
+func (v *writesVisitor) alias(e ast.Expr) {
+	if id := locationRoot(e); id != nil {
+		if sym, ok := v.identMap[id]; ok && sym != nil {
+			v.aliased[sym] = true
+		}
+	}
+}
+
+func (v *writesVisitor) Visit(node ast.Node) ast.Visitor {
+	switch t := node.(type) {
+	case *ast.FuncLit:
+		return &writesVisitor{v.identMap, true, v.writes, v.aliased, v.loops}
+	case *ast.AssignStmt:
+		for _, l := range t.Lhs {
+			v.write(l, t.End())
+		}
+	case *ast.IncDecStmt:
+		v.write(t.X, t.End())
+	case *ast.RangeStmt:
+		*v.loops = append(*v.loops, t)
+		v.write(t.Key, t.Pos())
+		if t.Value != nil {
+			v.write(t.Value, t.Pos())
+		}
+	case *ast.ForStmt:
+		*v.loops = append(*v.loops, t)
+	case *ast.UnaryExpr:
+		if t.Op == token.AND {
+			v.alias(t.X)
+		}
+	case *ast.SliceExpr:
+		v.alias(t.X)
+	case *ast.SelectorExpr:
+		if isMethodSymbol(v.identMap[t.Sel]) {
+			v.alias(t.X)
+		}
+	}
+	return v
+}
+
+// collects identifiers, declared as constants
+type constIdentsVisitor struct {
+	idents map[*ast.Ident]bool
+}
+
+func (v *constIdentsVisitor) Visit(node ast.Node) ast.Visitor {
+	if gd, ok := node.(*ast.GenDecl); ok && gd.Tok == token.CONST {
+		for _, s := range gd.Specs {
+			for _, id := range s.(*ast.ValueSpec).Names {
+				v.idents[id] = true
+			}
+		}
+	}
+	return v
+}
+
+// checks, that expression has no side effects and it's value can be changed only by an assignment
+// to a local variable it uses
+type pureExprVisitor struct {
+	programTree *program.Program
+	pack        *st.Package
+	filename    string
+	isLocal     func(sym st.Symbol) bool
+	consts      map[*st.Package]map[*ast.Ident]bool
+	vars        map[st.Symbol]bool //local variables, used in the expression
+	pure        bool
+}
+
+func (v *pureExprVisitor) isConst(sym st.Symbol) bool {
+	if isPredeclaredConst(sym) {
+		return true
+	}
+	p := sym.PackageFrom()
+	if p == nil || p.AstPackage == nil {
+		return false
+	}
+	if _, ok := v.consts[p]; !ok {
+		cv := &constIdentsVisitor{make(map[*ast.Ident]bool)}
+		for _, file := range p.AstPackage.Files {
+			ast.Walk(cv, file)
+		}
+		v.consts[p] = cv.idents
+	}
+	for id, _ := range sym.Identifiers() {
+		if _, ok := v.consts[p][id]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (v *pureExprVisitor) Visit(node ast.Node) ast.Visitor {
+	if node == nil || !v.pure {
+		return nil
+	}
+	identMap := v.programTree.IdentMap
+	switch t := node.(type) {
+	case *ast.BasicLit, *ast.ParenExpr, *ast.BinaryExpr:
+	case *ast.UnaryExpr:
+		if t.Op == token.ARROW || t.Op == token.AND {
+			v.pure = false
+		}
+	case *ast.Ident:
+		sym := identMap[t]
+		switch {
+		case sym == nil:
+			v.pure = false
+		case isTypeSymbol(sym) || isPackageSymbol(sym) || v.isConst(sym):
+		case v.isLocal(sym):
+			v.vars[sym] = true
+		default:
+			v.pure = false
+		}
+	case *ast.SelectorExpr:
+		if id, ok := t.X.(*ast.Ident); ok && isPackageSymbol(identMap[id]) {
+			return v
+		}
+		if _, ok := packageParser.ParseExpr(t.X, v.pack, v.filename, identMap).(*st.PointerTypeSymbol); ok || isMethodSymbol(identMap[t.Sel]) {
+			v.pure = false
+			return nil
+		}
+		ast.Walk(v, t.X)
+		return nil
+	case *ast.CallExpr:
+		if !isPureCall(identMap, t) || t.Ellipsis != token.NoPos {
+			v.pure = false
+			return nil
+		}
+		for _, arg := range t.Args {
+			ast.Walk(v, arg)
+		}
+		return nil
+	default:
+		v.pure = false
+	}
+	return v
+}
+
+func CheckExtractVariableParameters(filename string, lineStart int, colStart int, lineEnd int, colEnd int, varName string) (bool, *errors.GoRefactorError) {
+	switch {
+	case filename == "" || !utils.IsGoFile(filename):
+		return false, errors.ArgumentError("filename", "It's not a valid go file name")
+	case lineStart < 1:
+		return false, errors.ArgumentError("lineStart", "Must be > 1")
+	case lineEnd < 1 || lineEnd < lineStart:
+		return false, errors.ArgumentError("lineEnd", "Must be > 1 and >= lineStart")
+	case colStart < 1:
+		return false, errors.ArgumentError("colStart", "Must be > 1")
+	case colEnd < 1:
+		return false, errors.ArgumentError("colEnd", "Must be > 1")
+	case !IsGoIdent(varName):
+		return false, errors.ArgumentError("varName", "It's not a valid go identifier")
+	}
+	return true, nil
+}
+
+// Extracts expression to a local variable, declared right before the statement, that contains it;
+// start position - where the expression starts;
+// end position - where the expression ends.
+// If replaceAll is set, identical occurrences of the expression in the rest of the block are replaced too
+func ExtractVariable(filename string, lineStart int, colStart int, lineEnd int, colEnd int, varName string, replaceAll bool) (bool, *errors.GoRefactorError) {
+	if ok, err := CheckExtractVariableParameters(filename, lineStart, colStart, lineEnd, colEnd, varName); !ok {
+		return false, err
+	}
+	programTree := parseProgram(filename)
+	edits, err := extractVariable(programTree, filename, lineStart, colStart, lineEnd, colEnd, varName, replaceAll)
+	if err != nil {
+		return false, err
+	}
+	if err := applyFileEdits(programTree, map[string][]*fileEdit{filename: edits}); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func extractVariableError(message string) *errors.GoRefactorError {
+	return &errors.GoRefactorError{ErrorType: "extract variable error", Message: message}
+}
+
+// index of the innermost statement on the path, that belongs to a statement list;
+// statements of the list are returned
+func getEnclosingStatement(path []ast.Node) (int, []ast.Stmt) {
+	for i := len(path) - 2; i > 0; i-- {
+		stmt, ok := path[i].(ast.Stmt)
+		if !ok {
+			continue
+		}
+		var list []ast.Stmt
+		switch t := path[i-1].(type) {
+		case *ast.BlockStmt:
+			if i >= 2 {
+				switch path[i-2].(type) {
+				case *ast.SwitchStmt, *ast.TypeSwitchStmt, *ast.SelectStmt:
+					continue
+				}
+			}
+			list = t.List
+		case *ast.CaseClause:
+			list = t.Body
+		case *ast.CommClause:
+			list = t.Body
+		default:
+			continue
+		}
+		if _, found := getIndexOfStmt(stmt, list); found {
+			return i, list
+		}
+	}
+	return -1, nil
+}
+
+// true if expression at the end of path is evaluated conditionally or repeatedly within the statement path[s]
+func isEvaluatedConditionally(path []ast.Node, s int) bool {
+	for j := s; j < len(path)-1; j++ {
+		child := path[j+1]
+		switch p := path[j].(type) {
+		case *ast.BinaryExpr:
+			if (p.Op == token.LAND || p.Op == token.LOR) && ast.Node(p.Y) == child {
+				return true
+			}
+		case *ast.ForStmt:
+			if ast.Node(p.Cond) == child || ast.Node(p.Post) == child {
+				return true
+			}
+		case *ast.IfStmt:
+			if ast.Node(p.Else) == child {
+				return true
+			}
+		case *ast.CaseClause, *ast.CommClause:
+			return true
+		}
+	}
+	return false
+}
+
+// checks, that selected expression denotes a value, which can be stored in a variable
+func checkExtractableExpr(programTree *program.Program, path []ast.Node) *errors.GoRefactorError {
+	identMap := programTree.IdentMap
+	expr := path[len(path)-1].(ast.Expr)
+	parent := path[len(path)-2]
+	if isTypeExpr(identMap, expr) {
+		return extractVariableError("selected expression is a type")
+	}
+	switch t := expr.(type) {
+	case *ast.Ident:
+		sym := identMap[t]
+		switch {
+		case sym == nil || t.Name == "_":
+			return extractVariableError("selected identifier doesn't denote a value")
+		case isPackageSymbol(sym):
+			return extractVariableError("selected identifier is a package name")
+		case sym == st.Symbol(st.PredeclaredConsts["nil"]):
+			return extractVariableError("can't extract untyped nil")
+		}
+		if f, ok := sym.(*st.FunctionSymbol); ok && st.PredeclaredFunctions[f.Name()] == f {
+			return extractVariableError("builtin function can't be used as a value")
+		}
+	case *ast.SelectorExpr:
+		if isMethodSymbol(identMap[t.Sel]) {
+			return extractVariableError("selected expression is a method, bound to a value")
+		}
+	case *ast.KeyValueExpr:
+		return extractVariableError("selected expression is a key-value pair")
+	case *ast.TypeAssertExpr:
+		if t.Type == nil {
+			return extractVariableError("can't extract type switch guard")
+		}
+	case *ast.CompositeLit:
+		if t.Type == nil {
+			return extractVariableError("composite literal has no type")
+		}
+	case *ast.CallExpr:
+		var fsym st.Symbol
+		switch f := t.Fun.(type) {
+		case *ast.Ident:
+			fsym = identMap[f]
+		case *ast.SelectorExpr:
+			fsym = identMap[f.Sel]
+		}
+		if f, ok := fsym.(*st.FunctionSymbol); ok && f.FunctionType != nil {
+			if st.PredeclaredFunctions[f.Name()] == f {
+				if _, ok := noResultBuiltins[f.Name()]; ok {
+					return extractVariableError("called function has no result")
+				}
+			} else {
+				bt, _ := st.GetBaseType(f.FunctionType)
+				if ft, ok := bt.(*st.FunctionTypeSymbol); ok && ft.Results.Count() != 1 {
+					return extractVariableError("called function doesn't return exactly one value")
+				}
+			}
+		}
+	}
+	switch p := parent.(type) {
+	case *ast.SelectorExpr:
+		if p.Sel == expr {
+			return extractVariableError("selected identifier is a field or method name")
+		}
+	case *ast.KeyValueExpr:
+		if id, ok := expr.(*ast.Ident); ok && p.Key == expr && identMap[id] != nil {
+			_, members := getMemberIdents(programTree)
+			for mid, _ := range identMap[id].Identifiers() {
+				if _, ok := members[mid]; ok {
+					return extractVariableError("selected identifier is a field name")
+				}
+			}
+		}
+	case *ast.ExprStmt:
+		return extractVariableError("selected expression is a statement")
+	case *ast.LabeledStmt, *ast.BranchStmt:
+		return extractVariableError("selected identifier is a label")
+	}
+	return nil
+}
+
+// checks, that varName can be declared before the statement without conflicts
+func checkVariableName(fset *token.FileSet, path []ast.Node, s int, list []ast.Stmt, varName string) *errors.GoRefactorError {
+	names := make(map[string]bool)
+	if s >= 2 {
+		var ftype *ast.FuncType
+		switch f := path[s-2].(type) {
+		case *ast.FuncDecl:
+			if f.Body == path[s-1] {
+				ftype = f.Type
+				if f.Recv != nil {
+					for _, fld := range f.Recv.List {
+						for _, id := range fld.Names {
+							names[id.Name] = true
+						}
+					}
+				}
+			}
+		case *ast.FuncLit:
+			if f.Body == path[s-1] {
+				ftype = f.Type
+			}
+		}
+		if ftype != nil {
+			for _, fl := range []*ast.FieldList{ftype.Params, ftype.Results} {
+				if fl == nil {
+					continue
+				}
+				for _, fld := range fl.List {
+					for _, id := range fld.Names {
+						names[id.Name] = true
+					}
+				}
+			}
+		}
+	}
+	if s >= 3 {
+		if ts, ok := path[s-3].(*ast.TypeSwitchStmt); ok {
+			if as, ok := ts.Assign.(*ast.AssignStmt); ok {
+				for _, id := range as.Lhs {
+					names[id.(*ast.Ident).Name] = true
+				}
+			}
+		}
+	}
+	if _, ok := names[varName]; ok {
+		return extractVariableError("name " + varName + " is already declared in the enclosing function or clause")
+	}
+	for _, stmt := range list {
+		for id, _ := range getIdentsInNode(stmt) {
+			if id.Name == varName {
+				return extractVariableError("name " + varName + " is already used in the block at " + fset.Position(id.Pos()).String())
+			}
+		}
+	}
+	return nil
+}
+
+type gotosVisitor struct {
+	labels map[string]bool
+	found  bool
+}
+
+func (v *gotosVisitor) Visit(node ast.Node) ast.Visitor {
+	if b, ok := node.(*ast.BranchStmt); ok && b.Tok == token.GOTO && b.Label != nil {
+		if _, ok := v.labels[b.Label.Name]; ok {
+			v.found = true
+		}
+	}
+	return v
+}
+
+// goto statements, that would jump over the new variable declaration
+func checkGotos(list []ast.Stmt, ind int) *errors.GoRefactorError {
+	labels := make(map[string]bool)
+	for _, stmt := range list[ind+1:] {
+		if l, ok := stmt.(*ast.LabeledStmt); ok {
+			labels[l.Label.Name] = true
+		}
+	}
+	gv := &gotosVisitor{labels, false}
+	for _, stmt := range list[:ind] {
+		ast.Walk(gv, stmt)
+	}
+	if gv.found {
+		return extractVariableError("goto statement would jump over the declaration of the variable")
+	}
+	return nil
+}
+
+func extractVariable(programTree *program.Program, filename string, lineStart int, colStart int, lineEnd int, colEnd int, varName string, replaceAll bool) ([]*fileEdit, *errors.GoRefactorError) {
+	pack, file := programTree.FindPackageAndFileByFilename(filename)
+	if pack == nil {
+		return nil, errors.ArgumentError("filename", "Program packages don't contain file '"+filename+"'")
+	}
+	fset := pack.FileSet
+	identMap := programTree.IdentMap
+
+	var path []ast.Node
+	ast.Walk(&exprPathVisitor{fset, token.Position{filename, 0, lineStart, colStart}, token.Position{filename, 0, lineEnd, colEnd}, nil, &path}, file)
+	if path == nil {
+		return nil, extractVariableError("there is no expression with such bounds")
+	}
+	expr := path[len(path)-1].(ast.Expr)
+	if err := checkExtractableExpr(programTree, path); err != nil {
+		return nil, err
+	}
+
+	s, list := getEnclosingStatement(path)
+	if s == -1 {
+		return nil, extractVariableError("expression is not inside of a function body")
+	}
+	stmt := path[s].(ast.Stmt)
+	ind, _ := getIndexOfStmt(stmt, list)
+	if _, ok := stmt.(*ast.LabeledStmt); ok {
+		return nil, extractVariableError("enclosing statement is labeled")
+	}
+	if isEvaluatedConditionally(path, s) {
+		return nil, extractVariableError("expression is evaluated conditionally or repeatedly; moving it before the statement would change the behaviour")
+	}
+	if isAssignedLocation(programTree, pack, filename, path) {
+		return nil, extractVariableError("expression is assigned or addressed; it can't be replaced with a copy of it's value")
+	}
+	bv := &evaluatedBeforeVisitor{identMap, expr, false}
+	ast.Walk(bv, stmt)
+	if bv.found {
+		rv := &readsVariablesVisitor{identMap, false}
+		ast.Walk(rv, expr)
+		if rv.found || hasSideEffects(identMap, expr) {
+			return nil, extractVariableError("part of the statement, evaluated before the expression, has side effects; evaluation order would change")
+		}
+	}
+	for id, _ := range getIdentsInNode(expr) {
+		sym := identMap[id]
+		if sym == nil || isPackageSymbol(sym) {
+			continue
+		}
+		if decl, f := getFirstIdent(fset, sym); decl != nil && f == filename && decl.Pos() >= stmt.Pos() && decl.Pos() < stmt.End() && (decl.Pos() < expr.Pos() || decl.Pos() >= expr.End()) {
+			return nil, extractVariableError("expression uses " + sym.Name() + ", declared in the enclosing statement at " + fset.Position(decl.Pos()).String())
+		}
+	}
+	if err := checkVariableName(fset, path, s, list, varName); err != nil {
+		return nil, err
+	}
+	if err := checkGotos(list, ind); err != nil {
+		return nil, err
+	}
+
+	content, rerr := ioutil.ReadFile(filename)
+	if rerr != nil {
+		return nil, extractVariableError("couldn't read file " + filename + ": " + rerr.String())
+	}
+	offset := func(pos token.Pos) int {
+		return fset.Position(pos).Offset
+	}
+	exprs := [][]ast.Node{path}
+	if replaceAll {
+		occs, err := getSameExpressions(programTree, pack, filename, path, s, list[ind:])
+		if err != nil {
+			return nil, err
+		}
+		exprs = append(exprs, occs...)
+	}
+
+	start := offset(stmt.Pos())
+	lineStart := start
+	for lineStart > 0 && (content[lineStart-1] == ' ' || content[lineStart-1] == '\t') {
+		lineStart--
+	}
+	indent := ""
+	if lineStart == 0 || content[lineStart-1] == '\n' {
+		indent = string(content[lineStart:start])
+	}
+	exprText := string(content[offset(expr.Pos()):offset(expr.End())])
+	declText := varName + " := " + exprText
+	// untyped constant expression gets the type of it's context, if it differs from the default one
+	pv := &pureExprVisitor{programTree, pack, filename, func(st.Symbol) bool { return false }, make(map[*st.Package]map[*ast.Ident]bool), make(map[st.Symbol]bool), true}
+	if isConstantExpr(pv, expr) {
+		defaultName := ""
+		if defaultType := getDefaultType(programTree, pack, filename, expr); defaultType != nil {
+			defaultName = defaultType.Name()
+		}
+		typeName := ""
+		for i, p := range exprs {
+			name, ok := constTypeName(pack, filename, getUseType(programTree, pack, filename, pv, p))
+			if !ok {
+				name = defaultName
+			}
+			if i > 0 && name != typeName {
+				return nil, extractVariableError("occurrences of the expression are used as values of different types")
+			}
+			typeName = name
+		}
+		if typeName != "" && typeName != defaultName {
+			declText = "var " + varName + " " + typeName + " = " + exprText
+		}
+	}
+	edits := []*fileEdit{&fileEdit{start, start, declText + "\n" + indent}}
+	for _, p := range exprs {
+		e := p[len(p)-1]
+		edits = append(edits, &fileEdit{offset(e.Pos()), offset(e.End()), varName})
+	}
+	return edits, nil
+}
+
+type identsVisitor struct {
+	idents map[*ast.Ident]bool
+}
+
+func (v *identsVisitor) Visit(node ast.Node) ast.Visitor {
+	if id, ok := node.(*ast.Ident); ok {
+		v.idents[id] = true
+	}
+	return v
+}
+
+func getIdentsInNode(node ast.Node) map[*ast.Ident]bool {
+	v := &identsVisitor{make(map[*ast.Ident]bool)}
+	ast.Walk(v, node)
+	return v.idents
+}
+
+// occurrences of the expression in statements, that can be replaced with the new variable:
+// there must be no assignments to variables, used in the expression, between it's declaration and occurrence
+func getSameExpressions(programTree *program.Program, pack *st.Package, filename string, path []ast.Node, s int, stmts []ast.Stmt) ([][]ast.Node, *errors.GoRefactorError) {
+	identMap := programTree.IdentMap
+	expr := path[len(path)-1].(ast.Expr)
+	stmt := path[s]
+
+	var fn ast.Node
+	for _, n := range path {
+		switch n.(type) {
+		case *ast.FuncDecl, *ast.FuncLit:
+			fn = n
+		}
+		if fn != nil {
+			break
+		}
+	}
+	writes, loops := []*variableWrite{}, []ast.Node{}
+	wv := &writesVisitor{identMap, false, &writes, make(map[st.Symbol]bool), &loops}
+	ast.Walk(wv, fn)
+
+	isLocal := func(sym st.Symbol) bool {
+		if _, ok := sym.(*st.VariableSymbol); !ok {
+			return false
+		}
+		if _, ok := wv.aliased[sym]; ok {
+			return false
+		}
+		decl, f := getFirstIdent(pack.FileSet, sym)
+		return decl != nil && f == filename && decl.Pos() >= fn.Pos() && decl.Pos() < fn.End()
+	}
+	pv := &pureExprVisitor{programTree, pack, filename, isLocal, make(map[*st.Package]map[*ast.Ident]bool), make(map[st.Symbol]bool), true}
+	ast.Walk(pv, expr)
+	if !pv.pure {
+		return nil, extractVariableError("expression has side effects or depends on values, that may be changed not only by assignments to local variables; it's occurrences can't be replaced")
+	}
+
+	// writes in loops, that follow the declaration, may precede occurrences in the next iteration
+	firstWrite := fn.End()
+	for _, w := range writes {
+		if _, ok := pv.vars[w.sym]; !ok {
+			continue
+		}
+		pos := w.pos
+		for _, l := range loops {
+			if l.Pos() >= stmt.Pos() && l.Pos() <= w.pos && w.pos < l.End() && l.Pos() < pos {
+				pos = l.Pos()
+			}
+		}
+		if pos >= stmt.Pos() && pos < firstWrite {
+			firstWrite = pos
+		}
+	}
+
+	found := [][]ast.Node{}
+	for _, stm := range stmts {
+		ast.Walk(&sameExprVisitor{identMap, expr, path[:s], &found}, stm)
+	}
+	res := [][]ast.Node{}
+	for _, p := range found {
+		e := p[len(p)-1]
+		if e.Pos() >= firstWrite {
+			continue
+		}
+		inClosure := false
+		for _, n := range p[s:] {
+			if _, ok := n.(*ast.FuncLit); ok {
+				inClosure = true
+			}
+		}
+		if inClosure || isAssignedLocation(programTree, pack, filename, p) || checkExtractableExpr(programTree, p) != nil {
+			continue
+		}
+		res = append(res, p)
+	}
+	return res, nil
+}
@@ -0,0 +1,187 @@
+package refactoring
+
+import (
+	"refactoring/st"
+	"refactoring/errors"
+	"refactoring/program"
+	"go/ast"
+)
+
+// calls of the function and all identifiers, that denote it
+type functionUsesVisitor struct {
+	identMap st.IdentifierMap
+	sym      st.Symbol
+	calls    map[*ast.Ident]*ast.CallExpr
+	uses     []*ast.Ident
+}
+
+func (v *functionUsesVisitor) Visit(node ast.Node) ast.Visitor {
+	switch t := node.(type) {
+	case *ast.CallExpr:
+		switch f := t.Fun.(type) {
+		case *ast.Ident:
+			v.calls[f] = t
+		case *ast.SelectorExpr:
+			// method expression T.m(x) passes the reciever as an argument, it's not a call to inline
+			if !isTypeExpr(v.identMap, f.X) {
+				v.calls[f.Sel] = t
+			}
+		}
+	case *ast.Ident:
+		if v.identMap[t] == v.sym {
+			v.uses = append(v.uses, t)
+		}
+	}
+	return v
+}
+
+// call to inline and the file, that contains it
+type inlinedCall struct {
+	pack     *st.Package
+	filename string
+	file     *ast.File
+	call     *ast.CallExpr
+}
+
+func CheckInlineAllParameters(filename string, line int, column int) (bool, *errors.GoRefactorError) {
+	if err := checkPositionParameters(filename, line, column); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Inlines every call of the function or method, pointed by position, in the program
+// and removes it's declaration. The refactoring is refused if the function is used as a value.
+func InlineAll(filename string, line int, column int) (bool, *errors.GoRefactorError) {
+	if ok, err := CheckInlineAllParameters(filename, line, column); !ok {
+		return false, err
+	}
+	programTree := parseProgram(filename)
+	edits, err := inlineAll(programTree, filename, line, column)
+	if err != nil {
+		return false, err
+	}
+	if err := applyFileEdits(programTree, edits); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// calls of the function in the program; fails, if it's used other way
+func getInlinedCalls(programTree *program.Program, ci *callInliner, funSym *st.FunctionSymbol) ([]*inlinedCall, *errors.GoRefactorError) {
+	calls := []*inlinedCall{}
+	for _, pack := range programTree.Packages {
+		if pack.IsGoPackage {
+			continue
+		}
+		for f, file := range pack.AstPackage.Files {
+			v := &functionUsesVisitor{programTree.IdentMap, funSym, make(map[*ast.Ident]*ast.CallExpr), nil}
+			ast.Walk(v, file)
+			fileCalls := []*inlinedCall{}
+			for _, id := range v.uses {
+				if id == ci.decl.Name {
+					continue
+				}
+				pos := pack.FileSet.Position(id.Pos()).String()
+				call, ok := v.calls[id]
+				switch {
+				case !ok:
+					return nil, inlineMethodError(funSym.Name() + " is used as a value at " + pos)
+				case ci.declIdents[id]:
+					return nil, inlineMethodError(funSym.Name() + " is called recursively at " + pos)
+				}
+				for _, other := range fileCalls {
+					if other.call.Pos() <= call.Pos() && call.End() <= other.call.End() || call.Pos() <= other.call.Pos() && other.call.End() <= call.End() {
+						return nil, inlineMethodError("call at " + pos + " is nested in another call of " + funSym.Name())
+					}
+				}
+				fileCalls = append(fileCalls, &inlinedCall{pack, f, file, call})
+			}
+			calls = append(calls, fileCalls...)
+		}
+	}
+	return calls, nil
+}
+
+func inlineAll(programTree *program.Program, filename string, line int, column int) (map[string][]*fileEdit, *errors.GoRefactorError) {
+	sym, err := programTree.FindSymbolByPosition(filename, line, column)
+	if err != nil {
+		return nil, err
+	}
+	funSym, ok := sym.(*st.FunctionSymbol)
+	if !ok {
+		return nil, inlineMethodError(sym.Name() + " is not a function or method")
+	}
+	if p := funSym.PackageFrom(); p == nil || p.IsGoPackage {
+		return nil, inlineMethodError("function " + funSym.Name() + " doesn't belong to the program")
+	}
+	ci, err := newCallInliner(programTree, funSym)
+	if err != nil {
+		return nil, err
+	}
+	calls, err := getInlinedCalls(programTree, ci, funSym)
+	if err != nil {
+		return nil, err
+	}
+	if ci.decl.Recv != nil {
+		if t := getMethodOwner(programTree, funSym); t != nil {
+			if found := getBrokenConversions(programTree, t, []*recieverTarget{&recieverTarget{funSym, ci.decl, ci.srcFilename}}); len(found) > 0 {
+				return nil, inlineMethodError("method " + funSym.Name() + " is needed to convert a value to an interface at " + found[0].String())
+			}
+		}
+	}
+
+	edits := make(map[string][]*fileEdit)
+	contents := make(fileContents)
+	imports := make(map[string]map[*st.Package]string)
+	kept := make(map[*st.Package]bool) //packages, the declaration's file refers to in inlined code
+	hoisted := make(map[ast.Node]*ast.CallExpr) //statements, before which bodies are moved, -> calls in them
+	for _, c := range calls {
+		if _, ok := contents[c.filename]; !ok {
+			imports[c.filename] = make(map[*st.Package]string)
+		}
+		content, err := contents.read(c.filename)
+		if err != nil {
+			return nil, err
+		}
+		path := getNodePath(c.pack.FileSet, c.file, c.call)
+		var callNode, nodeFrom ast.Node = c.call, nil
+		if s, ok := path[len(path)-2].(*ast.ExprStmt); ok {
+			callNode = s
+		}
+		for j := len(path) - 1; j >= 0 && nodeFrom == nil; j-- {
+			switch path[j].(type) {
+			case *ast.BlockStmt, *ast.CaseClause, *ast.CommClause:
+				nodeFrom = path[j]
+			}
+		}
+		es, err := ci.inlineCall(c.pack, c.file, c.filename, content, callNode, c.call, nodeFrom)
+		if err != nil {
+			return nil, inlineMethodError("call at " + c.pack.FileSet.Position(c.call.Pos()).String() + ": " + err.Message)
+		}
+		if ci.hoistedAt != nil {
+			if other, ok := hoisted[ci.hoistedAt]; ok {
+				return nil, inlineMethodError("calls at " + c.pack.FileSet.Position(other.Pos()).String() + " and " + c.pack.FileSet.Position(c.call.Pos()).String() + " are in the same statement")
+			}
+			hoisted[ci.hoistedAt] = c.call
+		}
+		edits[c.filename] = append(edits[c.filename], es...)
+		for p, _ := range ci.newImports {
+			imports[c.filename][p] = ci.qualifiers[p]
+		}
+		if c.filename == ci.srcFilename {
+			for p, _ := range ci.qualifiers {
+				kept[p] = true
+			}
+		}
+	}
+	for f, imps := range imports {
+		p, file := programTree.FindPackageAndFileByFilename(f)
+		edits[f] = append(edits[f], getNewImportsEdits(p.FileSet, file, imps)...)
+	}
+
+	start, end := getDeclRange(ci.srcPack.FileSet, ci.srcFile, ci.srcContent, ci.decl)
+	edits[ci.srcFilename] = append(edits[ci.srcFilename], &fileEdit{start, end, ""})
+	edits[ci.srcFilename] = append(edits[ci.srcFilename], getUnusedImportsEdits(programTree, ci.srcPack, ci.srcFilename, ci.srcContent, map[ast.Decl]bool{ci.decl: true}, kept)...)
+	return edits, nil
+}
@@ -0,0 +1,195 @@
+package refactoring
+
+import (
+	"refactoring/st"
+	"go/ast"
+	"go/token"
+)
+
+// assignments, address operations and calls in the inlined body
+type bodyWritesVisitor struct {
+	identMap st.IdentifierMap
+	assigned map[st.Symbol]bool //variables, that are assigned or addressed
+	modified map[st.Symbol]bool //variables, which parts are assigned or addressed
+	changes  bool               //the body could change variables of the caller
+}
+
+func (v *bodyWritesVisitor) write(e ast.Expr) {
+	for {
+		p, ok := e.(*ast.ParenExpr)
+		if !ok {
+			break
+		}
+		e = p.X
+	}
+	if id, ok := e.(*ast.Ident); ok {
+		if sym, ok := v.identMap[id]; ok && sym != nil {
+			v.assigned[sym] = true
+		}
+		return
+	}
+	// the location can be shared with the caller
+	v.changes = true
+	v.modify(e)
+}
+
+func (v *bodyWritesVisitor) modify(e ast.Expr) {
+	if id := locationRoot(e); id != nil {
+		if sym, ok := v.identMap[id]; ok && sym != nil {
+			v.modified[sym] = true
+		}
+	}
+}
+
+func (v *bodyWritesVisitor) Visit(node ast.Node) ast.Visitor {
+	switch t := node.(type) {
+	case *ast.AssignStmt:
+		for _, l := range t.Lhs {
+			v.write(l)
+		}
+	case *ast.IncDecStmt:
+		v.write(t.X)
+	case *ast.RangeStmt:
+		v.write(t.Key)
+		if t.Value != nil {
+			v.write(t.Value)
+		}
+	case *ast.UnaryExpr:
+		if t.Op == token.AND {
+			v.write(t.X)
+		}
+	case *ast.SliceExpr:
+		v.modify(t.X)
+	case *ast.SelectorExpr:
+		if isMethodSymbol(v.identMap[t.Sel]) {
+			v.modify(t.X)
+		}
+	}
+	return v
+}
+
+// symbols, used in function literals of the body
+type capturedVisitor struct {
+	identMap st.IdentifierMap
+	captured map[st.Symbol]bool
+}
+
+func (v *capturedVisitor) Visit(node ast.Node) ast.Visitor {
+	if lit, ok := node.(*ast.FuncLit); ok {
+		for id, _ := range getIdentsInNode(lit) {
+			v.captured[v.identMap[id]] = true
+		}
+		return nil
+	}
+	return v
+}
+
+// parameter, that is declared as a variable, initialized with the argument;
+// sym is nil for an unused argument, that is kept for it's side effects
+type boundTemporary struct {
+	sym st.Symbol
+	arg ast.Expr
+	typ ast.Expr
+}
+
+// true if type expression denotes a pointer, slice or map, which parts can be changed through a copy of the value
+func isReferenceTypeExpr(typ ast.Expr) bool {
+	switch t := typ.(type) {
+	case *ast.StarExpr, *ast.MapType:
+		return true
+	case *ast.ArrayType:
+		return t.Len == nil
+	}
+	return false
+}
+
+// true if the argument can replace every use of the parameter: it has no side effects,
+// it's a constant or variable, or it's used once, and variables, it reads, can't be changed before their uses
+func (ci *callInliner) isSubstitutable(arg ast.Expr, uses int, captured bool, changes bool) bool {
+	identMap := ci.programTree.IdentMap
+	rv := &readsVariablesVisitor{identMap, false}
+	ast.Walk(rv, arg)
+	if hasSideEffects(identMap, arg) || rv.found && (changes || captured) {
+		return false
+	}
+	switch t := arg.(type) {
+	case *ast.BasicLit, *ast.Ident:
+		return true
+	case *ast.SelectorExpr:
+		if x, ok := t.X.(*ast.Ident); ok && isPackageSymbol(identMap[x]) {
+			return true
+		}
+	}
+	return uses <= 1
+}
+
+// Binds the parameters, which arguments can't be substituted for them, to temporaries:
+// parameters, that the body assigns or addresses (or changes parts of, if they are not references),
+// and parameters, which arguments are not substitutable. Arguments of unnamed or unused parameters
+// are kept, if they have side effects. Temporaries are listed in the order of the arguments.
+func (ci *callInliner) bindTemporaries(callExpr *ast.CallExpr) {
+	identMap := ci.programTree.IdentMap
+	ci.temps = []*boundTemporary{}
+	wv := &bodyWritesVisitor{identMap, make(map[st.Symbol]bool), make(map[st.Symbol]bool), hasSideEffects(identMap, ci.decl.Body)}
+	ast.Walk(wv, ci.decl.Body)
+	for sym, _ := range wv.assigned {
+		if !ci.isLocal(sym) {
+			wv.changes = true
+		}
+	}
+	cv := &capturedVisitor{identMap, make(map[st.Symbol]bool)}
+	ast.Walk(cv, ci.decl.Body)
+	uses := make(map[st.Symbol]int)
+	for id, _ := range getIdentsInNode(ci.decl.Body) {
+		uses[identMap[id]]++
+	}
+
+	bind := func(f *ast.Field, args []ast.Expr) {
+		for i, arg := range args {
+			var sym st.Symbol
+			if i < len(f.Names) && f.Names[i].Name != "_" {
+				sym = identMap[f.Names[i]]
+			}
+			switch {
+			case sym == nil || uses[sym] == 0:
+				if hasSideEffects(identMap, arg) {
+					ci.temps = append(ci.temps, &boundTemporary{nil, arg, nil})
+				}
+			case wv.assigned[sym] || wv.modified[sym] && !isReferenceTypeExpr(f.Type) || !ci.isSubstitutable(arg, uses[sym], cv.captured[sym], wv.changes):
+				ci.temps = append(ci.temps, &boundTemporary{sym, arg, f.Type})
+				ci.args[sym] = nil, false
+			}
+		}
+	}
+	if ci.decl.Recv != nil {
+		bind(ci.decl.Recv.List[0], []ast.Expr{callExpr.Fun.(*ast.SelectorExpr).X})
+	}
+	i := 0
+	for _, f := range ci.decl.Type.Params.List {
+		n := len(f.Names)
+		if n == 0 {
+			n = 1
+		}
+		bind(f, callExpr.Args[i:i+n])
+		i += n
+	}
+}
+
+// declarations of the temporaries
+func (ci *callInliner) temporariesText(edits []*fileEdit, indent string) []string {
+	lines := []string{}
+	for _, t := range ci.temps {
+		arg := nodeText(ci.pack.FileSet, ci.content, t.arg)
+		if t.sym == nil {
+			lines = append(lines, "_ = "+arg)
+			continue
+		}
+		name, ok := ci.newNames[t.sym]
+		if !ok {
+			name = t.sym.Name()
+		}
+		typ := ci.bodyText(t.typ.Pos(), t.typ.End(), edits, indent)
+		lines = append(lines, "var "+name+" "+typ+" = "+ci.derefs[t.sym]+arg)
+	}
+	return lines
+}
@@ -0,0 +1,728 @@
+package refactoring
+
+import (
+	"refactoring/st"
+	"refactoring/errors"
+	"refactoring/program"
+	"refactoring/packageParser"
+	"go/ast"
+	"go/token"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+func inlineMethodError(message string) *errors.GoRefactorError {
+	return &errors.GoRefactorError{ErrorType: "inline method error", Message: message}
+}
+
+// state of the inlining of a call by textual edits
+type callInliner struct {
+	programTree *program.Program
+	pack        *st.Package //package of the call
+	file        *ast.File
+	filename    string
+	content     []byte
+	srcPack     *st.Package //package of the callee
+	srcFilename string
+	srcFile     *ast.File
+	srcContent  []byte
+	decl        *ast.FuncDecl
+	declIdents  map[*ast.Ident]bool
+	args        map[st.Symbol]ast.Expr //reciever and parameters -> passed expressions, substituted for them
+	temps       []*boundTemporary      //reciever and parameters, declared as variables
+	derefs      map[st.Symbol]string   //"&" or "*", if the reciever expression has to be converted to the reciever type
+	newNames    map[st.Symbol]string   //renamed locals
+	qualifiers  map[*st.Package]string //packages, the body refers to, -> names, the destination file imports them with
+	newImports  map[*st.Package]bool   //packages, that the destination file has to import
+	refs        *moveRefsVisitor       //identifiers of the body
+	introduced  map[ast.Node]map[string]bool //names of variables and labels, added to blocks and functions by previous calls
+	hoistedAt   ast.Node                     //statement, before which the body of the last call was moved
+}
+
+// true if the symbol is declared and used only in the callee's declaration
+func (ci *callInliner) isLocal(sym st.Symbol) bool {
+	for id, _ := range sym.Identifiers() {
+		if !ci.declIdents[id] {
+			return false
+		}
+	}
+	return true
+}
+
+// binds the reciever and parameters of the callee to the expressions, passed by the call
+func (ci *callInliner) bindArguments(callExpr *ast.CallExpr) *errors.GoRefactorError {
+	identMap := ci.programTree.IdentMap
+	if ci.decl.Recv != nil {
+		sel, ok := callExpr.Fun.(*ast.SelectorExpr)
+		if !ok {
+			return inlineMethodError("method is called without reciever")
+		}
+		if names := ci.decl.Recv.List[0].Names; len(names) > 0 && names[0].Name != "_" {
+			sym := identMap[names[0]]
+			ci.args[sym] = sel.X
+			if d := ci.recieverDeref(sel.X); d != "" {
+				ci.derefs[sym] = d
+			}
+		}
+	}
+	i := 0
+	for _, f := range ci.decl.Type.Params.List {
+		if _, ok := f.Type.(*ast.Ellipsis); ok || callExpr.Ellipsis.IsValid() {
+			return inlineMethodError("can't inline call of variadic function")
+		}
+		n := len(f.Names)
+		if n == 0 {
+			n = 1
+		}
+		for j := 0; j < n; j++ {
+			if i >= len(callExpr.Args) {
+				return inlineMethodError("call passes results of a function as arguments")
+			}
+			if j < len(f.Names) && f.Names[j].Name != "_" {
+				ci.args[identMap[f.Names[j]]] = callExpr.Args[i]
+			}
+			i++
+		}
+	}
+	if i != len(callExpr.Args) {
+		return inlineMethodError("call passes wrong number of arguments")
+	}
+	return nil
+}
+
+// "&" or "*", if the reciever expression has to be converted to the reciever type of the callee
+func (ci *callInliner) recieverDeref(x ast.Expr) string {
+	_, ptrRecv := ci.decl.Recv.List[0].Type.(*ast.StarExpr)
+	_, ptrExpr := packageParser.ParseExpr(x, ci.pack, ci.filename, ci.programTree.IdentMap).(*st.PointerTypeSymbol)
+	switch {
+	case ptrRecv && !ptrExpr:
+		return "&"
+	case !ptrRecv && ptrExpr:
+		return "*"
+	}
+	return ""
+}
+
+// chooses names for packages, the body refers to, and refuses,
+// if the body refers to unexported identifiers of another package
+func (ci *callInliner) resolveReferences(destNames map[string]st.Symbol) *errors.GoRefactorError {
+	identMap := ci.programTree.IdentMap
+	refer := func(p *st.Package) *errors.GoRefactorError {
+		if p == ci.pack {
+			return nil
+		}
+		if _, ok := ci.qualifiers[p]; ok {
+			return nil
+		}
+		name, exists := importName(ci.pack, ci.filename, p)
+		if _, ok := destNames[name]; ok {
+			return inlineMethodError("package " + p.GoPath + " is referred to as " + name + ", which is redeclared at the call")
+		}
+		ci.qualifiers[p] = name
+		if !exists {
+			ci.newImports[p] = true
+		}
+		return nil
+	}
+	for _, id := range ci.refs.idents {
+		sym, ok := identMap[id]
+		if !ok || sym == nil {
+			continue
+		}
+		if ps, ok := sym.(*st.PackageSymbol); ok {
+			if err := refer(ps.Package); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, ok := ci.args[sym]; ok || ci.isLocal(sym) {
+			continue
+		}
+		_, isSel := ci.refs.selectors[id]
+		p := sym.PackageFrom()
+		if p != nil && p != ci.pack && !isExportedName(sym.Name()) {
+			return inlineMethodError("inlined code refers to unexported " + sym.Name() + " of package " + p.GoPath)
+		}
+		if isSel {
+			continue
+		}
+		if p != nil && sym.Scope() == p.Symbols {
+			if err := refer(p); err != nil {
+				return err
+			}
+		}
+		// unqualified identifiers mustn't be captured by declarations at the call
+		if s, ok := destNames[id.Name]; ok && s != sym && (p == nil || p == ci.pack || ci.qualifiers[p] == ".") {
+			return inlineMethodError(id.Name + ", used by inlined code, is redeclared at the call")
+		}
+	}
+	return nil
+}
+
+// locals of the callee, which names are used at the call or by package names, get new names;
+// returns the locals
+func (ci *callInliner) renameLocals(destNames map[string]st.Symbol) []st.Symbol {
+	identMap := ci.programTree.IdentMap
+	used := make(map[string]bool)
+	for name, _ := range destNames {
+		used[name] = true
+	}
+	for _, name := range ci.qualifiers {
+		used[name] = true
+	}
+	locals := []st.Symbol{}
+	seen := make(map[st.Symbol]bool)
+	for _, id := range ci.refs.idents {
+		sym, ok := identMap[id]
+		if !ok || sym == nil || seen[sym] || isPackageSymbol(sym) {
+			continue
+		}
+		if _, isArg := ci.args[sym]; isArg || !ci.isLocal(sym) {
+			continue
+		}
+		seen[sym] = true
+		locals = append(locals, sym)
+	}
+	for _, sym := range locals {
+		if !used[sym.Name()] {
+			continue
+		}
+		for i := 1; ; i++ {
+			name := sym.Name() + strconv.Itoa(i)
+			if !used[name] && !declaredIn(locals, name) {
+				ci.newNames[sym] = name
+				used[name] = true
+				break
+			}
+		}
+	}
+	return locals
+}
+
+func declaredIn(syms []st.Symbol, name string) bool {
+	for _, s := range syms {
+		if s.Name() == name {
+			return true
+		}
+	}
+	return false
+}
+
+// edits of the callee's body, that make it valid at the call
+func (ci *callInliner) getBodyEdits() []*fileEdit {
+	identMap := ci.programTree.IdentMap
+	fset := ci.srcPack.FileSet
+	offset := func(n ast.Node) (int, int) {
+		return fset.Position(n.Pos()).Offset, fset.Position(n.End()).Offset
+	}
+	edits := []*fileEdit{}
+	for _, id := range ci.refs.idents {
+		sym, ok := identMap[id]
+		if !ok || sym == nil {
+			continue
+		}
+		start, end := offset(id)
+		if ps, ok := sym.(*st.PackageSymbol); ok {
+			sel := ci.qualifiedBy(id)
+			name, found := ci.qualifiers[ps.Package]
+			switch {
+			case sel == nil:
+			case !found || name == ".":
+				start, end = offset(sel)
+				edits = append(edits, &fileEdit{start, end, sel.Sel.Name})
+			case name != id.Name:
+				edits = append(edits, &fileEdit{start, end, name})
+			}
+			continue
+		}
+		if arg, ok := ci.args[sym]; ok {
+			text := nodeText(ci.pack.FileSet, ci.content, arg)
+			path := getNodePath(fset, ci.srcFile, id)
+			_, isSelX := path[len(path)-2].(*ast.SelectorExpr)
+			if d, ok := ci.derefs[sym]; ok && !isSelX {
+				text = "(" + d + text + ")"
+			} else if needsParens(arg, path) {
+				text = "(" + text + ")"
+			}
+			edits = append(edits, &fileEdit{start, end, text})
+			continue
+		}
+		if name, ok := ci.newNames[sym]; ok {
+			edits = append(edits, &fileEdit{start, end, name})
+			continue
+		}
+		if _, isSel := ci.refs.selectors[id]; isSel || ci.isLocal(sym) {
+			continue
+		}
+		if p := sym.PackageFrom(); p != nil && p != ci.pack && sym.Scope() == p.Symbols {
+			edits = append(edits, &fileEdit{start, end, qualify(ci.qualifiers[p], id.Name)})
+		}
+	}
+	return edits
+}
+
+// selector, which package identifier is the X of
+func (ci *callInliner) qualifiedBy(x *ast.Ident) *ast.SelectorExpr {
+	for _, sel := range ci.refs.qualified {
+		if sel.X == ast.Expr(x) {
+			return sel
+		}
+	}
+	return nil
+}
+
+// text of the range of the callee's file with edits applied, with lines indented by indent
+func (ci *callInliner) bodyText(from token.Pos, to token.Pos, edits []*fileEdit, indent string) string {
+	fset := ci.srcPack.FileSet
+	start, end := fset.Position(from).Offset, fset.Position(to).Offset
+	return strings.Replace(applyEditsInRange(ci.srcContent, start, end, edits), "\n"+lineIndent(ci.srcContent, start), "\n"+indent, -1)
+}
+
+// inliner of the calls of the function
+func newCallInliner(programTree *program.Program, funSym *st.FunctionSymbol) (*callInliner, *errors.GoRefactorError) {
+	srcPack := funSym.PackageFrom()
+	decl, sourceFile, err := getDeclarationInFile(programTree, srcPack, funSym)
+	if err != nil {
+		return nil, err
+	}
+	if decl.Body == nil {
+		return nil, inlineMethodError("function " + funSym.Name() + " has no body")
+	}
+	srcContent, rerr := ioutil.ReadFile(sourceFile)
+	if rerr != nil {
+		return nil, inlineMethodError("couldn't read file " + sourceFile + ": " + rerr.String())
+	}
+	ci := &callInliner{programTree: programTree, srcPack: srcPack, srcFilename: sourceFile, srcFile: srcPack.AstPackage.Files[sourceFile], srcContent: srcContent, decl: decl, declIdents: getIdentsInNode(decl),
+		introduced: make(map[ast.Node]map[string]bool)}
+	return ci, nil
+}
+
+// Returns edits, that replace the call in the file with the body of the callee.
+// Identifiers of the callee's package are qualified with the name, the file imports it with;
+// packages, that the file has to import, are left in newImports.
+// A call statement is replaced with the body. A call in an expression is replaced with the returned expressions,
+// if the body is a single return statement; otherwise the body is hoisted before the enclosing statement.
+// Bodies with deferred calls or recover and calls of go and defer statements are wrapped in function literals.
+func (ci *callInliner) inlineCall(pack *st.Package, file *ast.File, filename string, content []byte, callNode ast.Node, callExpr *ast.CallExpr, nodeFrom ast.Node) ([]*fileEdit, *errors.GoRefactorError) {
+	if err := ci.bindCall(pack, file, filename, content, callExpr); err != nil {
+		return nil, err
+	}
+
+	fset := pack.FileSet
+	_, isStmt := callNode.(*ast.ExprStmt)
+	path := getNodePath(fset, file, callExpr)
+	wrapped := ci.needsWrapping(path, isStmt)
+	if wrapped {
+		// arguments are passed to the function literal
+		ci.args, ci.temps = make(map[st.Symbol]ast.Expr), nil
+	}
+	hoisted := !wrapped && !isStmt && (!isSingleReturn(ci.decl.Body) || len(ci.temps) > 0 || ci.namedResultsUsed())
+	ci.hoistedAt = nil
+	if hoisted {
+		s, err := ci.checkHoisting(path)
+		if err != nil {
+			return nil, err
+		}
+		nodeFrom = path[s-1]
+		ci.hoistedAt = path[s]
+	}
+	ci.refs = &moveRefsVisitor{ci.programTree.IdentMap, nil, make(map[*ast.Ident]*ast.SelectorExpr), make(map[*ast.Ident]bool)}
+	ast.Walk(ci.refs, ci.decl.Body)
+	if (hoisted || wrapped) && ci.decl.Type.Results != nil {
+		ast.Walk(ci.refs, ci.decl.Type.Results)
+	}
+	if wrapped {
+		if ci.decl.Recv != nil {
+			ast.Walk(ci.refs, ci.decl.Recv)
+		}
+		ast.Walk(ci.refs, ci.decl.Type.Params)
+	}
+	walked := make(map[ast.Expr]bool)
+	for _, t := range ci.temps {
+		if t.typ != nil && !walked[t.typ] {
+			walked[t.typ] = true
+			ast.Walk(ci.refs, t.typ)
+		}
+	}
+
+	destNames := make(map[string]st.Symbol)
+	for sym, _ := range getDestScope(ci.programTree, pack, nodeFrom) {
+		destNames[sym.Name()] = sym
+	}
+	for _, arg := range callExpr.Args {
+		for id, _ := range getIdentsInNode(arg) {
+			destNames[id.Name] = ci.programTree.IdentMap[id]
+		}
+	}
+	// locals and temporaries of previous calls, inlined as statements into the block
+	if isStmt && nodeFrom != nil {
+		for name, _ := range ci.introduced[nodeFrom] {
+			if _, ok := destNames[name]; !ok {
+				destNames[name] = nil
+			}
+		}
+	}
+	if err := ci.resolveReferences(destNames); err != nil {
+		return nil, err
+	}
+	if wrapped {
+		// locals of the literal can't capture names of the caller
+		return ci.wrapCall(callNode, callExpr, ci.getBodyEdits()), nil
+	}
+	locals := ci.renameLocals(destNames)
+	if isStmt && nodeFrom != nil {
+		if ci.introduced[nodeFrom] == nil {
+			ci.introduced[nodeFrom] = make(map[string]bool)
+		}
+		for _, sym := range locals {
+			if name, ok := ci.newNames[sym]; ok {
+				ci.introduced[nodeFrom][name] = true
+			} else {
+				ci.introduced[nodeFrom][sym.Name()] = true
+			}
+		}
+	}
+	edits := ci.getBodyEdits()
+	if hoisted {
+		return ci.hoistCall(path, destNames, edits)
+	}
+
+	start, end := fset.Position(callNode.Pos()).Offset, fset.Position(callNode.End()).Offset
+	stmts := ci.decl.Body.List
+	text := ""
+	if isStmt {
+		stmts, err := ci.dropLastReturn(stmts, &edits)
+		if err != nil {
+			return nil, err
+		}
+		lines := ci.temporariesText(edits, lineIndent(content, start))
+		if len(stmts) > 0 {
+			lines = append(lines, ci.bodyText(stmts[0].Pos(), stmts[len(stmts)-1].End(), edits, lineIndent(content, start)))
+		}
+		if len(lines) == 0 {
+			start, end = extendToLines(content, start, end)
+		}
+		text = strings.Join(lines, "\n"+lineIndent(content, start))
+	} else {
+		rs := stmts[0].(*ast.ReturnStmt)
+		text = ci.bodyText(rs.Results[0].Pos(), rs.Results[len(rs.Results)-1].End(), edits, lineIndent(content, start))
+		if len(rs.Results) == 1 && needsParens(rs.Results[0], path) {
+			text = "(" + text + ")"
+		}
+	}
+	return []*fileEdit{&fileEdit{start, end, text}}, nil
+}
+
+// binds the reciever and parameters of the callee to the arguments of the call in the file or to temporaries
+func (ci *callInliner) bindCall(pack *st.Package, file *ast.File, filename string, content []byte, callExpr *ast.CallExpr) *errors.GoRefactorError {
+	ci.pack, ci.file, ci.filename, ci.content = pack, file, filename, content
+	ci.args, ci.derefs, ci.newNames = make(map[st.Symbol]ast.Expr), make(map[st.Symbol]string), make(map[st.Symbol]string)
+	ci.qualifiers, ci.newImports = make(map[*st.Package]string), make(map[*st.Package]bool)
+	if err := ci.bindArguments(callExpr); err != nil {
+		return err
+	}
+	ci.bindTemporaries(callExpr)
+	return nil
+}
+
+// true if the body is a single return statement with results, which can replace the call in an expression
+func isSingleReturn(body *ast.BlockStmt) bool {
+	if len(body.List) != 1 {
+		return false
+	}
+	rs, ok := body.List[0].(*ast.ReturnStmt)
+	return ok && len(rs.Results) > 0
+}
+
+// checks, that the body of the callee can be executed before the statement, that contains the call at the end of path;
+// returns index of the statement in path
+func (ci *callInliner) checkHoisting(path []ast.Node) (int, *errors.GoRefactorError) {
+	if ci.decl.Type.Results == nil {
+		return -1, inlineMethodError("function without results can't be inlined in an expression")
+	}
+	s, list := getEnclosingStatement(path)
+	if s == -1 {
+		return -1, inlineMethodError("call is not inside of a function body")
+	}
+	stmt := path[s].(ast.Stmt)
+	if _, ok := stmt.(*ast.LabeledStmt); ok {
+		return -1, inlineMethodError("statement, that contains the call, is labeled")
+	}
+	if isEvaluatedConditionally(path, s) {
+		return -1, inlineMethodError("call is evaluated conditionally or repeatedly; it's body can't be moved before the statement")
+	}
+	ind, _ := getIndexOfStmt(stmt, list)
+	if err := checkGotos(list, ind); err != nil {
+		return -1, inlineMethodError("goto statement would jump over the variables of inlined code")
+	}
+	return s, nil
+}
+
+// operands of the statement, which are evaluated before the call; those, which the inlined body could affect,
+// are saved in temporaries, others must not have side effects
+type earlierOperandsVisitor struct {
+	identMap st.IdentifierMap
+	call     *ast.CallExpr
+	parent   ast.Node
+	changes  bool //the inlined body has side effects
+	saved    *[]ast.Expr
+	fixed    *ast.Node //operand, that can't be saved, but has side effects
+}
+
+func (v *earlierOperandsVisitor) Visit(node ast.Node) ast.Visitor {
+	if node == nil || *v.fixed != nil || node.Pos() >= v.call.Pos() {
+		return nil
+	}
+	if node.End() > v.call.Pos() {
+		return &earlierOperandsVisitor{v.identMap, v.call, node, v.changes, v.saved, v.fixed}
+	}
+	e, ok := node.(ast.Expr)
+	if !ok {
+		// init statement would be executed after the body
+		*v.fixed = node
+		return nil
+	}
+	rv := &readsVariablesVisitor{v.identMap, false}
+	ast.Walk(rv, e)
+	effects := hasSideEffects(v.identMap, e)
+	if !effects && !(v.changes && rv.found) || isTypeExpr(v.identMap, e) {
+		return nil
+	}
+	location := false
+	switch p := v.parent.(type) {
+	case *ast.AssignStmt:
+		for _, l := range p.Lhs {
+			location = location || l == e
+		}
+	case *ast.ValueSpec:
+		_, location = e.(*ast.Ident)
+	case *ast.UnaryExpr:
+		location = p.Op == token.AND
+	case *ast.CallExpr:
+		location = p.Fun == e
+	case *ast.KeyValueExpr:
+		location = p.Key == e
+	case *ast.IndexExpr, *ast.SliceExpr, *ast.RangeStmt, *ast.IncDecStmt:
+		location = true
+	}
+	switch {
+	case !location:
+		*v.saved = append(*v.saved, e)
+	case effects:
+		*v.fixed = node
+	}
+	return nil
+}
+
+// Moves the body of the callee before the statement, that contains the call at the end of path.
+// The body becomes a block, which return statements assign new result variables, that replace the call;
+// return statements before the end of the block jump to the label of the statement.
+// Operands, evaluated before the call, are saved in temporaries, if the body could change their values.
+func (ci *callInliner) hoistCall(path []ast.Node, destNames map[string]st.Symbol, edits []*fileEdit) ([]*fileEdit, *errors.GoRefactorError) {
+	identMap := ci.programTree.IdentMap
+	fset, srcFset := ci.pack.FileSet, ci.srcPack.FileSet
+	callExpr := path[len(path)-1].(*ast.CallExpr)
+	s, list := getEnclosingStatement(path)
+	stmt := path[s].(ast.Stmt)
+
+	var saved []ast.Expr
+	var fixed ast.Node
+	ast.Walk(&earlierOperandsVisitor{identMap, callExpr, nil, hasSideEffects(identMap, ci.decl.Body), &saved, &fixed}, stmt)
+	if fixed != nil {
+		return nil, inlineMethodError("code at " + fset.Position(fixed.Pos()).String() + " must be executed before the inlined body")
+	}
+
+	// labels are declared in the scope of the enclosing function
+	var fun ast.Node
+	var funBody *ast.BlockStmt
+	for j := s; j >= 0 && fun == nil; j-- {
+		switch t := path[j].(type) {
+		case *ast.FuncDecl:
+			fun, funBody = t, t.Body
+		case *ast.FuncLit:
+			fun, funBody = t, t.Body
+		}
+	}
+	labels := make(map[string]bool)
+	for _, l := range getLabeledStmts(funBody.List) {
+		labels[l.Label.Name] = true
+	}
+	if ci.introduced[fun] == nil {
+		ci.introduced[fun] = make(map[string]bool)
+	}
+	for _, l := range getLabeledStmts(ci.decl.Body.List) {
+		if labels[l.Label.Name] || ci.introduced[fun][l.Label.Name] {
+			return nil, inlineMethodError("label " + l.Label.Name + " of inlined function is already declared at the call")
+		}
+		ci.introduced[fun][l.Label.Name] = true
+	}
+
+	used := make(map[string]bool)
+	for name, _ := range destNames {
+		used[name] = true
+	}
+	for _, name := range ci.qualifiers {
+		used[name] = true
+	}
+	for _, name := range ci.newNames {
+		used[name] = true
+	}
+	for id, _ := range ci.declIdents {
+		used[id.Name] = true
+	}
+	for _, l := range list {
+		for id, _ := range getIdentsInNode(l) {
+			used[id.Name] = true
+		}
+	}
+	fresh := func(base string, scope ast.Node, taken map[string]bool) string {
+		if ci.introduced[scope] == nil {
+			ci.introduced[scope] = make(map[string]bool)
+		}
+		name := base
+		for i := 1; taken[name] || ci.introduced[scope][name] || scope != fun && checkVariableName(fset, path, s, list, name) != nil; i++ {
+			name = base + strconv.Itoa(i)
+		}
+		ci.introduced[scope][name] = true
+		return name
+	}
+
+	start := fset.Position(stmt.Pos()).Offset
+	indent := lineIndent(ci.content, start)
+	text := ""
+	res := []*fileEdit{}
+	for _, e := range saved {
+		tmp := fresh("tmp", path[s-1], used)
+		res = append(res, &fileEdit{fset.Position(e.Pos()).Offset, fset.Position(e.End()).Offset, tmp})
+		text += tmp + " := " + nodeText(fset, ci.content, e) + "\n" + indent
+	}
+
+	// result variables of the call and named results of the callee, declared in the block
+	results, named := []string{}, []string{}
+	block := ""
+	for _, l := range ci.temporariesText(edits, indent+"\t") {
+		block += l + "\n" + indent + "\t"
+	}
+	for _, f := range ci.decl.Type.Results.List {
+		typ := ci.bodyText(f.Type.Pos(), f.Type.End(), edits, indent)
+		n := len(f.Names)
+		if n == 0 {
+			n = 1
+		} else {
+			block += "var " + ci.bodyText(f.Pos(), f.End(), edits, indent+"\t") + "\n" + indent + "\t"
+			for _, id := range f.Names {
+				if name, ok := ci.newNames[identMap[id]]; ok {
+					named = append(named, name)
+				} else {
+					named = append(named, id.Name)
+				}
+			}
+		}
+		for j := 0; j < n; j++ {
+			r := fresh("result", path[s-1], used)
+			results = append(results, r)
+			text += "var " + r + " " + typ + "\n" + indent
+		}
+	}
+
+	body := ci.decl.Body.List
+	label := ""
+	for _, r := range getOuterReturns(body) {
+		rs, re := srcFset.Position(r.Pos()).Offset, srcFset.Position(r.End()).Offset
+		assign := strings.Join(results, ", ") + " = "
+		if len(r.Results) > 0 {
+			edits = append(edits, &fileEdit{rs, srcFset.Position(r.Results[0].Pos()).Offset, assign})
+		} else {
+			edits = append(edits, &fileEdit{rs, re, assign + strings.Join(named, ", ")})
+		}
+		if ast.Stmt(r) == body[len(body)-1] {
+			continue
+		}
+		if label == "" {
+			label = fresh("inlined", fun, labels)
+		}
+		edits = append(edits, &fileEdit{re, re, "\n" + lineIndent(ci.srcContent, rs) + "goto " + label})
+	}
+	if len(body) > 0 {
+		block += ci.bodyText(body[0].Pos(), body[len(body)-1].End(), edits, indent+"\t")
+	}
+	text += "{\n" + indent + "\t" + block + "\n" + indent + "}\n" + indent
+	if label != "" {
+		text += label + ":\n" + indent
+	}
+	res = append(res, &fileEdit{start, start, text})
+	res = append(res, &fileEdit{fset.Position(callExpr.Pos()).Offset, fset.Position(callExpr.End()).Offset, strings.Join(results, ", ")})
+	return res, nil
+}
+
+// edit, that adds imports of the packages with given names to the file
+func getNewImportsEdits(fset *token.FileSet, file *ast.File, imports map[*st.Package]string) []*fileEdit {
+	text := ""
+	for p, name := range imports {
+		text += importSpecText(name, p, name == p.AstPackage.Name)
+	}
+	if text == "" {
+		return []*fileEdit{}
+	}
+	offs := fset.Position(file.Name.End()).Offset
+	return []*fileEdit{&fileEdit{offs, offs, "\n\n" + text}}
+}
+
+// Inlines the call by textual edits. This is used for functions from other packages
+// and for calls in expressions, which need the body to be hoisted.
+func inlineCallText(programTree *program.Program, pack *st.Package, file *ast.File, filename string, callNode ast.Node, callExpr *ast.CallExpr, funSym *st.FunctionSymbol, nodeFrom ast.Node) (map[string][]*fileEdit, *errors.GoRefactorError) {
+	ci, err := newCallInliner(programTree, funSym)
+	if err != nil {
+		return nil, err
+	}
+	content, rerr := ioutil.ReadFile(filename)
+	if rerr != nil {
+		return nil, inlineMethodError("couldn't read file " + filename + ": " + rerr.String())
+	}
+	edits, err := ci.inlineCall(pack, file, filename, content, callNode, callExpr, nodeFrom)
+	if err != nil {
+		return nil, err
+	}
+	imports := make(map[*st.Package]string)
+	for p, _ := range ci.newImports {
+		imports[p] = ci.qualifiers[p]
+	}
+	return map[string][]*fileEdit{filename: append(edits, getNewImportsEdits(pack.FileSet, file, imports)...)}, nil
+}
+
+// The return statement, that ends the body of the inlined call statement, is dropped;
+// if it returns results of calls, they are kept as statements. Other returns are refused.
+func (ci *callInliner) dropLastReturn(stmts []ast.Stmt, edits *[]*fileEdit) ([]ast.Stmt, *errors.GoRefactorError) {
+	fset := ci.srcPack.FileSet
+	offset := func(pos token.Pos) int {
+		return fset.Position(pos).Offset
+	}
+	returns := getOuterReturns(stmts)
+	if len(returns) == 0 {
+		return stmts, nil
+	}
+	r := returns[0]
+	if len(returns) > 1 || ast.Stmt(r) != stmts[len(stmts)-1] {
+		return nil, inlineMethodError("inlined function returns at " + fset.Position(r.Pos()).String() + " before the end of it's body")
+	}
+	calls := 0
+	for _, res := range r.Results {
+		if _, ok := res.(*ast.CallExpr); ok {
+			calls++
+		} else if hasSideEffects(ci.programTree.IdentMap, res) {
+			return nil, inlineMethodError("result of inlined function at " + fset.Position(res.Pos()).String() + " has side effects, that would be lost")
+		}
+	}
+	switch {
+	case calls == 0:
+		return stmts[:len(stmts)-1], nil
+	case calls < len(r.Results):
+		return nil, inlineMethodError("results of the return statement at " + fset.Position(r.Pos()).String() + " can't be kept as statements")
+	}
+	*edits = append(*edits, &fileEdit{offset(r.Pos()), offset(r.Results[0].Pos()), ""})
+	for i := 1; i < len(r.Results); i++ {
+		*edits = append(*edits, &fileEdit{offset(r.Results[i-1].End()), offset(r.Results[i].Pos()), "\n" + lineIndent(ci.srcContent, offset(r.Pos()))})
+	}
+	return stmts, nil
+}
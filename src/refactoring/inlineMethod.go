@@ -165,6 +165,8 @@ func getRecieverExpr(callExpr *ast.CallExpr) ast.Expr {
 	panic("unknown reciever expression type")
 }
 
+// parameters are replaced with arguments directly; it's used only for calls,
+// which arguments bindTemporaries finds substitutable
 func getNewNames(callExpr *ast.CallExpr, funSym *st.FunctionSymbol, destScope map[st.Symbol]bool) map[st.Symbol]ast.Expr {
 	newNames := make(map[st.Symbol]ast.Expr)
 	bt, _ := st.GetBaseType(funSym.FunctionType)
@@ -416,8 +418,28 @@ func inlineMethod(programTree *program.Program, filename string, lineStart int,
 	if err != nil {
 		return false, err
 	}
-	if funSym.PackageFrom() != pack {
-		return false, &errors.GoRefactorError{ErrorType: "inline method error", Message: "can't inline method from other package"}
+	// calls, which arguments can't be substituted for parameters, or which bodies must be hoisted or wrapped,
+	// are inlined by textual edits too
+	textual := funSym.PackageFrom() != pack
+	if !textual {
+		ci, err := newCallInliner(programTree, funSym)
+		if err != nil {
+			return false, err
+		}
+		if err := ci.bindCall(pack, file, filename, nil, callExpr); err != nil {
+			return false, err
+		}
+		textual = len(ci.temps) > 0 || ci.needsWrapping(getNodePath(fset, file, callExpr), !CallAsExpression) || CallAsExpression && (!isSingleReturn(ci.decl.Body) || ci.namedResultsUsed())
+	}
+	if textual {
+		edits, err := inlineCallText(programTree, pack, file, filename, callNode, callExpr, funSym, nodeFrom)
+		if err != nil {
+			return false, err
+		}
+		if err := applyFileEdits(programTree, edits); err != nil {
+			return false, err
+		}
+		return true, nil
 	}
 	decl, sourceFile, err := getDeclarationInFile(programTree, pack, funSym)
 	if err != nil {
@@ -0,0 +1,461 @@
+package refactoring
+
+import (
+	"refactoring/st"
+	"refactoring/utils"
+	"refactoring/errors"
+	"refactoring/program"
+	"refactoring/packageParser"
+	"go/ast"
+	"go/token"
+	"io/ioutil"
+	"strings"
+)
+
+// identifiers of the expression, that are resolved in the scope, where it's used
+type freeIdentsVisitor struct {
+	identMap st.IdentifierMap
+	members  map[*ast.Ident]bool
+	idents   []*ast.Ident
+}
+
+func (v *freeIdentsVisitor) Visit(node ast.Node) ast.Visitor {
+	switch t := node.(type) {
+	case *ast.Ident:
+		v.idents = append(v.idents, t)
+	case *ast.SelectorExpr:
+		ast.Walk(v, t.X)
+		return nil
+	case *ast.KeyValueExpr:
+		if id, ok := t.Key.(*ast.Ident); ok && v.identMap[id] != nil {
+			for mid, _ := range v.identMap[id].Identifiers() {
+				if _, ok := v.members[mid]; ok {
+					ast.Walk(v, t.Value)
+					return nil
+				}
+			}
+		}
+	}
+	return v
+}
+
+// looks for objects, which identity would be lost, if the expression is evaluated several times
+type createsReferenceVisitor struct {
+	pack     *st.Package
+	filename string
+	identMap st.IdentifierMap
+	found    bool
+}
+
+func (v *createsReferenceVisitor) Visit(node ast.Node) ast.Visitor {
+	if v.found {
+		return nil
+	}
+	switch t := node.(type) {
+	case *ast.UnaryExpr:
+		if t.Op == token.AND {
+			v.found = true
+		}
+	case *ast.CompositeLit:
+		typ, _ := st.GetBaseType(packageParser.ParseExpr(t, v.pack, v.filename, v.identMap))
+		switch tt := typ.(type) {
+		case *st.MapTypeSymbol:
+			v.found = true
+		case *st.ArrayTypeSymbol:
+			v.found = tt.Len == st.SLICE
+		}
+	}
+	return v
+}
+
+// true if expression, put in place of the last node of path, must be parenthesized
+func needsParens(e ast.Expr, path []ast.Node) bool {
+	child, parent := path[len(path)-1], path[len(path)-2]
+	isOperand := false
+	switch p := parent.(type) {
+	case *ast.SelectorExpr:
+		isOperand = ast.Node(p.X) == child
+	case *ast.IndexExpr:
+		isOperand = ast.Node(p.X) == child
+	case *ast.SliceExpr:
+		isOperand = ast.Node(p.X) == child
+	case *ast.TypeAssertExpr:
+		isOperand = ast.Node(p.X) == child
+	case *ast.CallExpr:
+		isOperand = ast.Node(p.Fun) == child
+	}
+	switch t := e.(type) {
+	case *ast.BinaryExpr:
+		switch p := parent.(type) {
+		case *ast.BinaryExpr:
+			return p.Op.Precedence() > t.Op.Precedence() || p.Op.Precedence() == t.Op.Precedence() && ast.Node(p.Y) == child
+		case *ast.UnaryExpr, *ast.StarExpr:
+			return true
+		}
+		return isOperand
+	case *ast.UnaryExpr, *ast.StarExpr:
+		switch parent.(type) {
+		case *ast.UnaryExpr, *ast.StarExpr, *ast.BinaryExpr:
+			return true
+		}
+		return isOperand
+	case *ast.FuncLit:
+		return isOperand && !isCallFun(parent, child)
+	}
+	// composite literals are ambiguous in headers of statements with blocks
+	hasLit := false
+	ast.Walk(&compositeLitVisitor{&hasLit}, e)
+	if !hasLit {
+		return false
+	}
+	for j := len(path) - 2; j >= 0; j-- {
+		switch path[j].(type) {
+		case *ast.BlockStmt, *ast.FuncLit, *ast.CompositeLit, *ast.ParenExpr, *ast.CallExpr, *ast.IndexExpr:
+			// nested braces and parentheses resolve the ambiguity
+			return false
+		case *ast.IfStmt, *ast.ForStmt, *ast.RangeStmt, *ast.SwitchStmt, *ast.TypeSwitchStmt:
+			return true
+		}
+	}
+	return false
+}
+
+func isCallFun(parent ast.Node, child ast.Node) bool {
+	c, ok := parent.(*ast.CallExpr)
+	return ok && ast.Node(c.Fun) == child
+}
+
+type compositeLitVisitor struct {
+	found *bool
+}
+
+func (v *compositeLitVisitor) Visit(node ast.Node) ast.Visitor {
+	if c, ok := node.(*ast.CompositeLit); ok && c.Type != nil {
+		*v.found = true
+	}
+	return v
+}
+
+func getNodePath(fset *token.FileSet, file *ast.File, node ast.Node) []ast.Node {
+	var path []ast.Node
+	ast.Walk(&exprPathVisitor{fset, fset.Position(node.Pos()), fset.Position(node.End()), nil, &path}, file)
+	return path
+}
+
+func nodeText(fset *token.FileSet, content []byte, node ast.Node) string {
+	return string(content[fset.Position(node.Pos()).Offset:fset.Position(node.End()).Offset])
+}
+
+func inlineVariableError(message string) *errors.GoRefactorError {
+	return &errors.GoRefactorError{ErrorType: "inline variable error", Message: message}
+}
+
+// finds initializer and type of the variable and makes an edit, that removes it's declaration
+func getVariableDecl(fset *token.FileSet, identMap st.IdentifierMap, file *ast.File, content []byte, declPath []ast.Node) (init ast.Expr, typ ast.Expr, stmt ast.Node, edit *fileEdit, err *errors.GoRefactorError) {
+	decl := declPath[len(declPath)-1].(*ast.Ident)
+	text := func(node ast.Node) string {
+		return nodeText(fset, content, node)
+	}
+	switch p := declPath[len(declPath)-2].(type) {
+	case *ast.AssignStmt:
+		if p.Tok != token.DEFINE || len(p.Lhs) != len(p.Rhs) {
+			break
+		}
+		i := 0
+		for ; p.Lhs[i] != ast.Expr(decl); i++ {
+		}
+		init, stmt = p.Rhs[i], p
+		if len(p.Lhs) > 1 {
+			lhs, rhs, tok := []string{}, []string{}, "="
+			for j, l := range p.Lhs {
+				if j == i {
+					continue
+				}
+				lhs, rhs = append(lhs, text(l)), append(rhs, text(p.Rhs[j]))
+				if id, ok := l.(*ast.Ident); ok && id.Name != "_" && identMap[id] != nil {
+					if first, _ := getFirstIdent(fset, identMap[id]); first == id {
+						tok = ":="
+					}
+				}
+			}
+			edit = &fileEdit{fset.Position(p.Pos()).Offset, fset.Position(p.End()).Offset, strings.Join(lhs, ", ") + " " + tok + " " + strings.Join(rhs, ", ")}
+			return
+		}
+		switch declPath[len(declPath)-3].(type) {
+		case *ast.IfStmt, *ast.SwitchStmt, *ast.TypeSwitchStmt:
+			edit = removeInit(fset, content, p)
+		case *ast.ForStmt:
+			edit = &fileEdit{fset.Position(p.Pos()).Offset, fset.Position(p.End()).Offset, ""}
+		default:
+			start, end := getNodeRange(fset, file, content, p, nil)
+			edit = &fileEdit{start, end, ""}
+		}
+		return
+	case *ast.ValueSpec:
+		if len(p.Values) != len(p.Names) {
+			break
+		}
+		i := 0
+		for ; p.Names[i] != decl; i++ {
+		}
+		init, typ, stmt = p.Values[i], p.Type, declPath[len(declPath)-4]
+		if len(p.Names) > 1 {
+			names, values := []string{}, []string{}
+			for j, n := range p.Names {
+				if j != i {
+					names, values = append(names, n.Name), append(values, text(p.Values[j]))
+				}
+			}
+			t := strings.Join(names, ", ")
+			if p.Type != nil {
+				t += " " + text(p.Type)
+			}
+			edit = &fileEdit{fset.Position(p.Pos()).Offset, fset.Position(p.End()).Offset, t + " = " + strings.Join(values, ", ")}
+			return
+		}
+		var start, end int
+		if gd := declPath[len(declPath)-3].(*ast.GenDecl); len(gd.Specs) > 1 {
+			start, end = getNodeRange(fset, file, content, p, p.Doc)
+		} else {
+			start, end = getNodeRange(fset, file, content, stmt, nil)
+		}
+		edit = &fileEdit{start, end, ""}
+		return
+	}
+	err = inlineVariableError("variable " + decl.Name + " isn't declared with a single initializer expression")
+	return
+}
+
+// removes init statement of if or switch with the following semicolon
+func removeInit(fset *token.FileSet, content []byte, init ast.Stmt) *fileEdit {
+	start, end := fset.Position(init.Pos()).Offset, fset.Position(init.End()).Offset
+	for end < len(content) && content[end] != ';' {
+		end++
+	}
+	end++
+	for end < len(content) && (content[end] == ' ' || content[end] == '\t') {
+		end++
+	}
+	return &fileEdit{start, end, ""}
+}
+
+func CheckInlineVariableParameters(filename string, line int, column int) (bool, *errors.GoRefactorError) {
+	switch {
+	case filename == "" || !utils.IsGoFile(filename):
+		return false, errors.ArgumentError("filename", "It's not a valid go file name")
+	case line < 1:
+		return false, errors.ArgumentError("line", "Must be > 1")
+	case column < 1:
+		return false, errors.ArgumentError("column", "Must be > 1")
+	}
+	return true, nil
+}
+
+// Replaces uses of local variable, pointed by position, with it's initializer and removes the declaration
+func InlineVariable(filename string, line int, column int) (bool, *errors.GoRefactorError) {
+	if ok, err := CheckInlineVariableParameters(filename, line, column); !ok {
+		return false, err
+	}
+	programTree := parseProgram(filename)
+	edits, err := inlineVariable(programTree, filename, line, column)
+	if err != nil {
+		return false, err
+	}
+	if err := applyFileEdits(programTree, map[string][]*fileEdit{filename: edits}); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func inlineVariable(programTree *program.Program, filename string, line int, column int) ([]*fileEdit, *errors.GoRefactorError) {
+	sym, err := programTree.FindSymbolByPosition(filename, line, column)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := sym.(*st.VariableSymbol); !ok {
+		return nil, inlineVariableError("symbol " + sym.Name() + " is not a variable")
+	}
+	pack, file := programTree.FindPackageAndFileByFilename(filename)
+	if pack == nil {
+		return nil, errors.ArgumentError("filename", "Program packages don't contain file '"+filename+"'")
+	}
+	fset := pack.FileSet
+	identMap := programTree.IdentMap
+
+	decl, f := getFirstIdent(fset, sym)
+	if decl == nil || f != filename {
+		return nil, inlineVariableError("variable " + sym.Name() + " is not local")
+	}
+	declPath := getNodePath(fset, file, decl)
+	var fn ast.Node
+	for _, n := range declPath {
+		switch n.(type) {
+		case *ast.FuncDecl, *ast.FuncLit:
+			if fn == nil {
+				fn = n
+			}
+		}
+	}
+	if fn == nil || len(declPath) < 4 {
+		return nil, inlineVariableError("variable " + sym.Name() + " is not local")
+	}
+	content, rerr := ioutil.ReadFile(filename)
+	if rerr != nil {
+		return nil, inlineVariableError("couldn't read file " + filename + ": " + rerr.String())
+	}
+	init, typ, stmt, declEdit, err := getVariableDecl(fset, identMap, file, content, declPath)
+	if err != nil {
+		return nil, err
+	}
+	if hasSideEffects(identMap, init) {
+		return nil, inlineVariableError("initializer of " + sym.Name() + " has side effects")
+	}
+
+	writes, loops := []*variableWrite{}, []ast.Node{}
+	wv := &writesVisitor{identMap, false, &writes, make(map[st.Symbol]bool), &loops}
+	ast.Walk(wv, fn)
+	if _, ok := wv.aliased[sym]; ok {
+		return nil, inlineVariableError("address of " + sym.Name() + " is taken (explicitly, by slicing or by a method call)")
+	}
+	for _, w := range writes {
+		if w.sym == sym && w.pos != stmt.End() {
+			return nil, inlineVariableError(sym.Name() + " is assigned at " + fset.Position(w.pos).String())
+		}
+	}
+
+	uses := []*ast.Ident{}
+	for id, _ := range sym.Identifiers() {
+		if id != decl {
+			uses = append(uses, id)
+		}
+	}
+	lastUse := stmt.End()
+	for _, u := range uses {
+		if u.Pos() > lastUse {
+			lastUse = u.Pos()
+		}
+	}
+	if len(uses) > 1 {
+		cv := &createsReferenceVisitor{pack, filename, identMap, false}
+		ast.Walk(cv, init)
+		if cv.found {
+			return nil, inlineVariableError("initializer of " + sym.Name() + " creates a new object; each use would get it's own copy")
+		}
+	}
+
+	// operands must denote the same values at every use
+	_, members := getMemberIdents(programTree)
+	fv := &freeIdentsVisitor{identMap, members, nil}
+	ast.Walk(fv, init)
+	calls := &callPositionsVisitor{identMap, nil}
+	ast.Walk(calls, fn)
+	readsVariables := false
+	for _, id := range fv.idents {
+		osym := identMap[id]
+		if osym == nil {
+			continue
+		}
+		if od, _ := getFirstIdent(fset, osym); od != nil && od.Pos() >= init.Pos() && od.Pos() < init.End() {
+			continue
+		}
+		for _, u := range uses {
+			if table, ok := pack.IdentScopes[u]; ok {
+				if found, ok := table.LookUp(id.Name, filename); !ok || found != osym {
+					return nil, inlineVariableError(id.Name + " denotes another entity at " + fset.Position(u.Pos()).String())
+				}
+			}
+		}
+		if _, ok := osym.(*st.VariableSymbol); !ok || isPredeclaredConst(osym) {
+			continue
+		}
+		readsVariables = true
+		for _, w := range writes {
+			if w.sym != osym {
+				continue
+			}
+			pos := w.pos
+			for _, l := range loops {
+				if l.Pos() >= stmt.Pos() && l.Pos() <= w.pos && w.pos < l.End() && l.Pos() < pos {
+					pos = l.Pos()
+				}
+			}
+			for _, u := range uses {
+				if pos >= stmt.End() && pos < u.Pos() {
+					return nil, inlineVariableError(sym.Name() + " is used at " + fset.Position(u.Pos()).String() + " after it's operand " + id.Name + " is assigned at " + fset.Position(w.pos).String())
+				}
+			}
+		}
+		od, of := getFirstIdent(fset, osym)
+		_, aliased := wv.aliased[osym]
+		if aliased || od == nil || of != filename || od.Pos() < fn.Pos() || od.Pos() >= fn.End() {
+			for _, c := range calls.positions {
+				if c >= stmt.End() && c < lastUse {
+					return nil, inlineVariableError("operand " + id.Name + " may be changed by the call at " + fset.Position(c).String())
+				}
+			}
+		}
+	}
+
+	text := nodeText(fset, content, init)
+	if typ != nil {
+		tt := nodeText(fset, content, typ)
+		switch t := typ.(type) {
+		case *ast.StarExpr, *ast.FuncType:
+			tt = "(" + tt + ")"
+		case *ast.ChanType:
+			if t.Dir == ast.RECV {
+				tt = "(" + tt + ")"
+			}
+		}
+		text = tt + "(" + text + ")"
+	}
+	pv := &pureExprVisitor{programTree, pack, filename, func(st.Symbol) bool { return false }, make(map[*st.Package]map[*ast.Ident]bool), make(map[st.Symbol]bool), true}
+	edits := []*fileEdit{declEdit}
+	for _, u := range uses {
+		path := getNodePath(fset, file, u)
+		if path == nil {
+			return nil, inlineVariableError("couldn't find use of " + sym.Name() + " at " + fset.Position(u.Pos()).String())
+		}
+		if readsVariables {
+			for _, n := range path {
+				if l, ok := n.(*ast.FuncLit); ok && (stmt.Pos() < l.Pos() || stmt.Pos() >= l.End()) {
+					return nil, inlineVariableError(sym.Name() + " is used in a function literal at " + fset.Position(u.Pos()).String() + "; operands may have other values, when it's called")
+				}
+			}
+		}
+		t := text
+		if typ == nil {
+			if _, ok := path[len(path)-2].(*ast.BinaryExpr); ok && isConstantExpr(pv, init) {
+				// untyped constant would change the type of the operation
+				if bt, ok := packageParser.ParseExpr(init, pack, filename, identMap).(*st.BasicTypeSymbol); ok && bt.Name() != "bool" && bt.Name() != "string" {
+					t = bt.Name() + "(" + t + ")"
+				}
+			}
+			if t == text && needsParens(init, path) {
+				t = "(" + t + ")"
+			}
+		}
+		edits = append(edits, &fileEdit{fset.Position(u.Pos()).Offset, fset.Position(u.End()).Offset, t})
+	}
+	return edits, nil
+}
+
+// positions of calls and receive operations, that may have side effects
+type callPositionsVisitor struct {
+	identMap  st.IdentifierMap
+	positions []token.Pos
+}
+
+func (v *callPositionsVisitor) Visit(node ast.Node) ast.Visitor {
+	switch t := node.(type) {
+	case *ast.CallExpr:
+		if !isPureCall(v.identMap, t) {
+			v.positions = append(v.positions, t.Pos())
+		}
+	case *ast.UnaryExpr:
+		if t.Op == token.ARROW {
+			v.positions = append(v.positions, t.Pos())
+		}
+	}
+	return v
+}
@@ -0,0 +1,112 @@
+package refactoring
+
+import (
+	"refactoring/st"
+	"go/ast"
+	"strings"
+)
+
+// looks for deferred calls and calls of recover, that are executed by the body itself
+type deferRecoverVisitor struct {
+	identMap st.IdentifierMap
+	found    ast.Node
+}
+
+func (v *deferRecoverVisitor) Visit(node ast.Node) ast.Visitor {
+	if v.found != nil {
+		return nil
+	}
+	switch t := node.(type) {
+	case *ast.FuncLit:
+		return nil
+	case *ast.DeferStmt:
+		v.found = t
+	case *ast.CallExpr:
+		if id, ok := t.Fun.(*ast.Ident); ok && id.Name == "recover" {
+			if sym := v.identMap[id]; sym == nil || sym == st.Symbol(st.PredeclaredFunctions[id.Name]) {
+				v.found = t
+			}
+		}
+	}
+	return v
+}
+
+// true if the body uses named results of the callee
+func (ci *callInliner) namedResultsUsed() bool {
+	if ci.decl.Type.Results == nil {
+		return false
+	}
+	identMap := ci.programTree.IdentMap
+	named := make(map[st.Symbol]bool)
+	for _, f := range ci.decl.Type.Results.List {
+		for _, id := range f.Names {
+			named[identMap[id]] = true
+		}
+	}
+	for id, _ := range getIdentsInNode(ci.decl.Body) {
+		if named[identMap[id]] {
+			return true
+		}
+	}
+	return false
+}
+
+// True if the body can't be inlined as statements: deferred calls would run at the end of the caller,
+// recover would stop panics of the caller, and named results, inlined as a statement, would be left unused.
+// Calls of go and defer statements (path ends at the call) are wrapped too: their arguments are evaluated
+// at once, but the body must run later. Such calls are replaced with calls of function literals.
+func (ci *callInliner) needsWrapping(path []ast.Node, isStmt bool) bool {
+	if len(path) > 1 {
+		switch path[len(path)-2].(type) {
+		case *ast.GoStmt, *ast.DeferStmt:
+			return true
+		}
+	}
+	v := &deferRecoverVisitor{ci.programTree.IdentMap, nil}
+	ast.Walk(v, ci.decl.Body)
+	return v.found != nil || isStmt && ci.namedResultsUsed()
+}
+
+// Replaces the call with a call of a function literal, that has the signature and body of the callee,
+// so that deferred calls, recover and named results keep their meaning.
+// The reciever becomes the first parameter of the literal.
+func (ci *callInliner) wrapCall(callNode ast.Node, callExpr *ast.CallExpr, edits []*fileEdit) []*fileEdit {
+	fset := ci.pack.FileSet
+	start, end := fset.Position(callNode.Pos()).Offset, fset.Position(callNode.End()).Offset
+	indent := lineIndent(ci.content, start)
+
+	fields, args := []*ast.Field{}, []string{}
+	if ci.decl.Recv != nil {
+		fields = append(fields, ci.decl.Recv.List[0])
+		x := callExpr.Fun.(*ast.SelectorExpr).X
+		args = append(args, ci.recieverDeref(x)+nodeText(fset, ci.content, x))
+	}
+	fields = append(fields, ci.decl.Type.Params.List...)
+	for _, arg := range callExpr.Args {
+		args = append(args, nodeText(fset, ci.content, arg))
+	}
+	// parameters of the literal must be all named or all unnamed
+	named := false
+	for _, f := range fields {
+		named = named || len(f.Names) > 0
+	}
+	params := []string{}
+	for _, f := range fields {
+		text := ci.bodyText(f.Pos(), f.End(), edits, indent)
+		if named && len(f.Names) == 0 {
+			text = "_ " + text
+		}
+		params = append(params, text)
+	}
+
+	text := "func(" + strings.Join(params, ", ") + ")"
+	if r := ci.decl.Type.Results; r != nil {
+		from, to := r.List[0].Pos(), r.List[len(r.List)-1].End()
+		if r.Opening.IsValid() {
+			from, to = r.Opening, r.Closing+1
+		}
+		text += " " + ci.bodyText(from, to, edits, indent)
+	}
+	text += " " + ci.bodyText(ci.decl.Body.Pos(), ci.decl.Body.End(), edits, indent) + "(" + strings.Join(args, ", ") + ")"
+	return []*fileEdit{&fileEdit{start, end, text}}
+}
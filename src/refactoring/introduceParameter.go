@@ -0,0 +1,348 @@
+package refactoring
+
+import (
+	"refactoring/st"
+	"refactoring/errors"
+	"refactoring/program"
+	"refactoring/packageParser"
+	"go/ast"
+	"go/token"
+)
+
+func introduceParameterError(message string) *errors.GoRefactorError {
+	return &errors.GoRefactorError{ErrorType: "introduce parameter error", Message: message}
+}
+
+func CheckIntroduceParameterParameters(filename string, lineStart int, colStart int, lineEnd int, colEnd int, paramName string) (bool, *errors.GoRefactorError) {
+	if err := checkRangeParameters(filename, lineStart, colStart, lineEnd, colEnd); err != nil {
+		return false, err
+	}
+	if !IsGoIdent(paramName) {
+		return false, errors.ArgumentError("paramName", "It's not a valid go identifier")
+	}
+	return true, nil
+}
+
+// Turns expression in a function body into a new parameter of the function;
+// start position - where the expression starts;
+// end position - where the expression ends.
+// Every call of the function gets the expression as an argument, rewritten to the caller's context.
+func IntroduceParameter(filename string, lineStart int, colStart int, lineEnd int, colEnd int, paramName string) (bool, *errors.GoRefactorError) {
+	if ok, err := CheckIntroduceParameterParameters(filename, lineStart, colStart, lineEnd, colEnd, paramName); !ok {
+		return false, err
+	}
+	programTree := parseProgram(filename)
+	edits, err := introduceParameter(programTree, filename, lineStart, colStart, lineEnd, colEnd, paramName)
+	if err != nil {
+		return false, err
+	}
+	if err := applyFileEdits(programTree, edits); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// expression, moved from the function body to it's calls
+type movedExpr struct {
+	programTree *program.Program
+	pack        *st.Package
+	filename    string
+	file        *ast.File
+	content     []byte
+	expr        ast.Expr
+	idents      []*ast.Ident //identifiers, resolved in the function's scope
+	params      map[st.Symbol]int
+	reciever    st.Symbol
+}
+
+func introduceParameter(programTree *program.Program, filename string, lineStart int, colStart int, lineEnd int, colEnd int, paramName string) (map[string][]*fileEdit, *errors.GoRefactorError) {
+	pack, file := programTree.FindPackageAndFileByFilename(filename)
+	if pack == nil {
+		return nil, errors.ArgumentError("filename", "Program packages don't contain file '"+filename+"'")
+	}
+	fset := pack.FileSet
+	identMap := programTree.IdentMap
+
+	var path []ast.Node
+	ast.Walk(&exprPathVisitor{fset, token.Position{filename, 0, lineStart, colStart}, token.Position{filename, 0, lineEnd, colEnd}, nil, &path}, file)
+	if path == nil {
+		return nil, introduceParameterError("there is no expression with such bounds")
+	}
+	expr := path[len(path)-1].(ast.Expr)
+	if err := checkExtractableExpr(programTree, path); err != nil {
+		return nil, introduceParameterError(err.Message)
+	}
+	if isAssignedLocation(programTree, pack, filename, path) {
+		return nil, introduceParameterError("expression is assigned or addressed; it can't be replaced with a copy of it's value")
+	}
+	var decl *ast.FuncDecl
+	for _, n := range path {
+		if d, ok := n.(*ast.FuncDecl); ok {
+			decl = d
+		}
+	}
+	if decl == nil || decl.Body == nil || expr.Pos() < decl.Body.Pos() {
+		return nil, introduceParameterError("expression is not inside of a function body")
+	}
+	fsym, ok := identMap[decl.Name].(*st.FunctionSymbol)
+	if !ok {
+		return nil, introduceParameterError("unknown function " + decl.Name.Name)
+	}
+	if s := getImplementedInterfaces(programTree, fsym); s != "" {
+		return nil, introduceParameterError("method " + fsym.Name() + " implements an interface method:" + s)
+	}
+	old := getOldParams(decl.Type)
+	if len(old) > 0 && old[0].Name == nil {
+		return nil, introduceParameterError("parameters of the function are unnamed, new parameter can't be added")
+	}
+	selectors, members := getMemberIdents(programTree)
+	nv := &nameUsesVisitor{paramName, selectors, members, nil}
+	ast.Walk(nv, decl)
+	if nv.found != nil {
+		return nil, introduceParameterError("name " + paramName + " is already used in the function at " + fset.Position(nv.found.Pos()).String())
+	}
+
+	me := &movedExpr{programTree, pack, filename, file, nil, expr, nil, make(map[st.Symbol]int), nil}
+	for i, o := range old {
+		if sym := identMap[o.Name]; sym != nil {
+			me.params[sym] = i
+		}
+	}
+	if decl.Recv != nil && len(decl.Recv.List) > 0 && len(decl.Recv.List[0].Names) > 0 {
+		me.reciever = identMap[decl.Recv.List[0].Names[0]]
+	}
+	isParam := func(sym st.Symbol) bool {
+		_, ok := me.params[sym]
+		return ok || sym == me.reciever && sym != nil
+	}
+	fv := &freeIdentsVisitor{identMap, members, nil}
+	ast.Walk(fv, expr)
+	me.idents = fv.idents
+	for _, id := range me.idents {
+		sym := identMap[id]
+		if sym == nil || isParam(sym) {
+			continue
+		}
+		if d, _ := getFirstIdent(fset, sym); d != nil && d.Pos() >= decl.Pos() && d.Pos() < decl.End() && (d.Pos() < expr.Pos() || d.Pos() >= expr.End()) {
+			return nil, introduceParameterError("expression depends on " + sym.Name() + ", declared at " + fset.Position(d.Pos()).String() + ", that callers can't see")
+		}
+	}
+	pv := &pureExprVisitor{programTree, pack, filename, isParam, make(map[*st.Package]map[*ast.Ident]bool), make(map[st.Symbol]bool), true}
+	ast.Walk(pv, expr)
+	if !pv.pure {
+		return nil, introduceParameterError("expression may use only constants, types and parameters of the function and must have no side effects; otherwise it's value at the call could differ")
+	}
+	writes := []*variableWrite{}
+	loops := []ast.Node{}
+	wv := &writesVisitor{identMap, false, &writes, make(map[st.Symbol]bool), &loops}
+	ast.Walk(wv, decl.Body)
+	for sym, _ := range pv.vars {
+		if i, ok := me.params[sym]; ok && old[i].Variadic {
+			return nil, introduceParameterError("expression uses variadic parameter " + sym.Name())
+		}
+		changed := wv.aliased[sym]
+		for _, w := range writes {
+			changed = changed || w.sym == sym
+		}
+		if changed {
+			return nil, introduceParameterError("parameter " + sym.Name() + ", used in the expression, is changed in the function body")
+		}
+	}
+
+	var t st.ITypeSymbol
+	if isConstantExpr(pv, expr) {
+		if t = getUseType(programTree, pack, filename, pv, path); t == nil {
+			t = getDefaultType(programTree, pack, filename, expr)
+		}
+	} else {
+		t = packageParser.ParseExpr(expr, pack, filename, identMap)
+	}
+	typ, ok := typeName(pack, filename, t)
+	if !ok {
+		return nil, introduceParameterError("couldn't determine type of the expression or it's package isn't imported")
+	}
+
+	calls, values := getCallSites(programTree, fsym, decl)
+	if len(values) > 0 {
+		return nil, introduceParameterError("function " + fsym.Name() + " is used as a value, it's type must stay the same:" + sitePositions(values))
+	}
+
+	contents := make(fileContents)
+	var err *errors.GoRefactorError
+	if me.content, err = contents.read(filename); err != nil {
+		return nil, err
+	}
+	offset := func(fset *token.FileSet, pos token.Pos) int {
+		return fset.Position(pos).Offset
+	}
+	variadic := len(old) > 0 && old[len(old)-1].Variadic
+
+	edits := make(map[string][]*fileEdit)
+	edits[filename] = append(edits[filename], &fileEdit{offset(fset, expr.Pos()), offset(fset, expr.End()), paramName})
+	params := decl.Type.Params.List
+	switch {
+	case variadic:
+		offs := offset(fset, params[len(params)-1].Pos())
+		edits[filename] = append(edits[filename], &fileEdit{offs, offs, paramName + " " + typ + ", "})
+	case len(params) > 0:
+		offs := offset(fset, params[len(params)-1].End())
+		edits[filename] = append(edits[filename], &fileEdit{offs, offs, ", " + paramName + " " + typ})
+	default:
+		offs := offset(fset, decl.Type.Params.Opening) + 1
+		edits[filename] = append(edits[filename], &fileEdit{offs, offs, paramName + " " + typ})
+	}
+
+	for _, c := range calls {
+		cfset := c.pack.FileSet
+		pos := cfset.Position(c.call.Pos()).String()
+		args := c.call.Args
+		if passesMultipleResults(programTree, c.pack, c.filename, args[c.shift:]) {
+			return nil, introduceParameterError("call at " + pos + " passes results of a function call as arguments")
+		}
+		cc, err := contents.read(c.filename)
+		if err != nil {
+			return nil, err
+		}
+		arg, err := me.argumentAt(c, cc, old)
+		if err != nil {
+			return nil, err
+		}
+		ind := c.shift + len(old)
+		if variadic {
+			ind--
+		}
+		var edit *fileEdit
+		switch {
+		case ind < len(args):
+			offs := offset(cfset, args[ind].Pos())
+			edit = &fileEdit{offs, offs, arg + ", "}
+		case len(args) > 0:
+			offs := offset(cfset, args[len(args)-1].End())
+			edit = &fileEdit{offs, offs, ", " + arg}
+		default:
+			offs := offset(cfset, c.call.Lparen) + 1
+			edit = &fileEdit{offs, offs, arg}
+		}
+		edits[c.filename] = append(edits[c.filename], edit)
+	}
+	return edits, nil
+}
+
+// text of the expression in the context of the call
+func (me *movedExpr) argumentAt(c *callSite, content []byte, old []*oldParam) (string, *errors.GoRefactorError) {
+	identMap := me.programTree.IdentMap
+	fset, cfset := me.pack.FileSet, c.pack.FileSet
+	pos := cfset.Position(c.call.Pos()).String()
+	scope := c.pack.IdentScopes[c.fun]
+	visible := func(name string, sym st.Symbol) bool {
+		if scope == nil {
+			return true
+		}
+		found, ok := scope.LookUp(name, c.filename)
+		return ok && found == sym
+	}
+	offset := func(p token.Pos) int {
+		return fset.Position(p).Offset
+	}
+
+	res := ""
+	last := offset(me.expr.Pos())
+	for _, id := range me.idents {
+		sym := identMap[id]
+		if sym == nil {
+			continue
+		}
+		text := ""
+		switch s := sym.(type) {
+		case *st.PackageSymbol:
+			if c.pack.Imports[c.filename] == nil {
+				return "", introduceParameterError("package " + s.Name() + " isn't imported in " + c.filename)
+			}
+			imp := c.pack.GetImport(c.filename, s.Package)
+			if imp == nil {
+				return "", introduceParameterError("package " + s.Name() + " isn't imported in " + c.filename)
+			}
+			if !visible(imp.Name(), imp) {
+				return "", introduceParameterError("package name " + imp.Name() + " is shadowed at " + pos)
+			}
+			text = imp.Name()
+		default:
+			var argExpr ast.Expr
+			var prefix string
+			if i, ok := me.params[sym]; ok {
+				argExpr = c.call.Args[c.shift+i]
+			} else if sym == me.reciever {
+				if c.shift == 1 {
+					argExpr = c.call.Args[0]
+				} else {
+					argExpr = c.call.Fun.(*ast.SelectorExpr).X
+				}
+				rt := variableType(sym)
+				at := packageParser.ParseExpr(argExpr, c.pack, c.filename, identMap)
+				rp, rIsPtr := rt.(*st.PointerTypeSymbol)
+				ap, aIsPtr := at.(*st.PointerTypeSymbol)
+				rb, ab := rt, at
+				if rIsPtr {
+					rb = rp.BaseType
+				}
+				if aIsPtr {
+					ab = ap.BaseType
+				}
+				if rb != ab {
+					return "", introduceParameterError("method is called through an embedded field at " + pos)
+				}
+				switch {
+				case rIsPtr && !aIsPtr:
+					prefix = "&"
+				case !rIsPtr && aIsPtr:
+					prefix = "*"
+				}
+			}
+			if argExpr != nil {
+				if hasSideEffects(identMap, argExpr) {
+					return "", introduceParameterError("argument " + nodeText(cfset, content, argExpr) + " at " + pos + " has side effects; it would be evaluated twice")
+				}
+				text = nodeText(cfset, content, argExpr)
+				var e ast.Expr = argExpr
+				if prefix != "" {
+					switch argExpr.(type) {
+					case *ast.BinaryExpr, *ast.UnaryExpr, *ast.StarExpr:
+						text = "(" + text + ")"
+					}
+					text = prefix + text
+					e = &ast.UnaryExpr{argExpr.Pos(), token.AND, argExpr}
+				}
+				if needsParens(e, getNodePath(fset, me.file, id)) {
+					text = "(" + text + ")"
+				}
+				break
+			}
+			if p := sym.PackageFrom(); p == me.pack && c.pack != me.pack {
+				if !isExportedName(sym.Name()) {
+					return "", introduceParameterError("expression uses " + sym.Name() + ", that isn't exported from package " + me.pack.AstPackage.Name + " and can't be used at " + pos)
+				}
+				if c.pack.Imports[c.filename] == nil || c.pack.GetImport(c.filename, me.pack) == nil {
+					return "", introduceParameterError("package " + me.pack.AstPackage.Name + " isn't imported in " + c.filename)
+				}
+				imp := c.pack.GetImport(c.filename, me.pack)
+				if !visible(imp.Name(), imp) {
+					return "", introduceParameterError("package name " + imp.Name() + " is shadowed at " + pos)
+				}
+				text = imp.Name() + "." + id.Name
+				break
+			}
+			if !visible(id.Name, sym) {
+				return "", introduceParameterError(id.Name + " denotes another entity at " + pos)
+			}
+		}
+		if text != "" {
+			res += string(me.content[last:offset(id.Pos())]) + text
+			last = offset(id.End())
+		}
+	}
+	res += string(me.content[last:offset(me.expr.End())])
+	if needsParens(me.expr, appendToPath(c.path, me.expr)) {
+		res = "(" + res + ")"
+	}
+	return res, nil
+}
@@ -0,0 +1,267 @@
+package refactoring
+
+import (
+	"refactoring/st"
+	"refactoring/program"
+	"refactoring/errors"
+)
+
+// named types of the program
+
+func getNamedTypes(programTree *program.Program) []st.ITypeSymbol {
+	res := []st.ITypeSymbol{}
+	visited := make(map[st.Symbol]bool)
+	for _, pack := range programTree.Packages {
+		pack.Symbols.ForEachNoLock(func(sym st.Symbol) {
+			t, ok := sym.(st.ITypeSymbol)
+			if !ok || t.Name() == st.NO_NAME || t.PackageFrom() != pack {
+				return
+			}
+			switch t.(type) {
+			case *st.PointerTypeSymbol, *st.UnresolvedTypeSymbol, *st.BasicTypeSymbol:
+				return
+			}
+			if _, ok := visited[t]; ok {
+				return
+			}
+			visited[t] = true
+			res = append(res, t)
+		})
+	}
+	return res
+}
+
+// maps method tables to types they belong to
+func getMethodOwners(types []st.ITypeSymbol) map[*st.SymbolTable]st.ITypeSymbol {
+	res := make(map[*st.SymbolTable]st.ITypeSymbol)
+	for _, t := range types {
+		if t.Methods() != nil {
+			res[t.Methods()] = t
+		}
+	}
+	return res
+}
+
+func getMethodOwner(programTree *program.Program, meth *st.FunctionSymbol) st.ITypeSymbol {
+	owners := getMethodOwners(getNamedTypes(programTree))
+	if t, ok := owners[meth.Scope()]; ok {
+		return t
+	}
+	return nil
+}
+
+func qualifiedTypeName(t st.ITypeSymbol) string {
+	if t.PackageFrom() == nil || t.PackageFrom().AstPackage == nil {
+		return t.Name()
+	}
+	return t.PackageFrom().AstPackage.Name + "." + t.Name()
+}
+
+// method sets
+
+func forEachMethodInTable(table *st.SymbolTable, visited map[string]bool, toDo func(m *st.FunctionSymbol)) {
+	table.ForEachNoLock(func(sym st.Symbol) {
+		if m, ok := sym.(*st.FunctionSymbol); ok {
+			if _, ok := visited[m.Name()]; !ok {
+				visited[m.Name()] = true
+				toDo(m)
+			}
+		}
+	})
+	table.ForEachOpenedScope(func(scope *st.SymbolTable) {
+		forEachMethodInTable(scope, visited, toDo)
+	})
+}
+
+// iterates through interface methods, including methods of embedded interfaces
+func forEachInterfaceMethod(sI *st.InterfaceTypeSymbol, toDo func(m *st.FunctionSymbol)) {
+	if sI.Methods() == nil {
+		return
+	}
+	forEachMethodInTable(sI.Methods(), make(map[string]bool), toDo)
+}
+
+func lookUpMethod(t st.ITypeSymbol, name string) (*st.FunctionSymbol, bool) {
+	if t.Methods() == nil {
+		return nil, false
+	}
+	s, ok := t.Methods().LookUp(name, "")
+	if !ok {
+		return nil, false
+	}
+	m, ok := s.(*st.FunctionSymbol)
+	return m, ok
+}
+
+// true if the method is declared with a pointer reciever
+func hasPointerReciever(m *st.FunctionSymbol) bool {
+	ft, ok := m.FunctionType.(*st.FunctionTypeSymbol)
+	if !ok || ft.Reciever == nil {
+		return false
+	}
+	res := false
+	ft.Reciever.ForEachNoLock(func(sym st.Symbol) {
+		if v, ok := sym.(*st.VariableSymbol); ok {
+			if _, ok := v.VariableType.(*st.PointerTypeSymbol); ok {
+				res = true
+			}
+		}
+	})
+	return res
+}
+
+// true if method m of type t (declared or promoted) belongs to the method set of value t;
+// methods with pointer recievers are registered in the base type's method table,
+// so they're told apart by the reciever and by the way the declaring type is embedded
+func inValueMethodSet(t st.ITypeSymbol, m *st.FunctionSymbol) bool {
+	if m.Scope() == t.Methods() {
+		return !hasPointerReciever(m)
+	}
+	sT, ok := t.(*st.StructTypeSymbol)
+	if !ok {
+		return !hasPointerReciever(m)
+	}
+	res := false
+	sT.Fields.ForEachNoLock(func(f st.Symbol) {
+		e, ok := f.(st.ITypeSymbol)
+		if !ok || res {
+			return
+		}
+		if pt, ok := e.(*st.PointerTypeSymbol); ok {
+			if em, ok := lookUpMethod(pt.BaseType, m.Name()); ok && em == m {
+				res = true
+			}
+			return
+		}
+		if em, ok := lookUpMethod(e, m.Name()); ok && em == m {
+			res = inValueMethodSet(e, m)
+		}
+	})
+	return res
+}
+
+// true if type sT (or *sT, if pointer is set) has all methods of interface sI
+func implementsInterface(sT st.ITypeSymbol, sI *st.InterfaceTypeSymbol, pointer bool) bool {
+	if _, ok := sT.(*st.InterfaceTypeSymbol); ok {
+		return false
+	}
+	res := true
+	forEachInterfaceMethod(sI, func(m *st.FunctionSymbol) {
+		if !res {
+			return
+		}
+		if ok, err := containsMethod(m, sT); !ok || err != nil {
+			res = false
+			return
+		}
+		if impl, ok := lookUpMethod(sT, m.Name()); !pointer && ok && !inValueMethodSet(sT, impl) {
+			res = false
+		}
+	})
+	return res
+}
+
+// implementation relation between types and interfaces, that connects two methods
+type methodBinding struct {
+	Type      st.ITypeSymbol
+	Interface *st.InterfaceTypeSymbol
+	Method    *st.FunctionSymbol //interface method
+	ImplMeth  *st.FunctionSymbol //method of the type, possibly promoted from an embedded field
+	Pointer   bool               //only *Type satisfies Interface
+}
+
+func bindingTypeName(b *methodBinding) string {
+	if b.Pointer {
+		return "*" + qualifiedTypeName(b.Type)
+	}
+	return qualifiedTypeName(b.Type)
+}
+
+// getConnectedMethods computes a set of interface methods and concrete methods,
+// that have to be changed together with meth to keep the implementation relation.
+// Returns the set (method -> type, that declares it) and list of bindings met.
+func getConnectedMethods(programTree *program.Program, meth *st.FunctionSymbol) (map[*st.FunctionSymbol]st.ITypeSymbol, []*methodBinding) {
+	types := getNamedTypes(programTree)
+	owners := getMethodOwners(types)
+
+	result := make(map[*st.FunctionSymbol]st.ITypeSymbol)
+	bindings := []*methodBinding{}
+	queue := []*st.FunctionSymbol{meth}
+	result[meth] = owners[meth.Scope()]
+
+	add := func(m *st.FunctionSymbol) {
+		if _, ok := result[m]; !ok {
+			result[m] = owners[m.Scope()]
+			queue = append(queue, m)
+		}
+	}
+
+	for len(queue) > 0 {
+		m := queue[0]
+		queue = queue[1:]
+
+		if iface, ok := result[m].(*st.InterfaceTypeSymbol); ok {
+			for _, t := range types {
+				impl, ok := lookUpMethod(t, m.Name())
+				if !ok || !implementsInterface(t, iface, true) {
+					continue
+				}
+				bindings = append(bindings, &methodBinding{t, iface, m, impl, !implementsInterface(t, iface, false)})
+				add(impl)
+			}
+			continue
+		}
+		//types, that have m in their method set (declared or promoted)
+		for _, t := range types {
+			if _, ok := t.(*st.InterfaceTypeSymbol); ok {
+				continue
+			}
+			if impl, ok := lookUpMethod(t, m.Name()); !ok || impl != m {
+				continue
+			}
+			for _, it := range types {
+				iface, ok := it.(*st.InterfaceTypeSymbol)
+				if !ok {
+					continue
+				}
+				im, ok := lookUpMethod(iface, m.Name())
+				if !ok || !implementsInterface(t, iface, true) {
+					continue
+				}
+				bindings = append(bindings, &methodBinding{t, iface, im, m, !implementsInterface(t, iface, false)})
+				add(im)
+			}
+		}
+	}
+	return result, bindings
+}
+
+// checks that every method of the connected set can be renamed;
+// otherwise reports bindings that would be broken by a partial rename
+func checkConnectedMethods(methods map[*st.FunctionSymbol]st.ITypeSymbol, bindings []*methodBinding) *errors.GoRefactorError {
+	unrenamable := make(map[*st.FunctionSymbol]bool)
+	for m, _ := range methods {
+		if m.PackageFrom() == nil || m.PackageFrom().IsGoPackage {
+			unrenamable[m] = true
+		}
+	}
+	if len(unrenamable) == 0 {
+		return nil
+	}
+	s := ""
+	for _, b := range bindings {
+		_, im := unrenamable[b.Method]
+		_, tm := unrenamable[b.ImplMeth]
+		if im != tm {
+			s += "\n\t" + bindingTypeName(b) + " would stop satisfying " + qualifiedTypeName(b.Interface) + " (method " + b.Method.Name() + ")"
+		}
+	}
+	return errors.UnrenamableIdentifierError(methodsName(methods), "It's connected with methods, imported from go library:"+s)
+}
+
+func methodsName(methods map[*st.FunctionSymbol]st.ITypeSymbol) string {
+	for m, _ := range methods {
+		return m.Name()
+	}
+	return ""
+}
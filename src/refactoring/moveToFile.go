@@ -0,0 +1,398 @@
+package refactoring
+
+import (
+	"refactoring/st"
+	"refactoring/utils"
+	"refactoring/errors"
+	"refactoring/program"
+	"go/ast"
+	"go/token"
+	"io/ioutil"
+	"sort"
+	"strconv"
+)
+
+// extends range to whole lines, if there is nothing but spaces around it
+func extendToLines(content []byte, start int, end int) (int, int) {
+	s := start
+	for s > 0 && (content[s-1] == ' ' || content[s-1] == '\t') {
+		s--
+	}
+	if s == 0 || content[s-1] == '\n' {
+		start = s
+	}
+	e := end
+	for e < len(content) && (content[e] == ' ' || content[e] == '\t' || content[e] == '\r') {
+		e++
+	}
+	if e == len(content) || content[e] == '\n' {
+		end = e
+		if end < len(content) {
+			end++
+		}
+	}
+	return start, end
+}
+
+// range of node in file, including it's doc comment and comment on the same line after it
+func getNodeRange(fset *token.FileSet, file *ast.File, content []byte, node ast.Node, doc *ast.CommentGroup) (start int, end int) {
+	pos := node.Pos()
+	if doc != nil {
+		pos = doc.Pos()
+	}
+	start, end = fset.Position(pos).Offset, fset.Position(node.End()).Offset
+	line := fset.Position(node.End()).Line
+	for _, cg := range file.Comments {
+		if cg.Pos() >= node.End() && fset.Position(cg.Pos()).Line == line {
+			end = fset.Position(cg.End()).Offset
+		}
+	}
+	return extendToLines(content, start, end)
+}
+
+func getDeclRange(fset *token.FileSet, file *ast.File, content []byte, decl ast.Decl) (start int, end int) {
+	switch t := decl.(type) {
+	case *ast.FuncDecl:
+		return getNodeRange(fset, file, content, t, t.Doc)
+	case *ast.GenDecl:
+		return getNodeRange(fset, file, content, t, t.Doc)
+	}
+	panic("unknown declaration type")
+}
+
+// range of import spec; single import is removed with the whole declaration
+func getImportSpecRange(fset *token.FileSet, file *ast.File, content []byte, spec *ast.ImportSpec) (start int, end int, ok bool) {
+	for _, d := range file.Decls {
+		gd, isGen := d.(*ast.GenDecl)
+		if !isGen || gd.Tok != token.IMPORT {
+			continue
+		}
+		for _, s := range gd.Specs {
+			if s != spec {
+				continue
+			}
+			if gd.Lparen == token.NoPos {
+				start, end = getDeclRange(fset, file, content, gd)
+			} else {
+				start, end = getNodeRange(fset, file, content, spec, spec.Doc)
+			}
+			return start, end, true
+		}
+	}
+	return 0, 0, false
+}
+
+// top-level declaration of the symbol and the file, it's declared in
+func getTopLevelDecl(programTree *program.Program, pack *st.Package, sym st.Symbol) (ast.Decl, string, *errors.GoRefactorError) {
+	for name, f := range pack.AstPackage.Files {
+		for _, d := range f.Decls {
+			switch t := d.(type) {
+			case *ast.FuncDecl:
+				if programTree.IdentMap[t.Name] == sym {
+					return t, name, nil
+				}
+			case *ast.GenDecl:
+				if t.Tok == token.IMPORT {
+					continue
+				}
+				for _, spec := range t.Specs {
+					switch s := spec.(type) {
+					case *ast.TypeSpec:
+						if programTree.IdentMap[s.Name] != sym {
+							continue
+						}
+						if len(t.Specs) > 1 {
+							return nil, "", &errors.GoRefactorError{ErrorType: "move error", Message: "type " + sym.Name() + " is declared in a group with other types, can't move it alone"}
+						}
+						return t, name, nil
+					case *ast.ValueSpec:
+						for _, id := range s.Names {
+							if programTree.IdentMap[id] == sym {
+								return t, name, nil
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+	return nil, "", &errors.GoRefactorError{ErrorType: "move error", Message: "symbol " + sym.Name() + " is not declared at the top level of package " + pack.AstPackage.Name}
+}
+
+// declarations of methods of type t in the package, grouped by files
+func getTypeMethodDecls(programTree *program.Program, pack *st.Package, t st.Symbol) map[string][]ast.Decl {
+	res := make(map[string][]ast.Decl)
+	for name, f := range pack.AstPackage.Files {
+		for _, d := range f.Decls {
+			fdecl, ok := d.(*ast.FuncDecl)
+			if !ok || fdecl.Recv == nil || len(fdecl.Recv.List) == 0 {
+				continue
+			}
+			recvType := fdecl.Recv.List[0].Type
+			if star, ok := recvType.(*ast.StarExpr); ok {
+				recvType = star.X
+			}
+			if id, ok := recvType.(*ast.Ident); ok && programTree.IdentMap[id] == t {
+				res[name] = append(res[name], d)
+			}
+		}
+	}
+	return res
+}
+
+// collects imports of the file, used by visited nodes
+type usedImportsVisitor struct {
+	identMap st.IdentifierMap
+	imports  []*st.PackageSymbol
+	used     map[*st.PackageSymbol]bool
+}
+
+func (v *usedImportsVisitor) Visit(node ast.Node) ast.Visitor {
+	switch t := node.(type) {
+	case *ast.SelectorExpr:
+		ast.Walk(v, t.X)
+		return nil
+	case *ast.Ident:
+		sym, ok := v.identMap[t]
+		if !ok || sym == nil {
+			return nil
+		}
+		if ps, ok := sym.(*st.PackageSymbol); ok {
+			v.used[ps] = true
+			return nil
+		}
+		for _, ps := range v.imports {
+			if ps.Name() == "." && ps.Package == sym.PackageFrom() {
+				v.used[ps] = true
+			}
+		}
+	}
+	return v
+}
+
+func getFileImports(pack *st.Package, filename string) []*st.PackageSymbol {
+	res := []*st.PackageSymbol{}
+	if imps, ok := pack.Imports[filename]; ok && imps != nil {
+		for _, el := range *imps {
+			res = append(res, el.(*st.PackageSymbol))
+		}
+	}
+	return res
+}
+
+// imports of the file, used by given declarations
+func getUsedImports(programTree *program.Program, pack *st.Package, filename string, decls []ast.Decl) map[*st.PackageSymbol]bool {
+	v := &usedImportsVisitor{programTree.IdentMap, getFileImports(pack, filename), make(map[*st.PackageSymbol]bool)}
+	for _, d := range decls {
+		if gd, ok := d.(*ast.GenDecl); ok && gd.Tok == token.IMPORT {
+			continue
+		}
+		ast.Walk(v, d)
+	}
+	return v.used
+}
+
+// text of import spec, as it's written in the file
+func getImportText(pack *st.Package, file *ast.File, ps *st.PackageSymbol) string {
+	res := "import "
+	if spec := findImportDecl(pack, file, ps); spec != nil && spec.Name != nil {
+		res += spec.Name.Name + " "
+	}
+	return res + strconv.Quote(ps.ShortPath) + "\n"
+}
+
+// edits, that remove imports of the file, used only by removed declarations;
+// imports of kept packages stay
+func getUnusedImportsEdits(programTree *program.Program, pack *st.Package, filename string, content []byte, removed map[ast.Decl]bool, kept map[*st.Package]bool) []*fileEdit {
+	_, file := programTree.FindPackageAndFileByFilename(filename)
+	rest, moved := []ast.Decl{}, []ast.Decl{}
+	for _, d := range file.Decls {
+		if _, ok := removed[d]; ok {
+			moved = append(moved, d)
+		} else {
+			rest = append(rest, d)
+		}
+	}
+	usedByRest := getUsedImports(programTree, pack, filename, rest)
+	res := []*fileEdit{}
+	for ps, _ := range getUsedImports(programTree, pack, filename, moved) {
+		if _, ok := usedByRest[ps]; ok || kept[ps.Package] {
+			continue
+		}
+		spec := findImportDecl(pack, file, ps)
+		if spec == nil {
+			continue
+		}
+		if start, end, ok := getImportSpecRange(pack.FileSet, file, content, spec); ok {
+			res = append(res, &fileEdit{start, end, ""})
+		}
+	}
+	return res
+}
+
+// text of imports, that have to be added to the target file for declarations moved from source files;
+// fails if target file imports the same package with another name or another package with the same name
+func getImportsToAdd(programTree *program.Program, pack *st.Package, moved map[string][]ast.Decl, targetPack *st.Package, targetFile string) (string, *errors.GoRefactorError) {
+	targetImports := getFileImports(targetPack, targetFile)
+	added := make(map[string]bool)
+	res := ""
+	for f, decls := range moved {
+		_, file := programTree.FindPackageAndFileByFilename(f)
+		for ps, _ := range getUsedImports(programTree, pack, f, decls) {
+			if ps.Package == targetPack {
+				continue
+			}
+			found := false
+			for _, tps := range targetImports {
+				switch {
+				case tps.ShortPath == ps.ShortPath && tps.Name() == ps.Name():
+					found = true
+				case tps.ShortPath == ps.ShortPath && ps.Name() != ".":
+					return "", &errors.GoRefactorError{ErrorType: "move error", Message: "package \"" + ps.ShortPath + "\" is imported as " + tps.Name() + " in " + targetFile + ", moved code refers to it as " + ps.Name()}
+				case tps.Name() == ps.Name() && ps.Name() != ".":
+					return "", &errors.GoRefactorError{ErrorType: "move error", Message: "name " + ps.Name() + " refers to package \"" + tps.ShortPath + "\" in " + targetFile + ", moved code refers to \"" + ps.ShortPath + "\" with it"}
+				}
+			}
+			text := getImportText(pack, file, ps)
+			if _, ok := added[text]; found || ok {
+				continue
+			}
+			added[text] = true
+			res += text
+		}
+	}
+	return res, nil
+}
+
+func CheckMoveToFileParameters(filename string, line int, column int, targetFile string) (bool, *errors.GoRefactorError) {
+	switch {
+	case filename == "" || !utils.IsGoFile(filename):
+		return false, errors.ArgumentError("filename", "It's not a valid go file name")
+	case line < 1:
+		return false, errors.ArgumentError("line", "Must be > 1")
+	case column < 1:
+		return false, errors.ArgumentError("column", "Must be > 1")
+	case targetFile == "" || !utils.IsGoFile(targetFile):
+		return false, errors.ArgumentError("targetFile", "It's not a valid go file name")
+	}
+	return true, nil
+}
+
+// Moves top-level declaration of the symbol at given position to targetFile of the same package.
+// If withMethods is set and the symbol is a type, it's methods are moved too.
+func MoveToFile(filename string, line int, column int, targetFile string, withMethods bool) (bool, *errors.GoRefactorError) {
+	if ok, err := CheckMoveToFileParameters(filename, line, column, targetFile); !ok {
+		return false, err
+	}
+	programTree := parseProgram(filename)
+	edits, err := moveToFile(programTree, filename, line, column, targetFile, withMethods)
+	if err != nil {
+		return false, err
+	}
+	if err := applyFileEdits(programTree, edits); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// declarations to move: declaration of sym and, if needed, methods of type sym, grouped by files
+func getDeclsToMove(programTree *program.Program, pack *st.Package, sym st.Symbol, withMethods bool) (map[string][]ast.Decl, *errors.GoRefactorError) {
+	decl, declFile, err := getTopLevelDecl(programTree, pack, sym)
+	if err != nil {
+		return nil, err
+	}
+	moved := map[string][]ast.Decl{declFile: []ast.Decl{decl}}
+	if _, ok := sym.(st.ITypeSymbol); ok && withMethods {
+		for f, decls := range getTypeMethodDecls(programTree, pack, sym) {
+			moved[f] = append(moved[f], decls...)
+		}
+	}
+	return moved, nil
+}
+
+// applies edits, that lie within [start,end) of content, to this part of content
+func applyEditsInRange(content []byte, start int, end int, edits []*fileEdit) string {
+	inRange := []*fileEdit{}
+	for _, e := range edits {
+		if e.Start >= start && e.End <= end {
+			inRange = append(inRange, e)
+		}
+	}
+	sort.Sort(fileEditCollection(inRange))
+	text := string(content[start:end])
+	for _, e := range inRange {
+		text = text[:e.Start-start] + e.Text + text[e.End-start:]
+	}
+	return text
+}
+
+// edits, that remove moved declarations and imports, that become unused, from their files;
+// returns removed text too, with inner edits applied to it
+func getRemoveDeclsEdits(programTree *program.Program, pack *st.Package, moved map[string][]ast.Decl, inner map[string][]*fileEdit, edits map[string][]*fileEdit) (string, *errors.GoRefactorError) {
+	text := ""
+	for f, decls := range moved {
+		_, file := programTree.FindPackageAndFileByFilename(f)
+		content, err := ioutil.ReadFile(f)
+		if err != nil {
+			return "", &errors.GoRefactorError{ErrorType: "move error", Message: "couldn't read file " + f + ": " + err.String()}
+		}
+		removed := make(map[ast.Decl]bool)
+		for _, d := range decls {
+			removed[d] = true
+		}
+		//keep the order of declarations
+		for _, d := range file.Decls {
+			if _, ok := removed[d]; !ok {
+				continue
+			}
+			start, end := getDeclRange(pack.FileSet, file, content, d)
+			text += "\n" + applyEditsInRange(content, start, end, inner[f])
+			edits[f] = append(edits[f], &fileEdit{start, end, ""})
+		}
+		edits[f] = append(edits[f], getUnusedImportsEdits(programTree, pack, f, content, removed, nil)...)
+	}
+	return text, nil
+}
+
+func moveToFile(programTree *program.Program, filename string, line int, column int, targetFile string, withMethods bool) (map[string][]*fileEdit, *errors.GoRefactorError) {
+	sym, err := programTree.FindSymbolByPosition(filename, line, column)
+	if err != nil {
+		return nil, err
+	}
+	pack := sym.PackageFrom()
+	if pack == nil || pack.IsGoPackage {
+		return nil, &errors.GoRefactorError{ErrorType: "move error", Message: "symbol " + sym.Name() + " doesn't belong to the program"}
+	}
+	targetPack, target := programTree.FindPackageAndFileByFilename(targetFile)
+	if targetPack != pack {
+		return nil, errors.ArgumentError("targetFile", "It's not a file of package "+pack.AstPackage.Name)
+	}
+	moved, err := getDeclsToMove(programTree, pack, sym, withMethods)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := moved[targetFile]; ok && len(moved) == 1 {
+		return nil, errors.ArgumentError("targetFile", "Declaration is already in "+targetFile)
+	}
+	moved[targetFile] = nil, false
+
+	importsText, err := getImportsToAdd(programTree, pack, moved, pack, targetFile)
+	if err != nil {
+		return nil, err
+	}
+	edits := make(map[string][]*fileEdit)
+	text, err := getRemoveDeclsEdits(programTree, pack, moved, nil, edits)
+	if err != nil {
+		return nil, err
+	}
+	content, rerr := ioutil.ReadFile(targetFile)
+	if rerr != nil {
+		return nil, &errors.GoRefactorError{ErrorType: "move error", Message: "couldn't read file " + targetFile + ": " + rerr.String()}
+	}
+	if importsText != "" {
+		offs := pack.FileSet.Position(target.Name.End()).Offset
+		edits[targetFile] = append(edits[targetFile], &fileEdit{offs, offs, "\n\n" + importsText})
+	}
+	edits[targetFile] = append(edits[targetFile], &fileEdit{len(content), len(content), text})
+	return edits, nil
+}
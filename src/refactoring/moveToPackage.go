@@ -0,0 +1,520 @@
+package refactoring
+
+import (
+	"refactoring/st"
+	"refactoring/errors"
+	"refactoring/program"
+	"go/ast"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// collects identifiers of a file; selectors with a package on the left side are remembered
+type moveRefsVisitor struct {
+	identMap  st.IdentifierMap
+	idents    []*ast.Ident
+	qualified map[*ast.Ident]*ast.SelectorExpr //Sel -> pkg.Sel
+	selectors map[*ast.Ident]bool
+}
+
+func (v *moveRefsVisitor) Visit(node ast.Node) ast.Visitor {
+	switch t := node.(type) {
+	case *ast.ImportSpec:
+		return nil
+	case *ast.SelectorExpr:
+		v.selectors[t.Sel] = true
+		if x, ok := t.X.(*ast.Ident); ok {
+			if _, ok := v.identMap[x].(*st.PackageSymbol); ok {
+				v.qualified[t.Sel] = t
+			}
+		}
+	case *ast.Ident:
+		v.idents = append(v.idents, t)
+	}
+	return v
+}
+
+// state of the move of declarations to another package
+type packageMove struct {
+	programTree *program.Program
+	pack        *st.Package //old package
+	targetPack  *st.Package
+	targetFile  string
+	moved       map[string][]ast.Decl
+	movedRanges map[string][][2]int
+	movedSyms   map[st.Symbol]bool //top-level symbols, declared by moved declarations
+	newNames    map[st.Symbol]string
+	contents    fileContents
+	refs        map[string]*moveRefsVisitor
+}
+
+func (pm *packageMove) offset(pos token.Pos) int {
+	return pm.pack.FileSet.Position(pos).Offset
+}
+
+func (pm *packageMove) position(p *st.Package, pos token.Pos) token.Position {
+	return p.FileSet.Position(pos)
+}
+
+// true if node of file f lies within moved declarations
+func (pm *packageMove) inMoved(p *st.Package, f string, pos token.Pos) bool {
+	if p != pm.pack {
+		return false
+	}
+	offs := p.FileSet.Position(pos).Offset
+	for _, r := range pm.movedRanges[f] {
+		if offs >= r[0] && offs < r[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// local name, the file refers to imported package with;
+// if package isn't imported, a free name is chosen
+func importName(p *st.Package, f string, imported *st.Package) (name string, exists bool) {
+	imps := getFileImports(p, f)
+	for _, ps := range imps {
+		if ps.Package == imported {
+			return ps.Name(), true
+		}
+	}
+	base := imported.AstPackage.Name
+	name = base
+	for i := 1; ; i++ {
+		free := true
+		for _, ps := range imps {
+			if ps.Name() == name {
+				free = false
+			}
+		}
+		if _, ok := declaredInTable(p.Symbols, name, nil); ok {
+			free = false
+		}
+		if free {
+			return name, false
+		}
+		name = base + strconv.Itoa(i)
+	}
+	panic("unreachable code")
+}
+
+func importSpecText(name string, imported *st.Package, defaultName bool) string {
+	if defaultName {
+		return "import " + strconv.Quote(imported.GoPath) + "\n"
+	}
+	return "import " + name + " " + strconv.Quote(imported.GoPath) + "\n"
+}
+
+func qualify(name string, ident string) string {
+	if name == "." {
+		return ident
+	}
+	return name + "." + ident
+}
+
+func CheckMoveToPackageParameters(filename string, line int, column int, targetDir string) (bool, *errors.GoRefactorError) {
+	if err := checkPositionParameters(filename, line, column); err != nil {
+		return false, err
+	}
+	if targetDir == "" {
+		return false, errors.ArgumentError("targetDir", "Must be a directory of a package")
+	}
+	return true, nil
+}
+
+// Moves top-level declaration of the symbol at given position to the package, located in targetDir.
+// Types are moved with their methods. Moved symbols, used outside of moved code, are exported;
+// references are rewritten to newpkg.Name, imports are added and removed.
+func MoveToPackage(filename string, line int, column int, targetDir string) (bool, *errors.GoRefactorError) {
+	if ok, err := CheckMoveToPackageParameters(filename, line, column, targetDir); !ok {
+		return false, err
+	}
+	programTree := parseProgram(filename)
+	edits, newFile, header, err := moveToPackage(programTree, filename, line, column, path.Clean(targetDir))
+	if err != nil {
+		return false, err
+	}
+	//new file must exist before edits are applied to it; edits are parsed before anything is saved,
+	//so on error it's enough to remove it
+	if newFile != "" {
+		if err := ioutil.WriteFile(newFile, []byte(header), 0666); err != nil {
+			return false, &errors.GoRefactorError{ErrorType: "move error", Message: "couldn't create file " + newFile + ": " + err.String()}
+		}
+	}
+	if err := applyFileEdits(programTree, edits); err != nil {
+		if newFile != "" {
+			os.Remove(newFile)
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func moveToPackage(programTree *program.Program, filename string, line int, column int, targetDir string) (edits map[string][]*fileEdit, newFile string, header string, err *errors.GoRefactorError) {
+	sym, err := programTree.FindSymbolByPosition(filename, line, column)
+	if err != nil {
+		return nil, "", "", err
+	}
+	pack := sym.PackageFrom()
+	if pack == nil || pack.IsGoPackage {
+		return nil, "", "", &errors.GoRefactorError{ErrorType: "move error", Message: "symbol " + sym.Name() + " doesn't belong to the program"}
+	}
+	targetPack, ok := programTree.Packages[targetDir]
+	if !ok || targetPack.IsGoPackage {
+		return nil, "", "", errors.ArgumentError("targetDir", "Program doesn't contain package in "+targetDir)
+	}
+	if targetPack == pack {
+		return nil, "", "", errors.ArgumentError("targetDir", "Declaration is already in package "+pack.AstPackage.Name+", use mvf to move it to another file")
+	}
+	if meth, ok := sym.(*st.FunctionSymbol); ok && getMethodOwner(programTree, meth) != nil {
+		return nil, "", "", &errors.GoRefactorError{ErrorType: "move error", Message: "method " + sym.Name() + " can be moved only with it's type"}
+	}
+	moved, err := getDeclsToMove(programTree, pack, sym, true)
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	pm := &packageMove{programTree, pack, targetPack, "", moved, make(map[string][][2]int), make(map[st.Symbol]bool), make(map[st.Symbol]string), make(fileContents), make(map[string]*moveRefsVisitor)}
+	_, declFile, _ := getTopLevelDecl(programTree, pack, sym)
+	for f, decls := range moved {
+		_, file := programTree.FindPackageAndFileByFilename(f)
+		content, err := pm.contents.read(f)
+		if err != nil {
+			return nil, "", "", err
+		}
+		for _, d := range decls {
+			start, end := getDeclRange(pack.FileSet, file, content, d)
+			pm.movedRanges[f] = append(pm.movedRanges[f], [2]int{start, end})
+			pm.addMovedSyms(d)
+		}
+	}
+	for _, p := range programTree.Packages {
+		if p.IsGoPackage {
+			continue
+		}
+		for f, file := range p.AstPackage.Files {
+			v := &moveRefsVisitor{programTree.IdentMap, nil, make(map[*ast.Ident]*ast.SelectorExpr), make(map[*ast.Ident]bool)}
+			ast.Walk(v, file)
+			pm.refs[f] = v
+		}
+	}
+
+	//target file: the file with the same name in target package or a new one
+	pm.targetFile = path.Join(targetDir, path.Base(declFile))
+	if _, err := os.Stat(pm.targetFile); err != nil {
+		newFile = pm.targetFile
+		header = "package " + targetPack.AstPackage.Name + "\n"
+		pm.contents[newFile] = []byte(header)
+	} else if p, _ := programTree.FindPackageAndFileByFilename(pm.targetFile); p != targetPack {
+		return nil, "", "", errors.ArgumentError("targetDir", "File "+pm.targetFile+" exists, but doesn't belong to package "+targetPack.AstPackage.Name)
+	}
+
+	if err := pm.checkUnexportedRefs(); err != nil {
+		return nil, "", "", err
+	}
+	if err := pm.chooseNames(); err != nil {
+		return nil, "", "", err
+	}
+	edits, inner, newImports, usesOldPack, err := pm.getReferenceEdits()
+	if err != nil {
+		return nil, "", "", err
+	}
+	if err := pm.checkImportCycles(newImports, usesOldPack); err != nil {
+		return nil, "", "", err
+	}
+
+	text, err := getRemoveDeclsEdits(programTree, pack, moved, inner, edits)
+	if err != nil {
+		return nil, "", "", err
+	}
+	importsText, err := getImportsToAdd(programTree, pack, moved, targetPack, pm.targetFile)
+	if err != nil {
+		return nil, "", "", err
+	}
+	if usesOldPack {
+		if name, exists := importName(targetPack, pm.targetFile, pack); !exists {
+			importsText += importSpecText(name, pack, name == pack.AstPackage.Name)
+		}
+	}
+	content, _ := pm.contents.read(pm.targetFile)
+	if importsText != "" {
+		offs := len("package " + targetPack.AstPackage.Name)
+		if newFile == "" {
+			_, target := programTree.FindPackageAndFileByFilename(pm.targetFile)
+			offs = targetPack.FileSet.Position(target.Name.End()).Offset
+		}
+		edits[pm.targetFile] = append(edits[pm.targetFile], &fileEdit{offs, offs, "\n\n" + importsText})
+	}
+	edits[pm.targetFile] = append(edits[pm.targetFile], &fileEdit{len(content), len(content), text})
+	return edits, newFile, header, nil
+}
+
+func (pm *packageMove) addMovedSyms(d ast.Decl) {
+	switch t := d.(type) {
+	case *ast.FuncDecl:
+		if t.Recv == nil {
+			pm.movedSyms[pm.programTree.IdentMap[t.Name]] = true
+		}
+	case *ast.GenDecl:
+		for _, spec := range t.Specs {
+			switch s := spec.(type) {
+			case *ast.TypeSpec:
+				pm.movedSyms[pm.programTree.IdentMap[s.Name]] = true
+			case *ast.ValueSpec:
+				for _, id := range s.Names {
+					if id.Name != "_" {
+						pm.movedSyms[pm.programTree.IdentMap[id]] = true
+					}
+				}
+			}
+		}
+	}
+}
+
+// true if field or method is declared within moved code (it's a member of a moved type)
+func (pm *packageMove) declaredInMoved(sym st.Symbol, members map[*ast.Ident]bool) bool {
+	for id, _ := range sym.Identifiers() {
+		if _, ok := members[id]; !ok {
+			continue
+		}
+		pos := pm.pack.FileSet.Position(id.Pos())
+		return pm.inMoved(pm.pack, pos.Filename, id.Pos())
+	}
+	return false
+}
+
+// moved code can't refer to unexported identifiers of the old package,
+// code left in the old package can't refer to unexported fields and methods of moved types
+func (pm *packageMove) checkUnexportedRefs() *errors.GoRefactorError {
+	_, members := getMemberIdents(pm.programTree)
+	isMember := func(sym st.Symbol) bool {
+		for id, _ := range sym.Identifiers() {
+			if _, ok := members[id]; ok {
+				return true
+			}
+		}
+		return false
+	}
+	s := ""
+	for f, v := range pm.refs {
+		p, _ := pm.programTree.FindPackageAndFileByFilename(f)
+		for _, id := range v.idents {
+			sym, ok := pm.programTree.IdentMap[id]
+			if !ok || sym == nil || sym.PackageFrom() != pm.pack || isExportedName(sym.Name()) {
+				continue
+			}
+			topLevel := sym.Scope() == pm.pack.Symbols && !isPackageSymbol(sym)
+			if !topLevel && !isMember(sym) {
+				continue
+			}
+			if _, ok := pm.movedSyms[sym]; ok {
+				continue
+			}
+			inMoved := pm.inMoved(p, f, id.Pos())
+			switch {
+			case inMoved && !pm.declaredInMoved(sym, members):
+				s += "\n\t" + pm.position(p, id.Pos()).String() + ": moved code refers to unexported " + sym.Name()
+			case !inMoved && isMember(sym) && pm.declaredInMoved(sym, members):
+				s += "\n\t" + pm.position(p, id.Pos()).String() + ": unexported member " + sym.Name() + " of moved type is used"
+			}
+		}
+	}
+	if s != "" {
+		return &errors.GoRefactorError{ErrorType: "move error", Message: "unexported identifiers are used across packages:" + s}
+	}
+	return nil
+}
+
+// moved symbols, used outside of moved code, are exported
+func (pm *packageMove) chooseNames() *errors.GoRefactorError {
+	used := make(map[st.Symbol]bool)
+	for f, v := range pm.refs {
+		p, _ := pm.programTree.FindPackageAndFileByFilename(f)
+		for _, id := range v.idents {
+			if sym, ok := pm.programTree.IdentMap[id]; ok && pm.movedSyms[sym] && !pm.inMoved(p, f, id.Pos()) {
+				used[sym] = true
+			}
+		}
+	}
+	s := ""
+	for sym, _ := range pm.movedSyms {
+		name := sym.Name()
+		if used[sym] && !isExportedName(name) {
+			name = strings.ToUpper(name[:1]) + name[1:]
+		}
+		pm.newNames[sym] = name
+		if other, ok := declaredInTable(pm.targetPack.Symbols, name, nil); ok {
+			s += "\n\t" + symbolDescription(other)
+		}
+	}
+	if s != "" {
+		return &errors.GoRefactorError{ErrorType: "identifier already exists error", Message: "package " + pm.targetPack.AstPackage.Name + " already declares moved names:" + s}
+	}
+	return nil
+}
+
+// edits of references to moved symbols. Edits within moved code are returned separately (inner).
+// newImports are packages, that will import target package; usesOldPack is set,
+// if moved code refers to the old package
+func (pm *packageMove) getReferenceEdits() (edits map[string][]*fileEdit, inner map[string][]*fileEdit, newImports map[*st.Package]bool, usesOldPack bool, err *errors.GoRefactorError) {
+	edits = make(map[string][]*fileEdit)
+	inner = make(map[string][]*fileEdit)
+	newImports = make(map[*st.Package]bool)
+	oldName, _ := importName(pm.targetPack, pm.targetFile, pm.pack)
+
+	for f, v := range pm.refs {
+		p, file := pm.programTree.FindPackageAndFileByFilename(f)
+		targetName, targetImported := importName(p, f, pm.targetPack)
+		needTarget := false
+		rewrittenX := make(map[*ast.Ident]bool) //package idents of rewritten selectors
+		for _, id := range v.idents {
+			sym, ok := pm.programTree.IdentMap[id]
+			if !ok || sym == nil {
+				continue
+			}
+			sel, isQualified := v.qualified[id]
+			_, isSel := v.selectors[id]
+			if pm.inMoved(p, f, id.Pos()) {
+				switch {
+				case pm.movedSyms[sym] && pm.newNames[sym] != sym.Name():
+					inner[f] = append(inner[f], &fileEdit{pm.offset(id.Pos()), pm.offset(id.End()), pm.newNames[sym]})
+				case isQualified && pm.programTree.IdentMap[sel.X.(*ast.Ident)].(*st.PackageSymbol).Package == pm.targetPack:
+					inner[f] = append(inner[f], &fileEdit{pm.offset(sel.Pos()), pm.offset(sel.End()), id.Name})
+				case !isSel && !pm.movedSyms[sym] && sym.PackageFrom() == pm.pack && sym.Scope() == pm.pack.Symbols && !isPackageSymbol(sym):
+					usesOldPack = true
+					inner[f] = append(inner[f], &fileEdit{pm.offset(id.Pos()), pm.offset(id.End()), qualify(oldName, id.Name)})
+				}
+				continue
+			}
+			if !pm.movedSyms[sym] {
+				continue
+			}
+			if isSel && !isQualified {
+				continue //field of an embedded type, named after moved type
+			}
+			newName := pm.newNames[sym]
+			var node ast.Node = id
+			if isQualified {
+				node = sel
+				rewrittenX[sel.X.(*ast.Ident)] = true
+			}
+			start, end := p.FileSet.Position(node.Pos()).Offset, p.FileSet.Position(node.End()).Offset
+			switch {
+			case p == pm.targetPack:
+				if isQualified || newName != id.Name {
+					edits[f] = append(edits[f], &fileEdit{start, end, newName})
+				}
+			default:
+				needTarget = true
+				edits[f] = append(edits[f], &fileEdit{start, end, qualify(targetName, newName)})
+			}
+		}
+		if needTarget {
+			newImports[p] = true
+			if !targetImported {
+				offs := p.FileSet.Position(file.Name.End()).Offset
+				edits[f] = append(edits[f], &fileEdit{offs, offs, "\n\n" + importSpecText(targetName, pm.targetPack, targetName == pm.targetPack.AstPackage.Name)})
+			}
+		}
+		if len(rewrittenX) > 0 {
+			es, err := pm.getUnusedOldImportEdits(p, f, file, rewrittenX)
+			if err != nil {
+				return nil, nil, nil, false, err
+			}
+			edits[f] = append(edits[f], es...)
+		}
+	}
+	return
+}
+
+// removes import of the old package, if all it's uses were rewritten
+func (pm *packageMove) getUnusedOldImportEdits(p *st.Package, f string, file *ast.File, rewrittenX map[*ast.Ident]bool) ([]*fileEdit, *errors.GoRefactorError) {
+	for _, ps := range getFileImports(p, f) {
+		if ps.Package != pm.pack {
+			continue
+		}
+		spec := findImportDecl(p, file, ps)
+		if spec == nil {
+			return nil, nil
+		}
+		for id, _ := range ps.Identifiers() {
+			if _, ok := rewrittenX[id]; !ok && id != spec.Name {
+				return nil, nil
+			}
+		}
+		content, err := pm.contents.read(f)
+		if err != nil {
+			return nil, err
+		}
+		if start, end, ok := getImportSpecRange(p.FileSet, file, content, spec); ok {
+			return []*fileEdit{&fileEdit{start, end, ""}}, nil
+		}
+	}
+	return nil, nil
+}
+
+// refuses, if new imports create a cycle in the import graph
+func (pm *packageMove) checkImportCycles(newImports map[*st.Package]bool, usesOldPack bool) *errors.GoRefactorError {
+	graph := make(map[*st.Package]map[*st.Package]bool)
+	addEdge := func(from *st.Package, to *st.Package) {
+		if from == to || to == nil {
+			return
+		}
+		if _, ok := graph[from]; !ok {
+			graph[from] = make(map[*st.Package]bool)
+		}
+		graph[from][to] = true
+	}
+	for _, p := range pm.programTree.Packages {
+		if p.IsGoPackage {
+			continue
+		}
+		for _, imps := range p.Imports {
+			if imps == nil {
+				continue
+			}
+			for _, el := range *imps {
+				addEdge(p, el.(*st.PackageSymbol).Package)
+			}
+		}
+	}
+	for p, _ := range newImports {
+		addEdge(p, pm.targetPack)
+	}
+	for f, decls := range pm.moved {
+		for ps, _ := range getUsedImports(pm.programTree, pm.pack, f, decls) {
+			addEdge(pm.targetPack, ps.Package)
+		}
+	}
+	if usesOldPack {
+		addEdge(pm.targetPack, pm.pack)
+	}
+
+	//path from target package back to itself
+	visited := make(map[*st.Package]bool)
+	var find func(p *st.Package, trace string) string
+	find = func(p *st.Package, trace string) string {
+		for to, _ := range graph[p] {
+			if to == pm.targetPack {
+				return trace + " -> " + to.GoPath
+			}
+			if _, ok := visited[to]; ok {
+				continue
+			}
+			visited[to] = true
+			if res := find(to, trace+" -> "+to.GoPath); res != "" {
+				return res
+			}
+		}
+		return ""
+	}
+	if cycle := find(pm.targetPack, pm.targetPack.GoPath); cycle != "" {
+		return &errors.GoRefactorError{ErrorType: "move error", Message: "move would create an import cycle: " + cycle}
+	}
+	return nil
+}
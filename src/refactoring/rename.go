@@ -9,6 +9,7 @@ import (
 	"go/ast"
 	"go/token"
 	"unicode"
+	"fmt"
 )
 
 type findImportVisitor struct {
@@ -59,7 +60,14 @@ func CheckRenameParameters(filename string, line int, column int, newName string
 	}
 	return true, nil
 }
-func Rename(filename string, line int, column int, newName string) (ok bool, err *errors.GoRefactorError) {
+// Renames symbol at given position.
+// If changeAccess is set, symbol's export status can be changed (first letter's case).
+// If renameComments is set, whole-word occurrences of the name in doc comments and comments
+// within symbol's scope are renamed too. If preview is set, nothing is changed,
+// positions of identifiers and comment occurrences are printed instead.
+// If renameTags is set and symbol is a struct field, it's tags and string literals, naming it
+// in FieldByName and MethodByName calls of reflect package in the same package, are changed too (textual edits).
+func Rename(filename string, line int, column int, newName string, changeAccess bool, renameComments bool, renameTags bool, preview bool) (ok bool, err *errors.GoRefactorError) {
 
 	if ok, err = CheckRenameParameters(filename, line, column, newName); !ok {
 		return
@@ -79,19 +87,51 @@ func Rename(filename string, line int, column int, newName string) (ok bool, err
 		if sym.PackageFrom().IsGoPackage {
 			return false, errors.UnrenamableIdentifierError(sym.Name(), " It's a symbol,imported from go library")
 		}
-		if unicode.IsUpper(int(sym.Name()[0])) && !unicode.IsUpper(int(newName[0])) ||
-			unicode.IsLower(int(sym.Name()[0])) && !unicode.IsLower(int(newName[0])) {
-			return false, &errors.GoRefactorError{ErrorType: "Can't rename identifier", Message: "can't change access modifier. Changing first letter's case can cause errors."}
+		if !changeAccess && (unicode.IsUpper(int(sym.Name()[0])) && !unicode.IsUpper(int(newName[0])) ||
+			unicode.IsLower(int(sym.Name()[0])) && !unicode.IsLower(int(newName[0]))) {
+			return false, &errors.GoRefactorError{ErrorType: "Can't rename identifier", Message: "can't change access modifier. Changing first letter's case can cause errors. Use -e flag to allow it."}
 		}
-		if _, ok := sym.Scope().LookUp(newName, filename); ok {
-			return false, errors.IdentifierAlreadyExistsError(newName)
-		}
-
+		syms := []st.Symbol{sym}
 		if meth, ok := sym.(*st.FunctionSymbol); ok {
-			if meth.IsInterfaceMethod {
-				return false, errors.UnrenamableIdentifierError(sym.Name(), " It's an interface method")
+			if getMethodOwner(programTree, meth) != nil {
+				methods, bindings := getConnectedMethods(programTree, meth)
+				if err := checkConnectedMethods(methods, bindings); err != nil {
+					return false, err
+				}
+				syms = make([]st.Symbol, 0, len(methods))
+				for m, _ := range methods {
+					syms = append(syms, m)
+				}
+			} else if meth.IsInterfaceMethod {
+				// implementations of an unnamed interface can't be found
+				return false, errors.UnrenamableIdentifierError(sym.Name(), " It's a method of an unnamed interface")
 			}
 		}
+		if err := checkRenameConflicts(programTree, syms, newName); err != nil {
+			return false, err
+		}
+		if changesExportStatus(sym.Name(), newName) {
+			if err := checkExportChange(programTree, syms, newName); err != nil {
+				return false, err
+			}
+		}
+		var comments map[string][]*commentOccurrence
+		if renameComments || preview {
+			comments = getCommentOccurrences(programTree, syms, sym.Name())
+		}
+		var textual map[string][]*textualEdit
+		if renameTags {
+			textual = getTextualEdits(programTree, syms, sym.Name(), newName)
+		}
+		if preview {
+			printRenamePreview(syms, comments)
+			if renameTags {
+				fmt.Printf("textual edits (tags and strings):\n")
+				printTextualEdits(textual)
+			}
+			return true, nil
+		}
+
 		if ps, ok := sym.(*st.PackageSymbol); ok {
 			pack, file := programTree.FindPackageAndFileByFilename(filename)
 			impDecl := findImportDecl(pack, file, ps)
@@ -102,7 +142,33 @@ func Rename(filename string, line int, column int, newName string) (ok bool, err
 				impDecl.Name = ast.NewIdent(newName)
 			}
 		}
-		fnames, fsets, files, err := renameSymbol(sym, newName, programTree)
+		oldName := sym.Name()
+		fnames, fsets, files, err := renameSymbols(syms, newName, programTree)
+		//index of the file among changed ones
+		fileIndex := func(f string) int {
+			i := 0
+			for ; i < len(fnames) && fnames[i] != f; i++ {
+			}
+			if i == len(fnames) {
+				pack, file := programTree.FindPackageAndFileByFilename(f)
+				fnames, fsets, files = append(fnames, f), append(fsets, pack.FileSet), append(files, file)
+			}
+			return i
+		}
+		if err == nil && renameComments {
+			for f, occs := range comments {
+				i := fileIndex(f)
+				renameInComments(fsets[i], files[i], occs, oldName, newName)
+			}
+		}
+		if err == nil && renameTags && len(textual) > 0 {
+			fmt.Printf("textual edits:\n")
+			printTextualEdits(textual)
+			for f, edits := range textual {
+				i := fileIndex(f)
+				applyTextualEdits(fsets[i], files[i], edits)
+			}
+		}
 		if err == nil {
 			for i, f := range fnames {
 				programTree.SaveFileExplicit(f, fsets[i], files[i])
@@ -116,9 +182,19 @@ func Rename(filename string, line int, column int, newName string) (ok bool, err
 }
 
 func renameSymbol(sym st.Symbol, newName string, programTree *program.Program) (fnames []string, fsets []*token.FileSet, files []*ast.File, err *errors.GoRefactorError) {
-	filesMap := make(map[string]bool)
-	for _, pos := range sym.Positions() {
-		filesMap[pos.Filename] = true
+	return renameSymbols([]st.Symbol{sym}, newName, programTree)
+}
+
+// renames a set of symbols, that share the same name, at once (e.g. interface method and it's implementations)
+func renameSymbols(syms []st.Symbol, newName string, programTree *program.Program) (fnames []string, fsets []*token.FileSet, files []*ast.File, err *errors.GoRefactorError) {
+	filesMap := make(map[string]st.PositionSet)
+	for _, sym := range syms {
+		for _, pos := range sym.Positions() {
+			if _, ok := filesMap[pos.Filename]; !ok {
+				filesMap[pos.Filename] = st.NewPositionSet()
+			}
+			filesMap[pos.Filename].AddPosition(pos)
+		}
 	}
 	l, i := len(filesMap), 0
 	fnames, fsets, files = make([]string, l), make([]*token.FileSet, l), make([]*ast.File, l)
@@ -130,17 +206,17 @@ func renameSymbol(sym st.Symbol, newName string, programTree *program.Program) (
 	for i, f := range fnames {
 		pack, file := programTree.FindPackageAndFileByFilename(f)
 		positions := []token.Position{}
-		for _, pos := range sym.Positions() {
-			if pos.Filename == f {
-				positions = append(positions, pos)
-			}
+		for _, pos := range filesMap[f] {
+			positions = append(positions, pos)
 		}
 		if _, fsets[i], files[i], err = printerUtil.RenameIdents(pack.FileSet, programTree.IdentMap, f, file, positions, newName); err != nil {
 			return nil, nil, nil, err
 		}
 	}
-	for ident, _ := range sym.Identifiers() {
-		ident.Name = newName
+	for _, sym := range syms {
+		for ident, _ := range sym.Identifiers() {
+			ident.Name = newName
+		}
 	}
 	return fnames, fsets, files, nil
 }
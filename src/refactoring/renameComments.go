@@ -0,0 +1,228 @@
+package refactoring
+
+import (
+	"refactoring/st"
+	"refactoring/program"
+	"go/ast"
+	"go/token"
+	"fmt"
+	"strings"
+)
+
+// occurrence of a renamed name in a comment
+type commentOccurrence struct {
+	Offset   int //offset of comment in file
+	Position token.Position
+	Text     string //line of the comment, that contains occurrence
+}
+
+// part of file, where comments mention the symbol
+type commentRegion struct {
+	Pos, End token.Pos
+}
+
+func isIdentChar(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c >= 0x80
+}
+
+// offsets of whole-word occurrences of name in text
+func findWholeWord(text string, name string) []int {
+	res := []int{}
+	for i := 0; i+len(name) <= len(text); {
+		j := strings.Index(text[i:], name)
+		if j == -1 {
+			break
+		}
+		j += i
+		if (j == 0 || !isIdentChar(text[j-1])) && (j+len(name) == len(text) || !isIdentChar(text[j+len(name)])) {
+			res = append(res, j)
+		}
+		i = j + len(name)
+	}
+	return res
+}
+
+func replaceWholeWord(text string, name string, newName string) string {
+	occs := findWholeWord(text, name)
+	for i := len(occs) - 1; i >= 0; i-- {
+		text = text[:occs[i]] + newName + text[occs[i]+len(name):]
+	}
+	return text
+}
+
+// finds the innermost node, that opens a scope and contains ident
+type enclosingScopeVisitor struct {
+	scope     ast.Node
+	ident     *ast.Ident
+	funcsOnly bool
+	result    *ast.Node
+}
+
+func (v *enclosingScopeVisitor) Visit(node ast.Node) ast.Visitor {
+	if node == nil || *v.result != nil {
+		return nil
+	}
+	if node.Pos() > v.ident.Pos() || node.End() <= v.ident.Pos() {
+		return nil
+	}
+	if node == v.ident {
+		*v.result = v.scope
+		return nil
+	}
+	switch node.(type) {
+	case *ast.FuncDecl, *ast.FuncLit:
+		return &enclosingScopeVisitor{node, v.ident, v.funcsOnly, v.result}
+	case *ast.BlockStmt, *ast.IfStmt, *ast.ForStmt, *ast.RangeStmt, *ast.SwitchStmt, *ast.TypeSwitchStmt, *ast.CaseClause, *ast.CommClause:
+		if !v.funcsOnly {
+			return &enclosingScopeVisitor{node, v.ident, v.funcsOnly, v.result}
+		}
+	}
+	return v
+}
+
+// first ident of the local symbol in file, it's a declaration
+func getFirstIdent(fset *token.FileSet, sym st.Symbol) (*ast.Ident, string) {
+	var first *ast.Ident
+	for id, _ := range sym.Identifiers() {
+		if first == nil || id.Pos() < first.Pos() {
+			first = id
+		}
+	}
+	if first == nil {
+		return nil, ""
+	}
+	return first, fset.Position(first.Pos()).Filename
+}
+
+// regions of files, where comments mentioning the symbol are searched;
+// nil region means the whole file
+func getCommentRegions(programTree *program.Program, sym st.Symbol, members map[*ast.Ident]bool) map[string]*commentRegion {
+	res := make(map[string]*commentRegion)
+	pack := sym.PackageFrom()
+
+	isMember := false
+	for id, _ := range sym.Identifiers() {
+		if _, ok := members[id]; ok {
+			isMember = true
+		}
+	}
+	_, isLabel := sym.(*st.LabelSymbol)
+	switch {
+	case isMember || sym.Scope() == pack.Symbols && !isPackageSymbol(sym):
+		for f, _ := range pack.AstPackage.Files {
+			res[f] = nil
+		}
+	case isPackageSymbol(sym):
+		for _, pos := range sym.Positions() {
+			res[pos.Filename] = nil
+		}
+	default:
+		ident, f := getFirstIdent(pack.FileSet, sym)
+		if ident == nil {
+			break
+		}
+		_, file := programTree.FindPackageAndFileByFilename(f)
+		var scope ast.Node
+		ast.Walk(&enclosingScopeVisitor{file, ident, isLabel, &scope}, file)
+		switch t := scope.(type) {
+		case nil, *ast.File:
+			res[f] = nil
+		case *ast.FuncDecl:
+			if t.Doc != nil {
+				res[f] = &commentRegion{t.Doc.Pos(), t.End()}
+			} else {
+				res[f] = &commentRegion{t.Pos(), t.End()}
+			}
+		default:
+			res[f] = &commentRegion{t.Pos(), t.End()}
+		}
+	}
+	return res
+}
+
+func isPackageSymbol(sym st.Symbol) bool {
+	_, ok := sym.(*st.PackageSymbol)
+	return ok
+}
+
+// getCommentOccurrences finds whole-word occurrences of oldName in doc comments of renamed symbols
+// and in comments within their scopes
+func getCommentOccurrences(programTree *program.Program, syms []st.Symbol, oldName string) map[string][]*commentOccurrence {
+	_, members := getMemberIdents(programTree)
+	regions := make(map[string]*commentRegion)
+	for _, sym := range syms {
+		for f, r := range getCommentRegions(programTree, sym, members) {
+			if old, ok := regions[f]; ok && (old == nil || r == nil) {
+				regions[f] = nil
+				continue
+			} else if ok {
+				if r.Pos > old.Pos {
+					r.Pos = old.Pos
+				}
+				if r.End < old.End {
+					r.End = old.End
+				}
+			}
+			regions[f] = r
+		}
+	}
+
+	res := make(map[string][]*commentOccurrence)
+	for f, r := range regions {
+		pack, file := programTree.FindPackageAndFileByFilename(f)
+		for _, cg := range file.Comments {
+			if r != nil && (cg.Pos() < r.Pos || cg.End() > r.End) {
+				continue
+			}
+			for _, c := range cg.List {
+				text := string(c.Text)
+				for _, i := range findWholeWord(text, oldName) {
+					lineStart := strings.LastIndex(text[:i], "\n") + 1
+					lineEnd := strings.Index(text[i:], "\n")
+					if lineEnd == -1 {
+						lineEnd = len(text)
+					} else {
+						lineEnd += i
+					}
+					res[f] = append(res[f], &commentOccurrence{pack.FileSet.Position(c.Pos()).Offset, pack.FileSet.Position(c.Pos() + token.Pos(i)), strings.TrimSpace(text[lineStart:lineEnd])})
+				}
+			}
+		}
+	}
+	return res
+}
+
+// replaces oldName with newName in comments, that contain occurrences
+func renameInComments(fset *token.FileSet, file *ast.File, occs []*commentOccurrence, oldName string, newName string) {
+	offsets := make(map[int]bool)
+	for _, occ := range occs {
+		offsets[occ.Offset] = true
+	}
+	for _, cg := range file.Comments {
+		for _, c := range cg.List {
+			if _, ok := offsets[fset.Position(c.Pos()).Offset]; ok {
+				c.Text = replaceWholeWord(string(c.Text), oldName, newName)
+			}
+		}
+	}
+}
+
+// prints positions of identifiers and comments, that would be changed by rename
+func printRenamePreview(syms []st.Symbol, comments map[string][]*commentOccurrence) {
+	fmt.Printf("identifiers:\n")
+	positions := st.NewPositionSet()
+	for _, sym := range syms {
+		for _, pos := range sym.Positions() {
+			positions.AddPosition(pos)
+		}
+	}
+	for _, pos := range positions {
+		fmt.Printf("\t%s\n", pos.String())
+	}
+	fmt.Printf("comments:\n")
+	for _, occs := range comments {
+		for _, occ := range occs {
+			fmt.Printf("\t%s: %s\n", occ.Position.String(), occ.Text)
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package refactoring
+
+import (
+	"refactoring/st"
+	"refactoring/errors"
+	"refactoring/program"
+	"go/ast"
+	"go/token"
+)
+
+// collects identifiers, that aren't resolved through the scope chain:
+// selectors, keys of composite literals and names of fields and methods
+type memberIdentsVisitor struct {
+	selectors map[*ast.Ident]bool
+	members   map[*ast.Ident]bool
+}
+
+func (v *memberIdentsVisitor) Visit(node ast.Node) ast.Visitor {
+	switch t := node.(type) {
+	case *ast.SelectorExpr:
+		v.selectors[t.Sel] = true
+	case *ast.KeyValueExpr:
+		if id, ok := t.Key.(*ast.Ident); ok {
+			v.selectors[id] = true
+		}
+	case *ast.StructType:
+		v.addFieldNames(t.Fields)
+	case *ast.InterfaceType:
+		v.addFieldNames(t.Methods)
+	case *ast.FuncDecl:
+		if t.Recv != nil {
+			v.members[t.Name] = true
+		}
+	}
+	return v
+}
+
+func (v *memberIdentsVisitor) addFieldNames(list *ast.FieldList) {
+	if list == nil {
+		return
+	}
+	for _, f := range list.List {
+		for _, id := range f.Names {
+			v.members[id] = true
+		}
+	}
+}
+
+func getMemberIdents(programTree *program.Program) (selectors map[*ast.Ident]bool, members map[*ast.Ident]bool) {
+	v := &memberIdentsVisitor{make(map[*ast.Ident]bool), make(map[*ast.Ident]bool)}
+	for _, pack := range programTree.Packages {
+		if pack.IsGoPackage {
+			continue
+		}
+		for _, file := range pack.AstPackage.Files {
+			ast.Walk(v, file)
+		}
+	}
+	return v.selectors, v.members
+}
+
+// true if sym is declared in the file of pos after it;
+// locals aren't visible in their block before the declaration
+func declaredAfter(sym st.Symbol, pos token.Position) bool {
+	decl := -1
+	for _, p := range sym.Positions() {
+		if p.Filename == pos.Filename && (decl < 0 || p.Offset < decl) {
+			decl = p.Offset
+		}
+	}
+	return decl > pos.Offset
+}
+
+// Searches for the first symbol with one of the given names, visible at position pos,
+// visiting tables in the same order as SymbolTable.LookUp does
+func lookUpFirstOf(table *st.SymbolTable, names map[string]bool, pos token.Position) st.Symbol {
+	local := table.Package == nil || table != table.Package.Symbols
+	for i := len(*table.Table) - 1; i >= 0; i-- {
+		s := table.Table.At(i).(st.Symbol)
+		if _, ok := s.(*st.LabelSymbol); ok {
+			continue
+		}
+		if _, ok := names[s.Name()]; ok && !(local && declaredAfter(s, pos)) {
+			return s
+		}
+	}
+	for _, x := range *table.OpenedScopes {
+		if s := lookUpFirstOf(x.(*st.SymbolTable), names, pos); s != nil {
+			return s
+		}
+	}
+	if table.Package != nil {
+		if imps, ok := table.Package.Imports[pos.Filename]; ok && imps != nil {
+			for _, e := range *imps {
+				ps := e.(*st.PackageSymbol)
+				if _, ok := names[ps.Name()]; ok {
+					return ps
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// true if name is declared in table itself, not in it's opened scopes
+func declaredInTable(table *st.SymbolTable, name string, except map[st.Symbol]bool) (st.Symbol, bool) {
+	for _, x := range *table.Table {
+		s := x.(st.Symbol)
+		if _, ok := except[s]; !ok && s.Name() == name {
+			return s, true
+		}
+	}
+	return nil, false
+}
+
+func symbolDescription(sym st.Symbol) string {
+	for _, pos := range sym.Positions() {
+		return sym.Name() + " (" + pos.String() + ")"
+	}
+	return sym.Name()
+}
+
+// checks that struct types, embedding renamed type, don't have a member named newName
+func checkEmbeddingCollisions(programTree *program.Program, sym st.ITypeSymbol, newName string) string {
+	s := ""
+	for _, t := range getNamedTypes(programTree) {
+		sT, ok := t.(*st.StructTypeSymbol)
+		if !ok {
+			continue
+		}
+		embeds := false
+		sT.Fields.ForEachNoLock(func(f st.Symbol) {
+			v, ok := f.(*st.VariableSymbol)
+			if !ok || v.Name() != sym.Name() {
+				return
+			}
+			vt := v.VariableType
+			if pt, ok := vt.(*st.PointerTypeSymbol); ok {
+				vt = pt.BaseType
+			}
+			if vt == sym {
+				embeds = true
+			}
+		})
+		if !embeds {
+			continue
+		}
+		if _, ok := lookUpMember(sT, newName); ok {
+			s += "\n\t" + qualifiedTypeName(sT) + " embeds " + sym.Name() + " and already has member " + newName
+		}
+	}
+	return s
+}
+
+// checkRenameConflicts reports every site, where renaming syms to newName would change
+// the meaning of the program: redeclarations in the same scope, references to renamed symbols
+// captured by an inner declaration of newName, references to an outer newName
+// shadowed by renamed symbols and collisions of promoted fields and methods
+func checkRenameConflicts(programTree *program.Program, syms []st.Symbol, newName string) *errors.GoRefactorError {
+	if len(syms) == 0 {
+		return nil
+	}
+	oldName := syms[0].Name()
+	renamed := make(map[st.Symbol]bool)
+	for _, sym := range syms {
+		renamed[sym] = true
+	}
+	selectors, members := getMemberIdents(programTree)
+
+	isMember := false
+	for _, sym := range syms {
+		for id, _ := range sym.Identifiers() {
+			if _, ok := members[id]; ok {
+				isMember = true
+			}
+		}
+	}
+
+	s := ""
+	for _, sym := range syms {
+		if _, ok := sym.(*st.LabelSymbol); ok {
+			if other, ok := sym.Scope().LookUpLabel(newName); ok {
+				s += "\n\tlabel " + newName + " already exists: " + symbolDescription(other)
+			}
+			continue
+		}
+		if other, ok := declaredInTable(sym.Scope(), newName, renamed); ok {
+			s += "\n\t" + newName + " is already declared in the same scope: " + symbolDescription(other)
+		}
+		if t, ok := sym.(st.ITypeSymbol); ok {
+			s += checkEmbeddingCollisions(programTree, t, newName)
+		}
+	}
+	if isMember {
+		if err := checkPromotionCollisions(programTree, syms, newName); err != nil {
+			return err
+		}
+		if s != "" {
+			return errors.UnrenamableIdentifierError(oldName, "Renaming would cause conflicts:"+s)
+		}
+		return nil
+	}
+
+	names := map[string]bool{oldName: true, newName: true}
+	for _, pack := range programTree.Packages {
+		if pack.IsGoPackage {
+			continue
+		}
+		for id, scope := range pack.IdentScopes {
+			if _, ok := selectors[id]; ok {
+				continue
+			}
+			if id.Name != oldName && id.Name != newName {
+				continue
+			}
+			sym, ok := programTree.IdentMap[id]
+			if !ok {
+				continue
+			}
+			pos := pack.FileSet.Position(id.Pos())
+			_, isRenamed := renamed[sym]
+			switch {
+			case isRenamed && id.Name == oldName:
+				// reference to the renamed symbol mustn't be captured by an inner newName
+				if only := lookUpFirstOf(scope, map[string]bool{oldName: true}, pos); only != sym {
+					continue //scope of the declaration itself, renamed symbol isn't visible there
+				}
+				if first := lookUpFirstOf(scope, names, pos); first != nil && first != sym && first.Name() == newName {
+					s += "\n\t" + pos.String() + ": reference would be captured by " + symbolDescription(first)
+				}
+			case !isRenamed && id.Name == newName:
+				// existing reference to newName mustn't be shadowed by renamed symbol
+				if only := lookUpFirstOf(scope, map[string]bool{newName: true}, pos); only != sym {
+					continue
+				}
+				if first := lookUpFirstOf(scope, names, pos); first != nil && renamed[first] {
+					s += "\n\t" + pos.String() + ": reference to " + symbolDescription(sym) + " would be shadowed by renamed " + oldName
+				}
+			}
+		}
+	}
+	if s != "" {
+		return errors.UnrenamableIdentifierError(oldName, "Renaming would cause conflicts:"+s)
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package refactoring
+
+import (
+	"refactoring/st"
+	"refactoring/errors"
+	"refactoring/program"
+	"unicode"
+)
+
+func isExportedName(name string) bool {
+	return unicode.IsUpper(int(name[0]))
+}
+
+func changesExportStatus(oldName string, newName string) bool {
+	return isExportedName(oldName) != isExportedName(newName)
+}
+
+// table of fields for struct types and pointers to them
+func getFieldsTable(t st.ITypeSymbol) *st.SymbolTable {
+	switch tt := t.(type) {
+	case *st.StructTypeSymbol:
+		return tt.Fields
+	case *st.PointerTypeSymbol:
+		return tt.Fields
+	}
+	return nil
+}
+
+// true if sym is a field or a method of type t, declared in t or promoted from an embedded type
+func hasMember(t st.ITypeSymbol, sym st.Symbol) bool {
+	if m, ok := lookUpMethod(t, sym.Name()); ok && st.Symbol(m) == sym {
+		return true
+	}
+	if fields := getFieldsTable(t); fields != nil {
+		if f, ok := fields.LookUp(sym.Name(), ""); ok && f == sym {
+			return true
+		}
+	}
+	return false
+}
+
+func lookUpMember(t st.ITypeSymbol, name string) (st.Symbol, bool) {
+	if m, ok := lookUpMethod(t, name); ok {
+		return m, true
+	}
+	if fields := getFieldsTable(t); fields != nil {
+		if f, ok := fields.LookUp(name, ""); ok {
+			return f, true
+		}
+	}
+	return nil, false
+}
+
+// checkPromotionCollisions reports types, where renamed fields or methods (own or promoted)
+// would collide with other members, named newName
+func checkPromotionCollisions(programTree *program.Program, syms []st.Symbol, newName string) *errors.GoRefactorError {
+	s := ""
+	for _, t := range getNamedTypes(programTree) {
+		if _, ok := t.(*st.InterfaceTypeSymbol); ok {
+			continue
+		}
+		for _, sym := range syms {
+			if !hasMember(t, sym) {
+				continue
+			}
+			if other, ok := lookUpMember(t, newName); ok && other != sym {
+				s += "\n\t" + qualifiedTypeName(t) + "." + sym.Name() + " collides with " + qualifiedTypeName(t) + "." + newName
+			}
+		}
+	}
+	if s != "" {
+		return &errors.GoRefactorError{ErrorType: "identifier already exists error", Message: "renamed member would collide with an existing one:" + s}
+	}
+	return nil
+}
+
+// checks that unexported symbols aren't used outside of their package
+func checkUnexporting(programTree *program.Program, syms []st.Symbol) *errors.GoRefactorError {
+	s := ""
+	packs := make(map[*st.Package]bool)
+	for _, sym := range syms {
+		packs[sym.PackageFrom()] = true
+		for _, pos := range sym.Positions() {
+			if pack, _ := programTree.FindPackageAndFileByFilename(pos.Filename); pack != sym.PackageFrom() {
+				s += "\n\t" + pos.String()
+			}
+		}
+	}
+	if s != "" {
+		return errors.UnrenamableIdentifierError(syms[0].Name(), "It's used outside of it's package:"+s)
+	}
+	if len(packs) > 1 {
+		return errors.UnrenamableIdentifierError(syms[0].Name(), "It implements an interface from another package, unexported method can't satisfy it")
+	}
+	return nil
+}
+
+// checks that exported symbols don't collide with existing names
+func checkExporting(programTree *program.Program, syms []st.Symbol, newName string) *errors.GoRefactorError {
+	if err := checkPromotionCollisions(programTree, syms, newName); err != nil {
+		return err
+	}
+	for _, sym := range syms {
+		if sym.Scope() != sym.PackageFrom().Symbols {
+			continue
+		}
+		// packages, that import symbol's package with "." name
+		for _, pack := range programTree.Packages {
+			for filename, imps := range pack.Imports {
+				if imps == nil {
+					continue
+				}
+				for _, el := range *imps {
+					ps := el.(*st.PackageSymbol)
+					if ps.Package != sym.PackageFrom() || ps.Name() != "." {
+						continue
+					}
+					if _, ok := pack.Symbols.LookUp(newName, filename); ok {
+						return &errors.GoRefactorError{ErrorType: "identifier already exists error", Message: "identifier " + newName + " already exists in package " + pack.AstPackage.Name + ", that imports " + sym.PackageFrom().AstPackage.Name + " with '.'"}
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func checkExportChange(programTree *program.Program, syms []st.Symbol, newName string) *errors.GoRefactorError {
+	if isExportedName(newName) {
+		return checkExporting(programTree, syms, newName)
+	}
+	return checkUnexporting(programTree, syms)
+}
@@ -0,0 +1,208 @@
+package refactoring
+
+import (
+	"refactoring/st"
+	"refactoring/utils"
+	"refactoring/errors"
+	"refactoring/program"
+	"refactoring/printerUtil"
+	"go/ast"
+	"go/token"
+	"os"
+	"path"
+	"strings"
+)
+
+// any go file of the package; it's used to locate the project
+func getPackageFile(packageDir string) (string, bool) {
+	fd, err := os.Open(packageDir)
+	if err != nil {
+		return "", false
+	}
+	defer fd.Close()
+	list, err := fd.Readdir(-1)
+	if err != nil {
+		return "", false
+	}
+	for i := 0; i < len(list); i++ {
+		if !list[i].IsDirectory() && utils.IsGoFile(list[i].Name) {
+			return path.Join(packageDir, list[i].Name), true
+		}
+	}
+	return "", false
+}
+
+func CheckRenamePackageParameters(packageDir string, newName string, newGoPath string) (bool, *errors.GoRefactorError) {
+	switch {
+	case packageDir == "":
+		return false, errors.ArgumentError("packageDir", "Must be a directory of a package")
+	case !IsGoIdent(newName) || newName == "main":
+		return false, errors.ArgumentError("newName", "It's not a valid package name")
+	case newGoPath != "" && (strings.HasPrefix(newGoPath, "/") || strings.Index(newGoPath, " ") != -1 || strings.Index(newGoPath, "\"") != -1):
+		return false, errors.ArgumentError("newGoPath", "It's not a valid import path")
+	}
+	if _, ok := getPackageFile(packageDir); !ok {
+		return false, errors.ArgumentError("packageDir", "Directory doesn't contain go files")
+	}
+	return true, nil
+}
+
+// Renames package, located in packageDir, to newName: changes package clause in every file of the package
+// and qualified references in dependent packages. If newGoPath is set, import specs are changed to it
+// and package directory is moved to the last element of newGoPath. goref.cfg is updated.
+func RenamePackage(packageDir string, newName string, newGoPath string) (bool, *errors.GoRefactorError) {
+	if ok, err := CheckRenamePackageParameters(packageDir, newName, newGoPath); !ok {
+		return false, err
+	}
+	packageDir = path.Clean(packageDir)
+	filename, _ := getPackageFile(packageDir)
+	projectDir, _, _, ok := utils.GetProjectInfo(filename)
+	if !ok {
+		return false, &errors.GoRefactorError{ErrorType: "rename package error", Message: "couldn't find goref.cfg of the project, containing " + packageDir}
+	}
+	programTree := parseProgram(filename)
+
+	pack, ok := programTree.Packages[packageDir]
+	if !ok {
+		return false, errors.ArgumentError("packageDir", "Program doesn't contain package in "+packageDir)
+	}
+	if pack.IsGoPackage {
+		return false, errors.UnrenamableIdentifierError(pack.AstPackage.Name, " It's a go library package")
+	}
+	if pack.AstPackage.Name == "main" {
+		return false, errors.UnrenamableIdentifierError(pack.AstPackage.Name, " It's a main package")
+	}
+	newDir := packageDir
+	if newGoPath == "" {
+		newGoPath = pack.GoPath
+	} else {
+		if other, ok := programTree.FindPackageByGoPath(newGoPath); ok && other != pack {
+			return false, errors.IdentifierAlreadyExistsError(newGoPath)
+		}
+		newDir = path.Join(path.Dir(packageDir), path.Base(newGoPath))
+		if newDir != packageDir {
+			if _, err := os.Stat(newDir); err == nil {
+				return false, errors.ArgumentError("newGoPath", "Directory "+newDir+" already exists")
+			}
+		}
+	}
+
+	var cfg []byte
+	if newDir != packageDir || newGoPath != pack.GoPath {
+		if cfg, ok = utils.ChangePackageInfo(projectDir, packageDir, newDir, newGoPath); !ok {
+			return false, &errors.GoRefactorError{ErrorType: "rename package error", Message: "couldn't find entity of package " + packageDir + " in goref.cfg"}
+		}
+	}
+
+	fnames, fsets, files, err := renamePackage(programTree, pack, newName, newGoPath)
+	if err != nil {
+		return false, err
+	}
+	//directory is moved first, so nothing is saved, if it fails
+	if newDir != packageDir {
+		if err := os.Rename(packageDir, newDir); err != nil {
+			return false, &errors.GoRefactorError{ErrorType: "rename package error", Message: "couldn't move directory " + packageDir + ": " + err.String()}
+		}
+	}
+	if cfg != nil && !utils.SaveProjectConfig(projectDir, cfg) {
+		if newDir != packageDir {
+			os.Rename(newDir, packageDir)
+		}
+		return false, &errors.GoRefactorError{ErrorType: "rename package error", Message: "couldn't update goref.cfg, nothing is changed"}
+	}
+	for i, f := range fnames {
+		if path.Dir(f) == packageDir {
+			f = path.Join(newDir, path.Base(f))
+		}
+		programTree.SaveFileExplicit(f, fsets[i], files[i])
+	}
+	return true, nil
+}
+
+// true if local name of imported package can be changed to newName in the file without conflicts
+func canChangeLocalName(programTree *program.Program, imps []*st.PackageSymbol, ps *st.PackageSymbol, newName string) bool {
+	for _, other := range imps {
+		if other != ps && other.Name() == newName {
+			return false
+		}
+	}
+	return checkRenameConflicts(programTree, []st.Symbol{ps}, newName) == nil
+}
+
+func renamePackage(programTree *program.Program, pack *st.Package, newName string, newGoPath string) (fnames []string, fsets []*token.FileSet, files []*ast.File, err *errors.GoRefactorError) {
+	oldName := pack.AstPackage.Name
+	oldGoPath := pack.GoPath
+
+	positions := make(map[string][]token.Position)    //idents to rename
+	importers := make(map[string][]*st.PackageSymbol) //imports of renamed package in every file
+	aliased := make(map[*st.PackageSymbol]bool)       //imports, that get an alias with old name
+
+	for f, file := range pack.AstPackage.Files {
+		positions[f] = []token.Position{pack.FileSet.Position(file.Name.Pos())}
+	}
+	for _, p := range programTree.Packages {
+		if p.IsGoPackage || p == pack {
+			continue
+		}
+		for f, imps := range p.Imports {
+			if imps == nil {
+				continue
+			}
+			syms := []*st.PackageSymbol{}
+			for _, el := range *imps {
+				syms = append(syms, el.(*st.PackageSymbol))
+			}
+			for _, ps := range syms {
+				if ps.Package != pack {
+					continue
+				}
+				importers[f] = append(importers[f], ps)
+				_, file := programTree.FindPackageAndFileByFilename(f)
+				if spec := findImportDecl(p, file, ps); spec == nil || spec.Name != nil {
+					continue //explicit local name stays the same
+				}
+				if !canChangeLocalName(programTree, syms, ps, newName) {
+					aliased[ps] = true
+					continue
+				}
+				for _, pos := range ps.Positions() {
+					positions[f] = append(positions[f], pos)
+				}
+			}
+		}
+	}
+
+	changed := make(map[string]bool)
+	for f, _ := range positions {
+		changed[f] = true
+	}
+	for f, _ := range importers {
+		changed[f] = true
+	}
+	for f, _ := range changed {
+		p, file := programTree.FindPackageAndFileByFilename(f)
+		fset := p.FileSet
+		if len(positions[f]) > 0 {
+			if _, fset, file, err = printerUtil.RenameIdents(fset, programTree.IdentMap, f, file, positions[f], newName); err != nil {
+				return nil, nil, nil, err
+			}
+		}
+		for _, ps := range importers[f] {
+			spec := findImportDecl(p, file, ps)
+			if spec == nil {
+				return nil, nil, nil, errors.PrinterError("couldn't find import of " + oldGoPath + " in " + f)
+			}
+			if aliased[ps] {
+				spec.Name = ast.NewIdent(oldName)
+				spec.Name.NamePos = spec.Path.Pos()
+			}
+			if newGoPath != oldGoPath {
+				spec.Path.Value = "\"" + newGoPath + "\""
+			}
+		}
+		fnames = append(fnames, f)
+		fsets = append(fsets, fset)
+		files = append(files, file)
+	}
+	return fnames, fsets, files, nil
+}
@@ -0,0 +1,182 @@
+package refactoring
+
+import (
+	"refactoring/st"
+	"refactoring/program"
+	"go/ast"
+	"go/token"
+	"fmt"
+	"strconv"
+)
+
+// textual (not symbolic) edit of a string literal: struct tag or a string, that names a field in a reflect call
+type textualEdit struct {
+	Offset   int //offset of literal in file
+	Position token.Position
+	Old, New string //literal values, quoted
+}
+
+// collects tags of fields named by idents and string literals equal to name,
+// passed to FieldByName and MethodByName methods of reflect package
+type fieldStringsVisitor struct {
+	identMap    st.IdentifierMap
+	fieldIdents st.IdentSet
+	name        string
+	tags        []*ast.BasicLit
+	strings     []*ast.BasicLit
+}
+
+// true if call is a call of reflect's FieldByName or MethodByName
+func isReflectByNameCall(identMap st.IdentifierMap, call *ast.CallExpr) bool {
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok || sel.Sel.Name != "FieldByName" && sel.Sel.Name != "MethodByName" {
+		return false
+	}
+	sym, ok := identMap[sel.Sel]
+	return ok && sym != nil && sym.PackageFrom() != nil && sym.PackageFrom().GoPath == "reflect"
+}
+
+func (v *fieldStringsVisitor) Visit(node ast.Node) ast.Visitor {
+	switch t := node.(type) {
+	case *ast.ImportSpec:
+		return nil
+	case *ast.Field:
+		if t.Tag == nil {
+			break
+		}
+		for _, id := range t.Names {
+			if _, ok := v.fieldIdents[id]; ok {
+				v.tags = append(v.tags, t.Tag)
+			}
+		}
+	case *ast.CallExpr:
+		if len(t.Args) != 1 || !isReflectByNameCall(v.identMap, t) {
+			break
+		}
+		if lit, ok := t.Args[0].(*ast.BasicLit); ok && lit.Kind == token.STRING {
+			if s, err := strconv.Unquote(string(lit.Value)); err == nil && s == v.name {
+				v.strings = append(v.strings, lit)
+			}
+		}
+	}
+	return v
+}
+
+// renames name parts of tag values (key:"name,options"), equal to oldName
+func renameInTag(tag string, oldName string, newName string) (string, bool) {
+	res, changed := "", false
+	i := 0
+	for i < len(tag) {
+		j := i
+		for j < len(tag) && tag[j] != ':' {
+			j++
+		}
+		if j+1 >= len(tag) || tag[j+1] != '"' {
+			return res + tag[i:], changed
+		}
+		res += tag[i : j+2]
+		k := j + 2
+		for k < len(tag) && tag[k] != '"' {
+			if tag[k] == '\\' {
+				k++
+			}
+			k++
+		}
+		if k >= len(tag) {
+			return res + tag[j+2:], changed
+		}
+		value := tag[j+2 : k]
+		nameEnd := len(value)
+		for n := 0; n < len(value); n++ {
+			if value[n] == ',' {
+				nameEnd = n
+				break
+			}
+		}
+		if value[:nameEnd] == oldName {
+			value = newName + value[nameEnd:]
+			changed = true
+		}
+		res += value + "\""
+		i = k + 1
+	}
+	return res, changed
+}
+
+func requote(old string, s string) string {
+	if old[0] == '`' {
+		return "`" + s + "`"
+	}
+	return strconv.Quote(s)
+}
+
+// getTextualEdits finds tags of renamed struct fields and string literals, naming them in reflect calls of the field's package
+func getTextualEdits(programTree *program.Program, syms []st.Symbol, oldName string, newName string) map[string][]*textualEdit {
+	res := make(map[string][]*textualEdit)
+	_, members := getMemberIdents(programTree)
+	for _, sym := range syms {
+		if _, ok := sym.(*st.VariableSymbol); !ok {
+			continue
+		}
+		isField := false
+		for id, _ := range sym.Identifiers() {
+			if _, ok := members[id]; ok {
+				isField = true
+			}
+		}
+		if !isField {
+			continue
+		}
+		pack := sym.PackageFrom()
+		for f, file := range pack.AstPackage.Files {
+			v := &fieldStringsVisitor{programTree.IdentMap, sym.Identifiers(), oldName, nil, nil}
+			ast.Walk(v, file)
+			for _, tag := range v.tags {
+				t, err := strconv.Unquote(string(tag.Value))
+				if err != nil {
+					continue
+				}
+				if nt, changed := renameInTag(t, oldName, newName); changed {
+					pos := pack.FileSet.Position(tag.Pos())
+					res[f] = append(res[f], &textualEdit{pos.Offset, pos, string(tag.Value), requote(string(tag.Value), nt)})
+				}
+			}
+			for _, lit := range v.strings {
+				pos := pack.FileSet.Position(lit.Pos())
+				res[f] = append(res[f], &textualEdit{pos.Offset, pos, string(lit.Value), requote(string(lit.Value), newName)})
+			}
+		}
+	}
+	return res
+}
+
+type applyTextualEditsVisitor struct {
+	fset  *token.FileSet
+	edits map[int]*textualEdit
+}
+
+func (v *applyTextualEditsVisitor) Visit(node ast.Node) ast.Visitor {
+	if lit, ok := node.(*ast.BasicLit); ok {
+		if e, ok := v.edits[v.fset.Position(lit.Pos()).Offset]; ok && string(lit.Value) == e.Old {
+			lit.Value = e.New
+		}
+	}
+	return v
+}
+
+func applyTextualEdits(fset *token.FileSet, file *ast.File, edits []*textualEdit) {
+	v := &applyTextualEditsVisitor{fset, make(map[int]*textualEdit)}
+	for _, e := range edits {
+		v.edits[e.Offset] = e
+	}
+	ast.Walk(v, file)
+}
+
+// textual edits are marked with '~', so they can be told apart from symbolic ones
+func printTextualEdits(edits map[string][]*textualEdit) {
+	for _, es := range edits {
+		for _, e := range es {
+			fmt.Printf("\t~ %s: %s -> %s\n", e.Position.String(), e.Old, e.New)
+		}
+	}
+}
@@ -0,0 +1,545 @@
+package refactoring
+
+import (
+	"refactoring/st"
+	"refactoring/errors"
+	"refactoring/program"
+	"refactoring/packageParser"
+	"go/ast"
+	"go/token"
+)
+
+func switchRecieverError(message string) *errors.GoRefactorError {
+	return &errors.GoRefactorError{ErrorType: "switch reciever error", Message: message}
+}
+
+// method, which reciever is switched
+type recieverTarget struct {
+	sym      *st.FunctionSymbol
+	decl     *ast.FuncDecl
+	filename string
+}
+
+func hasPointerReciever(decl *ast.FuncDecl) bool {
+	_, ok := decl.Recv.List[0].Type.(*ast.StarExpr)
+	return ok
+}
+
+func isPointerType(t st.ITypeSymbol) bool {
+	_, ok := t.(*st.PointerTypeSymbol)
+	return ok
+}
+
+// true if expression denotes an addressable value
+func isAddressable(programTree *program.Program, pack *st.Package, filename string, e ast.Expr) bool {
+	identMap := programTree.IdentMap
+	switch t := e.(type) {
+	case *ast.Ident:
+		sym, ok := identMap[t].(*st.VariableSymbol)
+		return ok && !isPredeclaredConst(sym)
+	case *ast.ParenExpr:
+		return isAddressable(programTree, pack, filename, t.X)
+	case *ast.StarExpr:
+		return true
+	case *ast.SelectorExpr:
+		if id, ok := t.X.(*ast.Ident); ok && isPackageSymbol(identMap[id]) {
+			_, ok := identMap[t.Sel].(*st.VariableSymbol)
+			return ok
+		}
+		if isPointerType(packageParser.ParseExpr(t.X, pack, filename, identMap)) {
+			return true
+		}
+		return isAddressable(programTree, pack, filename, t.X)
+	case *ast.IndexExpr:
+		xt := packageParser.ParseExpr(t.X, pack, filename, identMap)
+		if isPointerType(xt) {
+			return true
+		}
+		if xt == nil {
+			return false
+		}
+		bt, _ := st.GetBaseType(xt)
+		if at, ok := bt.(*st.ArrayTypeSymbol); ok {
+			return at.Len == st.SLICE || isAddressable(programTree, pack, filename, t.X)
+		}
+	}
+	return false
+}
+
+// true if the value, that the reciever denotes, is changed at the end of path:
+// it's assigned, addressed or used as a reciever of a method with pointer reciever, that is not switched.
+// Changes through pointers, slices and maps, reached from the reciever, are not counted.
+func isChangedThroughReciever(programTree *program.Program, pack *st.Package, filename string, path []ast.Node, switched map[*st.FunctionSymbol]bool) bool {
+	identMap := programTree.IdentMap
+	root := path[len(path)-1]
+	cur := root
+	sharedBy := func(x ast.Expr) bool {
+		if ast.Node(x) == root {
+			return false
+		}
+		xt := packageParser.ParseExpr(x, pack, filename, identMap)
+		if xt == nil || isPointerType(xt) {
+			return xt != nil
+		}
+		switch bt, _ := st.GetBaseType(xt); b := bt.(type) {
+		case *st.ArrayTypeSymbol:
+			return b.Len == st.SLICE
+		case *st.MapTypeSymbol:
+			return true
+		}
+		return false
+	}
+	for j := len(path) - 2; j >= 0; j-- {
+		switch p := path[j].(type) {
+		case *ast.ParenExpr, *ast.StarExpr:
+		case *ast.IndexExpr:
+			if p.X != cur || sharedBy(p.X) {
+				return false
+			}
+		case *ast.SelectorExpr:
+			if p.X != cur || sharedBy(p.X) {
+				return false
+			}
+			if m, ok := identMap[p.Sel].(*st.FunctionSymbol); ok && isMethodSymbol(m) {
+				if _, ok := switched[m]; ok {
+					return false
+				}
+				_, isPointer := variableType(nthSymbol(functionTypeOf(m).Reciever, 0)).(*st.PointerTypeSymbol)
+				return isPointer
+			}
+		case *ast.SliceExpr:
+			return p.X == cur
+		case *ast.UnaryExpr:
+			return p.Op == token.AND
+		case *ast.IncDecStmt:
+			return true
+		case *ast.AssignStmt:
+			for _, l := range p.Lhs {
+				if l == cur {
+					return true
+				}
+			}
+			return false
+		case *ast.RangeStmt:
+			return p.Key == cur || p.Value == cur
+		default:
+			return false
+		}
+		cur = path[j]
+	}
+	return false
+}
+
+// finds places, where a value of one of the types is converted to one of the interfaces
+type interfaceConversionsVisitor struct {
+	programTree *program.Program
+	pack        *st.Package
+	filename    string
+	types       map[st.ITypeSymbol]bool
+	ifaces      map[*st.InterfaceTypeSymbol]bool
+	results     *st.SymbolTable //results of the enclosing function
+	found       *[]token.Position
+}
+
+func (v *interfaceConversionsVisitor) parse(e ast.Expr) st.ITypeSymbol {
+	return packageParser.ParseExpr(e, v.pack, v.filename, v.programTree.IdentMap)
+}
+
+func (v *interfaceConversionsVisitor) check(e ast.Expr, dst st.ITypeSymbol) {
+	if e == nil || dst == nil {
+		return
+	}
+	iface, ok := dst.(*st.InterfaceTypeSymbol)
+	if !ok {
+		bt, _ := st.GetBaseType(dst)
+		if iface, ok = bt.(*st.InterfaceTypeSymbol); !ok {
+			return
+		}
+	}
+	if _, ok := v.ifaces[iface]; !ok {
+		return
+	}
+	if src := v.parse(e); src != nil && v.types[src] {
+		*v.found = append(*v.found, v.pack.FileSet.Position(e.Pos()))
+	}
+}
+
+func (v *interfaceConversionsVisitor) Visit(node ast.Node) ast.Visitor {
+	identMap := v.programTree.IdentMap
+	switch t := node.(type) {
+	case *ast.FuncDecl:
+		if t.Body == nil {
+			return nil
+		}
+		var results *st.SymbolTable
+		if ft := functionTypeOf(identMap[t.Name]); ft != nil {
+			results = ft.Results
+		}
+		ast.Walk(&interfaceConversionsVisitor{v.programTree, v.pack, v.filename, v.types, v.ifaces, results, v.found}, t.Body)
+		return nil
+	case *ast.FuncLit:
+		ast.Walk(&interfaceConversionsVisitor{v.programTree, v.pack, v.filename, v.types, v.ifaces, nil, v.found}, t.Body)
+		return nil
+	case *ast.AssignStmt:
+		if t.Tok == token.ASSIGN && len(t.Lhs) == len(t.Rhs) {
+			for i, r := range t.Rhs {
+				v.check(r, v.parse(t.Lhs[i]))
+			}
+		}
+	case *ast.ValueSpec:
+		if t.Type != nil {
+			dst := v.parse(t.Type)
+			for _, val := range t.Values {
+				v.check(val, dst)
+			}
+		}
+	case *ast.ReturnStmt:
+		if v.results != nil && v.results.Count() == len(t.Results) {
+			for i, r := range t.Results {
+				v.check(r, variableType(nthSymbol(v.results, i)))
+			}
+		}
+	case *ast.SendStmt:
+		if ct, ok := v.parse(t.Chan).(*st.ChanTypeSymbol); ok {
+			v.check(t.Value, ct.ValueType)
+		}
+	case *ast.CallExpr:
+		if isTypeExpr(identMap, t.Fun) {
+			if len(t.Args) == 1 {
+				v.check(t.Args[0], v.parse(t.Fun))
+			}
+			break
+		}
+		// of builtin functions only append converts it's arguments to a type, that can be an interface
+		if id, ok := t.Fun.(*ast.Ident); ok && id.Name == "append" && functionTypeOf(identMap[id]) == nil {
+			if lt := v.parse(t.Args[0]); lt != nil && len(t.Args) > 1 && t.Ellipsis == token.NoPos {
+				bt, _ := st.GetBaseType(lt)
+				if at, ok := bt.(*st.ArrayTypeSymbol); ok {
+					for _, a := range t.Args[1:] {
+						v.check(a, at.ElemType)
+					}
+				}
+			}
+			break
+		}
+		var ft *st.FunctionTypeSymbol
+		switch f := t.Fun.(type) {
+		case *ast.Ident:
+			ft = functionTypeOf(identMap[f])
+		case *ast.SelectorExpr:
+			ft = functionTypeOf(identMap[f.Sel])
+		}
+		if ft == nil || t.Ellipsis != token.NoPos {
+			break
+		}
+		n := ft.Parameters.Count()
+		for i, arg := range t.Args {
+			j := i
+			if j >= n {
+				j = n - 1
+			}
+			if j < 0 {
+				break
+			}
+			pt := variableType(nthSymbol(ft.Parameters, j))
+			if at, ok := pt.(*st.ArrayTypeSymbol); ok && at.Len == st.ELLIPSIS {
+				pt = at.ElemType
+			}
+			v.check(arg, pt)
+		}
+	case *ast.CompositeLit:
+		lt := v.parse(t)
+		if lt == nil {
+			break
+		}
+		bt, _ := st.GetBaseType(lt)
+		for i, el := range t.Elts {
+			kv, isKv := el.(*ast.KeyValueExpr)
+			switch b := bt.(type) {
+			case *st.ArrayTypeSymbol:
+				if isKv {
+					el = kv.Value
+				}
+				v.check(el, b.ElemType)
+			case *st.MapTypeSymbol:
+				if isKv {
+					v.check(kv.Key, b.KeyType)
+					v.check(kv.Value, b.ValueType)
+				}
+			case *st.StructTypeSymbol:
+				if !isKv {
+					v.check(el, variableType(nthSymbol(b.Fields, i)))
+				} else if id, ok := kv.Key.(*ast.Ident); ok {
+					v.check(kv.Value, variableType(identMap[id]))
+				}
+			}
+		}
+	}
+	return v
+}
+
+// t and struct types, that embed it by value (directly or through other types),
+// so that methods of t are promoted to their values
+func getValueEmbedders(programTree *program.Program, t st.ITypeSymbol) map[st.ITypeSymbol]bool {
+	res := map[st.ITypeSymbol]bool{t: true}
+	named := getNamedTypes(programTree)
+	for changed := true; changed; {
+		changed = false
+		for _, nt := range named {
+			sT, ok := nt.(*st.StructTypeSymbol)
+			if !ok || res[nt] {
+				continue
+			}
+			sT.Fields.ForEachNoLock(func(f st.Symbol) {
+				if e, ok := f.(st.ITypeSymbol); ok && res[e] && !res[nt] {
+					res[nt] = true
+					changed = true
+				}
+			})
+		}
+	}
+	return res
+}
+
+// positions, where values of t or of types, embedding it by value, are converted to interfaces,
+// that need switched methods
+func getBrokenConversions(programTree *program.Program, t st.ITypeSymbol, targets []*recieverTarget) []token.Position {
+	types := getValueEmbedders(programTree, t)
+	ifaces := make(map[*st.InterfaceTypeSymbol]bool)
+	for _, target := range targets {
+		_, bindings := getConnectedMethods(programTree, target.sym)
+		for _, b := range bindings {
+			if b.ImplMeth == target.sym && types[b.Type] && !b.Pointer {
+				ifaces[b.Interface] = true
+			}
+		}
+	}
+	found := []token.Position{}
+	if len(ifaces) == 0 {
+		return found
+	}
+	for _, pack := range programTree.Packages {
+		if pack.IsGoPackage {
+			continue
+		}
+		for filename, file := range pack.AstPackage.Files {
+			ast.Walk(&interfaceConversionsVisitor{programTree, pack, filename, types, ifaces, nil, &found}, file)
+		}
+	}
+	return found
+}
+
+func CheckSwitchRecieverParameters(filename string, line int, column int) (bool, *errors.GoRefactorError) {
+	if err := checkPositionParameters(filename, line, column); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Makes reciever of the method, pointed by position, a pointer (if toPointer is set) or a value;
+// if position points to a type, recievers of all it's methods are switched.
+func SwitchReciever(filename string, line int, column int, toPointer bool) (bool, *errors.GoRefactorError) {
+	if ok, err := CheckSwitchRecieverParameters(filename, line, column); !ok {
+		return false, err
+	}
+	programTree := parseProgram(filename)
+	edits, err := switchReciever(programTree, filename, line, column, toPointer)
+	if err != nil {
+		return false, err
+	}
+	if err := applyFileEdits(programTree, edits); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func kindName(pointer bool) string {
+	if pointer {
+		return "pointer"
+	}
+	return "value"
+}
+
+// methods, which recievers have to be switched, and their type
+func getRecieverTargets(programTree *program.Program, filename string, line int, column int, toPointer bool) (st.ITypeSymbol, []*recieverTarget, *errors.GoRefactorError) {
+	sym, err := programTree.FindSymbolByPosition(filename, line, column)
+	if err != nil {
+		return nil, nil, err
+	}
+	pack := sym.PackageFrom()
+	if pack == nil || pack.IsGoPackage {
+		return nil, nil, switchRecieverError(sym.Name() + " doesn't belong to the program")
+	}
+	identMap := programTree.IdentMap
+	switch s := sym.(type) {
+	case *st.FunctionSymbol:
+		decl, declFile, err := getDeclarationInFile(programTree, pack, s)
+		if err != nil {
+			return nil, nil, err
+		}
+		if decl.Recv == nil || len(decl.Recv.List) == 0 {
+			return nil, nil, switchRecieverError(s.Name() + " is not a method")
+		}
+		if hasPointerReciever(decl) == toPointer {
+			return nil, nil, switchRecieverError("method " + s.Name() + " already has a " + kindName(toPointer) + " reciever")
+		}
+		recvType := decl.Recv.List[0].Type
+		if star, ok := recvType.(*ast.StarExpr); ok {
+			recvType = star.X
+		}
+		t, _ := identMap[recvType.(*ast.Ident)].(st.ITypeSymbol)
+		return t, []*recieverTarget{&recieverTarget{s, decl, declFile}}, nil
+	case st.ITypeSymbol:
+		if isPackageSymbol(s) {
+			break
+		}
+		targets := []*recieverTarget{}
+		for f, decls := range getTypeMethodDecls(programTree, pack, s) {
+			for _, d := range decls {
+				fdecl := d.(*ast.FuncDecl)
+				if m, ok := identMap[fdecl.Name].(*st.FunctionSymbol); ok && hasPointerReciever(fdecl) != toPointer {
+					targets = append(targets, &recieverTarget{m, fdecl, f})
+				}
+			}
+		}
+		if len(targets) == 0 {
+			return nil, nil, switchRecieverError("type " + s.Name() + " has no methods with " + kindName(!toPointer) + " reciever")
+		}
+		return s, targets, nil
+	}
+	return nil, nil, switchRecieverError(sym.Name() + " is neither a method nor a type")
+}
+
+func switchReciever(programTree *program.Program, filename string, line int, column int, toPointer bool) (map[string][]*fileEdit, *errors.GoRefactorError) {
+	t, targets, err := getRecieverTargets(programTree, filename, line, column, toPointer)
+	if err != nil {
+		return nil, err
+	}
+	identMap := programTree.IdentMap
+	switched := make(map[*st.FunctionSymbol]bool)
+	for _, target := range targets {
+		switched[target.sym] = true
+	}
+
+	contents := make(fileContents)
+	edits := make(map[string][]*fileEdit)
+
+	for _, target := range targets {
+		pack, file := programTree.FindPackageAndFileByFilename(target.filename)
+		fset := pack.FileSet
+		offset := func(pos token.Pos) int {
+			return fset.Position(pos).Offset
+		}
+		recvField := target.decl.Recv.List[0]
+		if toPointer {
+			offs := offset(recvField.Type.Pos())
+			edits[target.filename] = append(edits[target.filename], &fileEdit{offs, offs, "*"})
+		} else {
+			star := recvField.Type.(*ast.StarExpr)
+			edits[target.filename] = append(edits[target.filename], &fileEdit{offset(star.Pos()), offset(star.X.Pos()), ""})
+		}
+
+		// uses of the reciever in the body
+		if len(recvField.Names) > 0 && recvField.Names[0].Name != "_" {
+			recvName := recvField.Names[0]
+			recvSym, ok := identMap[recvName]
+			if !ok {
+				return nil, switchRecieverError("couldn't find reciever of " + target.sym.Name())
+			}
+			for id, _ := range recvSym.Identifiers() {
+				if id == recvName {
+					continue
+				}
+				path := getNodePath(fset, file, id)
+				pos := fset.Position(id.Pos()).String()
+				if isChangedThroughReciever(programTree, pack, target.filename, path, switched) {
+					if toPointer {
+						return nil, switchRecieverError("reciever of " + target.sym.Name() + " is changed at " + pos + "; with pointer reciever the caller's value would change")
+					}
+					return nil, switchRecieverError("reciever of " + target.sym.Name() + " is changed at " + pos + "; with value reciever only it's copy would change")
+				}
+				parent := path[len(path)-2]
+				if sel, ok := parent.(*ast.SelectorExpr); ok && ast.Node(sel.X) == id {
+					continue
+				}
+				if toPointer {
+					text := "*" + id.Name
+					if needsParens(&ast.StarExpr{id.Pos(), id}, path) {
+						text = "(" + text + ")"
+					}
+					edits[target.filename] = append(edits[target.filename], &fileEdit{offset(id.Pos()), offset(id.End()), text})
+				} else if star, ok := parent.(*ast.StarExpr); ok {
+					edits[target.filename] = append(edits[target.filename], &fileEdit{offset(star.Pos()), offset(star.End()), id.Name})
+				} else {
+					return nil, switchRecieverError("reciever of " + target.sym.Name() + " is used as a pointer at " + pos)
+				}
+			}
+		}
+		if !toPointer {
+			// every use of a method with value reciever remains valid
+			continue
+		}
+
+		calls, values := getCallSites(programTree, target.sym, target.decl)
+		for _, v := range values {
+			pos := v.pack.FileSet.Position(v.fun.Pos()).String()
+			if v.shift == 1 {
+				return nil, switchRecieverError("method expression at " + pos + " would change it's type")
+			}
+			sel, ok := v.path[len(v.path)-1].(*ast.SelectorExpr)
+			if !ok || !isPointerType(packageParser.ParseExpr(sel.X, v.pack, v.filename, identMap)) {
+				return nil, switchRecieverError("method value at " + pos + " would bind the reciever by reference instead of a copy")
+			}
+		}
+		for _, c := range calls {
+			cfset := c.pack.FileSet
+			coffset := func(pos token.Pos) int {
+				return cfset.Position(pos).Offset
+			}
+			pos := cfset.Position(c.call.Pos()).String()
+			sel := c.call.Fun.(*ast.SelectorExpr)
+			if c.shift == 0 {
+				if !isPointerType(packageParser.ParseExpr(sel.X, c.pack, c.filename, identMap)) && !isAddressable(programTree, c.pack, c.filename, sel.X) {
+					return nil, switchRecieverError("reciever of the call at " + pos + " is not addressable")
+				}
+				continue
+			}
+			// method expression: T.M(x) -> (*T).M(&x)
+			cc, err := contents.read(c.filename)
+			if err != nil {
+				return nil, err
+			}
+			x := c.call.Args[0]
+			var text string
+			switch {
+			case isPointerType(packageParser.ParseExpr(x, c.pack, c.filename, identMap)):
+				return nil, switchRecieverError("unexpected pointer reciever in the call at " + pos)
+			case isAddressable(programTree, c.pack, c.filename, x):
+				if star, ok := x.(*ast.StarExpr); ok {
+					text = nodeText(cfset, cc, star.X)
+				} else {
+					text = prefixed("&", x, nodeText(cfset, cc, x))
+				}
+			default:
+				if _, ok := x.(*ast.CompositeLit); !ok {
+					return nil, switchRecieverError("reciever of the call at " + pos + " is not addressable")
+				}
+				text = "&" + nodeText(cfset, cc, x)
+			}
+			edits[c.filename] = append(edits[c.filename],
+				&fileEdit{coffset(sel.X.Pos()), coffset(sel.X.End()), "(*" + nodeText(cfset, cc, sel.X) + ")"},
+				&fileEdit{coffset(x.Pos()), coffset(x.End()), text})
+		}
+	}
+
+	if toPointer {
+		if found := getBrokenConversions(programTree, t, targets); len(found) > 0 {
+			s := ""
+			for _, p := range found {
+				s += "\n\t" + p.String()
+			}
+			return nil, switchRecieverError("value of type " + t.Name() + " (or of a type, embedding it) would no longer satisfy an interface at:" + s)
+		}
+	}
+	return edits, nil
+}
@@ -248,6 +248,7 @@ type Package struct { //NOT A SYMBOL
 	AstPackage  *ast.Package              //ast tree
 	Imports     map[string]*vector.Vector //map[file] *[]packageSymbol
 	IsGoPackage bool                      //true if package source is in $GOROOT/src/pkg/
+	IdentScopes map[*ast.Ident]*SymbolTable //innermost symbol table, where ident was met
 
 	Communication chan int
 }
@@ -259,6 +260,7 @@ func NewPackage(qualifiedPath string, goPath string, fileSet *token.FileSet, ast
 	p.SymbolTablePool = new(vector.Vector)
 	p.SymbolTablePool.Push(p.Symbols)
 	p.Imports = make(map[string]*vector.Vector)
+	p.IdentScopes = make(map[*ast.Ident]*SymbolTable)
 	p.Communication = make(chan int)
 	return p
 }
@@ -589,6 +589,44 @@ func GetProjectInfo(filename string) (projectDir string, sources map[string]stri
 	return getProjectInfo(filename)
 }
 
+// Returns goref.cfg of the project, where entity of package, located in oldDir, is replaced
+// with a new directory and go path. Directories of .packages field are written relative to projectDir.
+func ChangePackageInfo(projectDir string, oldDir string, newDir string, newGoPath string) ([]byte, bool) {
+	d, err := ioutil.ReadFile(path.Join(projectDir, "goref.cfg"))
+	if err != nil {
+		return nil, false
+	}
+	lines := strings.Split(string(d), "\n", -1)
+	found := false
+	for i, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		switch {
+		case path.Join(projectDir, fields[0]) == oldDir:
+			realpath := newDir
+			if strings.HasPrefix(newDir, projectDir+"/") {
+				realpath = newDir[len(projectDir)+1:]
+			}
+			lines[i] = realpath + "\t\t\t" + newGoPath
+			found = true
+		case fields[0] == oldDir:
+			lines[i] = newDir + "\t\t\t" + newGoPath
+			found = true
+		}
+	}
+	if !found {
+		return nil, false
+	}
+	return []byte(strings.Join(lines, "\n")), true
+}
+
+// Writes goref.cfg of the project
+func SaveProjectConfig(projectDir string, cfg []byte) bool {
+	return ioutil.WriteFile(path.Join(projectDir, "goref.cfg"), cfg, 0666) == nil
+}
+
 func getLineOffsets(s string) []int {
 	res := []int{}
 	for i := 0; i < len(s); i++ {
@@ -0,0 +1,46 @@
+package testPack
+
+import "strings"
+
+func sigFormat(name string, count int, unused bool) string {
+	return strings.Repeat(name, count)
+}
+
+func sigJoin(sep string, parts ...string) string {
+	return strings.Join(parts, sep)
+}
+
+func sigConcat(sep string, parts ...string) string {
+	return strings.Join(parts, sep)
+}
+
+func sigPair() (string, string) {
+	return ",", "a"
+}
+
+var sigPairFunc = sigPair
+
+func sigName() string {
+	return "x"
+}
+
+func sigCount() int {
+	return 1
+}
+
+func sigCalls() string {
+	s := sigFormat("a", 2, false)
+	s += sigFormat(sigName(), sigCount(), true)
+	s += sigJoin(",")
+	s += sigJoin(",", "a", "b")
+	s += sigConcat(sigPair())
+	return s
+}
+
+func sigTotal(n int) int {
+	sum := 0
+	for i := 0; i < n; i++ {
+		sum += i
+	}
+	return sum
+}
@@ -0,0 +1,54 @@
+package testPack
+
+type cnvCounter struct {
+	n int
+}
+
+func (c *cnvCounter) Add(d int) {
+	c.n += d
+}
+
+func (c cnvCounter) get() int {
+	return c.n
+}
+
+func (c cnvCounter) size() int {
+	return c.n
+}
+
+func cnvReset(c *cnvCounter, to int) {
+	c.n = to
+}
+
+func cnvValue(x int, c cnvCounter) int {
+	return c.n + x
+}
+
+func cnvSum(c *cnvCounter, extra ...int) int {
+	for _, e := range extra {
+		c.n += e
+	}
+	return c.n
+}
+
+func cnvTotal(c *cnvCounter, extra ...int) int {
+	return c.n + len(extra)
+}
+
+func cnvPair() (*cnvCounter, int) {
+	return &cnvCounter{}, 1
+}
+
+// function with the name of a method
+func get(c *cnvCounter) int {
+	return c.n
+}
+
+func cnvCalls() int {
+	c := cnvCounter{}
+	cnvReset(&c, 1)
+	c.Add(2)
+	(*cnvCounter).Add(&c, 3)
+	sizeOf := c.size
+	return cnvValue(1, c) + c.get() + sizeOf() + cnvSum(&c) + cnvTotal(cnvPair()) + get(&c)
+}
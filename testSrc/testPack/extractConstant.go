@@ -0,0 +1,26 @@
+package testPack
+
+func excTimeout(retries int) int {
+	return retries*30 + 5
+}
+
+func excScale(x float64) float64 {
+	return x * 4
+}
+
+func excUse() float64 {
+	return excScale(4) + excScale(0x4)
+}
+
+func excMask(n int) int {
+	return n & 0xff
+}
+
+func excLow(n uint8) uint8 {
+	return n & 255
+}
+
+// array length in the signature is outside of the function's scope
+func excFirst(a [3]int) int {
+	return a[0]
+}
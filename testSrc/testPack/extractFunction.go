@@ -0,0 +1,48 @@
+package testPack
+
+type exfList struct {
+	items []int
+}
+
+func exfPlain() func(int) int {
+	return func(x int) int {
+		return x * 2
+	}
+}
+
+func exfLess(a []int) func(int, int) bool {
+	return func(i, j int) bool {
+		return a[i] < a[j]
+	}
+}
+
+func exfCounter() func() int {
+	n := 0
+	return func() int {
+		n++
+		return n
+	}
+}
+
+func (l *exfList) exfAdder() func(int) {
+	return func(x int) {
+		l.items = append(l.items, x)
+	}
+}
+
+func exfLocalType() interface{} {
+	type pair struct {
+		a, b int
+	}
+	return func() pair {
+		return pair{1, 2}
+	}
+}
+
+func exfRecover(n int) func() {
+	return func() {
+		if recover() != nil {
+			println(n)
+		}
+	}
+}
@@ -38,3 +38,83 @@ func exm4_pointer() {
 	println(a)
 	println(&b)
 }
+
+func exm5_return(a []int) int {
+	if len(a) == 0 {
+		return -1
+	}
+	s := 0
+	for _, x := range a {
+		s += x
+	}
+	return s
+}
+
+func exm6_branches(a []int) int {
+	s := 0
+loop:
+	for i, x := range a {
+		if x < 0 {
+			break
+		}
+		if x == 0 {
+			continue
+		}
+		if x > 100 {
+			goto done
+		}
+		if i > 10 {
+			break loop
+		}
+		s += x
+	}
+done:
+	return s
+}
+
+func exm6_fallthrough(n int) {
+	switch n {
+	case 0:
+		println(n)
+		fallthrough
+	case 1:
+		println(n + 1)
+	}
+}
+
+func exm7_first(p []int) {
+	v := p[1] + 1
+	println(v)
+}
+
+func exm7_second(q []int) {
+	w := q[1] + 1
+	println(w)
+}
+
+func exm7_used(r []int) {
+	x := r[1] + 1
+	println(x)
+	println(x)
+}
+
+func exm8_incdec() {
+	n := 0
+	n++
+	println(n)
+}
+
+func exm9_range(m map[string]int) {
+	var k string
+	var v int
+	for k, v = range m {
+		println(k)
+	}
+	println(k, v)
+}
+
+func exm10_params(x, y int) int {
+	x = x + y
+	y = y * 2
+	return x + y
+}
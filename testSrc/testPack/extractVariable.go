@@ -0,0 +1,26 @@
+package testPack
+
+import "math"
+
+func exvArea(r float64) float64 {
+	return math.Pi * r * r
+}
+
+func exvScale(x float64) float64 {
+	return x * 2
+}
+
+func exvSum(a []int, i int) int {
+	total := a[i] + a[i]*2
+	if i > 0 && a[i-1] > 0 {
+		total += a[i-1]
+	}
+	for n := 0; n < len(a); n++ {
+		total += n
+	}
+	return total
+}
+
+func exvTyped() float64 {
+	return exvScale(3) + exvScale(3)
+}
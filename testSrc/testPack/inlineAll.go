@@ -0,0 +1,46 @@
+package testPack
+
+import "strings"
+
+func inaUpper(s string) string {
+	return strings.ToUpper(s)
+}
+
+func inaUse() string {
+	return inaUpper("a") + inaUpper("b")
+}
+
+func inaLog(n int) {
+	println(n * 2)
+}
+
+func inaStmt(n int) {
+	n++
+	inaLog(n)
+}
+
+func inaRec(n int) int {
+	if n == 0 {
+		return 0
+	}
+	return inaRec(n - 1)
+}
+
+func inaValue(n int) int {
+	return n
+}
+
+var inaFunc = inaValue
+
+func inaNested(n int) int {
+	return n + 1
+}
+
+func inaNestedUse() int {
+	return inaNested(inaNested(1))
+}
+
+func inaDeferred(n int) {
+	defer inaLog(n)
+	go inaLog(n + 1)
+}
@@ -0,0 +1,29 @@
+package testPack
+
+var intCounter int
+
+func intTwice(n int) int {
+	return n + n
+}
+
+func intInc(n int) int {
+	n++
+	return n
+}
+
+func intIgnore(n int) {
+	println("ignored")
+}
+
+func intNext() int {
+	intCounter++
+	return intCounter
+}
+
+func intUse(a int) int {
+	b := intTwice(a)
+	b += intTwice(intNext())
+	intInc(a)
+	intIgnore(intNext())
+	return b
+}
@@ -0,0 +1,19 @@
+package testPack
+
+func inhMax(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func inhUse(x, y int) int {
+	z := inhMax(x, y) * 2
+	if x > 0 && inhMax(x, 1) > 0 {
+		z++
+	}
+	for inhMax(z, 0) > 10 {
+		z--
+	}
+	return z
+}
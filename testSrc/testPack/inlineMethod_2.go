@@ -0,0 +1,10 @@
+package testPack
+
+import pack2 "testPack2"
+
+func inmCross() string {
+	c := pack2.NewCounter()
+	c.Reset()
+	println(pack2.Hidden())
+	return pack2.Describe(c)
+}
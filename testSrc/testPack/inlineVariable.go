@@ -0,0 +1,28 @@
+package testPack
+
+func invSum(a, b int) int {
+	s := a + b
+	return s * 2
+}
+
+func invTyped() float64 {
+	var f float64 = 3
+	return f / 2
+}
+
+func invAssigned(n int) int {
+	x := n
+	x++
+	return x
+}
+
+func invChanged(a []int) int {
+	x := a[0]
+	a[0] = 1
+	return x
+}
+
+func invCall() int {
+	x := invSum(1, 2)
+	return x + x
+}
@@ -0,0 +1,35 @@
+package testPack
+
+import "os"
+
+func inwClose(f *os.File) {
+	defer f.Close()
+	f.Write([]byte("x"))
+}
+
+func inwSafe(n int) (ok bool) {
+	defer func() {
+		if recover() != nil {
+			ok = false
+		}
+	}()
+	ok = 10/n > 0
+	return
+}
+
+func inwNamed(n int) (res int) {
+	res = n * 2
+	return
+}
+
+func inwSquare(n int) int {
+	return n * n
+}
+
+func inwUse(f *os.File, n int) bool {
+	inwClose(f)
+	inwNamed(n)
+	defer inwSquare(n + 1)
+	go inwSquare(n)
+	return inwSafe(n)
+}
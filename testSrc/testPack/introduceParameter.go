@@ -0,0 +1,27 @@
+package testPack
+
+func inpGreet(name string) string {
+	return "Hello, " + name
+}
+
+func inpWidth(s string) int {
+	return len(s) * 2
+}
+
+func inpLocal(s string) int {
+	n := len(s)
+	return n + 1
+}
+
+func inpCount(parts ...string) int {
+	return len(parts) + 1
+}
+
+func inpTotal(parts ...string) int {
+	return len(parts) + 1
+}
+
+func inpCalls() int {
+	inpGreet("a")
+	return inpWidth("abc") + inpLocal("x") + inpCount("a") + inpTotal(sigPair())
+}
@@ -0,0 +1,31 @@
+package testPack
+
+import (
+	"strings"
+	"fmt"
+)
+
+// mvfWords splits text into words
+func mvfWords(text string) []string {
+	return strings.Fields(text)
+}
+
+// mvfList is a list of words
+type mvfList []string
+
+func (l mvfList) String() string {
+	return fmt.Sprint([]string(l))
+}
+
+func (l mvfList) Len() int {
+	return len(l)
+}
+
+const (
+	mvfSep = " "
+	mvfEnd = "."
+)
+
+func mvfPrint(l mvfList) {
+	fmt.Println(mvfJoin(l))
+}
@@ -0,0 +1,9 @@
+package testPack
+
+func mvfJoin(words []string) string {
+	s := ""
+	for _, w := range words {
+		s += w + mvfSep
+	}
+	return s + mvfEnd
+}
@@ -0,0 +1,25 @@
+package testPack
+
+import "strconv"
+
+type mvpPoint struct {
+	X, Y int
+}
+
+func (p mvpPoint) String() string {
+	return strconv.Itoa(p.X) + "," + strconv.Itoa(p.Y)
+}
+
+func mvpFormat(x, y int) string {
+	return mvpPoint{x, y}.String()
+}
+
+func mvpUse() string {
+	return mvpFormat(1, 2) + mvpPrefix(3)
+}
+
+const mvpSep = ":"
+
+func mvpPrefix(n int) string {
+	return strconv.Itoa(n) + mvpSep
+}
@@ -0,0 +1,19 @@
+package testPack
+
+// renBuffer keeps written bytes; a renBuffer grows on write
+type renBuffer struct {
+	data []byte
+}
+
+// renWrite appends p to the renBuffer b
+func renWrite(b *renBuffer, p []byte) {
+	// size is the new length of data
+	size := len(b.data) + len(p)
+	if size > cap(b.data) {
+		// renBuffer is full, data is copied
+		data := make([]byte, len(b.data), size*2)
+		copy(data, b.data)
+		b.data = data
+	}
+	b.data = append(b.data, p...)
+}
@@ -0,0 +1,31 @@
+package testPack
+
+var renLimit = 10
+
+func renConflicts(n int) int {
+	total := 0
+	for i := 0; i < n; i++ {
+		step := i * 2
+		if step > renLimit {
+			break
+		}
+		total += step
+	}
+	count := total
+	return count
+}
+
+type renPair struct {
+	first, second int
+}
+
+func (p renPair) sum() int {
+	return p.first + p.second
+}
+
+// width is declared after the use of renLimit, so it doesn't capture it
+func renLater() int {
+	d := renLimit
+	width := 3
+	return d * width
+}
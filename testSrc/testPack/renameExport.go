@@ -0,0 +1,30 @@
+package testPack
+
+import "testPack2"
+
+type renPoint struct {
+	x, y int
+	X    int
+}
+
+func renMove(p *renPoint) {
+	p.x++
+	p.y++
+	p.X = p.x + p.y
+}
+
+// Inc is promoted from testPack2.Counter
+type renCounter struct {
+	*testPack2.Counter
+}
+
+func (c renCounter) inc() {
+	c.Counter.Count += testPack2.Twice(1)
+}
+
+func renNewCounter() renCounter {
+	c := renCounter{testPack2.NewCounter()}
+	c.inc()
+	c.Inc()
+	return c
+}
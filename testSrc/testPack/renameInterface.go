@@ -0,0 +1,60 @@
+package testPack
+
+import "fmt"
+
+type renShape interface {
+	Area() int
+}
+
+type renSquare struct {
+	side int
+}
+
+func (s renSquare) Area() int {
+	return s.side * s.side
+}
+
+type renRect struct {
+	w, h int
+}
+
+func (r *renRect) Area() int {
+	return r.w * r.h
+}
+
+func renTotal(shapes []renShape) int {
+	sum := 0
+	for _, s := range shapes {
+		sum += s.Area()
+	}
+	return sum + renTotalOf(renSquare{2}, &renRect{1, 2})
+}
+
+func renTotalOf(a renShape, b renShape) int {
+	return a.Area() + b.Area()
+}
+
+// String implements fmt.Stringer, which can't be changed
+type renName string
+
+func (n renName) String() string {
+	return string(n)
+}
+
+var renStringer fmt.Stringer = renName("name")
+
+// method of an unnamed interface
+func renDraw(d interface {
+	Draw()
+}) {
+	d.Draw()
+}
+
+// only *renPath implements fmt.Stringer
+type renPath string
+
+func (p *renPath) String() string {
+	return string(*p)
+}
+
+var renPathStringer fmt.Stringer = new(renPath)
@@ -0,0 +1,11 @@
+package testPack
+
+import (
+	"testPack2"
+	tp2 "testPack2"
+)
+
+// testPack2 is imported twice, import path of both specs is changed
+func renTwice() int {
+	return testPack2.Twice(1) + tp2.Twice(2)
+}
@@ -0,0 +1,15 @@
+package testPack
+
+import "reflect"
+
+type renRecord struct {
+	Name  string `json:"Name,omitempty" xml:"Name"`
+	Title string `json:"Title"`
+}
+
+func renRecordName(r renRecord) string {
+	return reflect.ValueOf(r).FieldByName("Name").String()
+}
+
+// strings, that aren't passed to reflect, are kept
+var renRecordKey = "Name"
@@ -0,0 +1,57 @@
+package testPack
+
+import "fmt"
+
+type recvBox struct {
+	v int
+}
+
+func (b recvBox) Get() int {
+	return b.v
+}
+
+func (b recvBox) Len() int {
+	return b.v
+}
+
+func (b *recvBox) Set(v int) {
+	b.v = v
+}
+
+func (b *recvBox) Peek() int {
+	return b.v
+}
+
+func (b recvBox) String() string {
+	return fmt.Sprint(b.v)
+}
+
+func recvNew() recvBox {
+	return recvBox{1}
+}
+
+func recvUse() int {
+	b := recvBox{}
+	b.Set(2)
+	var s fmt.Stringer = b
+	fmt.Println(s)
+	return b.Len() + recvBox.Len(b) + recvNew().Get() + b.Peek()
+}
+
+type recvName struct {
+	s string
+}
+
+func (n recvName) String() string {
+	return n.s
+}
+
+// recvLabel gets String from the embedded recvName
+type recvLabel struct {
+	recvName
+}
+
+func recvLabels() []fmt.Stringer {
+	var l fmt.Stringer = recvLabel{}
+	return append([]fmt.Stringer{l}, recvName{"a"})
+}
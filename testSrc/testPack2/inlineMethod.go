@@ -0,0 +1,16 @@
+package testPack2
+
+import "strconv"
+
+func Describe(c *Counter) string {
+	return "count: " + strconv.Itoa(c.Count)
+}
+
+func (c *Counter) Reset() {
+	c.Count = 0
+	c.Inc()
+}
+
+func Hidden() int {
+	return helper()
+}
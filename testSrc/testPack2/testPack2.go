@@ -0,0 +1,22 @@
+package testPack2
+
+// Counter counts calls of Inc
+type Counter struct {
+	Count int
+}
+
+func (c *Counter) Inc() {
+	c.Count++
+}
+
+func NewCounter() *Counter {
+	return &Counter{}
+}
+
+func helper() int {
+	return 1
+}
+
+func Twice(n int) int {
+	return n * helper() * 2
+}